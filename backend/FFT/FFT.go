@@ -2,86 +2,190 @@ package fft
 
 import (
 	"fmt"
-	"log"
 	"math"
 	"math/cmplx"
+	"novacal/logging"
 	"sort"
 
 	"gonum.org/v1/gonum/dsp/fourier"
 )
 
 const (
-	MinMagnitude = -120.0
+	MinMagnitude = -120.0 // Default dB floor of returned magnitudes
+	FFTSize      = 65536  // Number of points used for each FFT
 )
 
+// FFTOptions holds optional settings for ComputeFFTWithOptions
+type FFTOptions struct {
+	Window       string    // Built-in window: "blackman" (default), "hann" or "rectangular"
+	CustomWindow []float64 // Window coefficients of length FFTSize, overrides Window
+	MinFreq      float64   // Lowest returned frequency in Hz, 0 for no lower bound
+	MaxFreq      float64   // Highest returned frequency in Hz, 0 for no upper bound
+	FloorDb      float64   // Magnitudes are clamped to this floor, 0 selects MinMagnitude
+	Overlap      float64   // Block overlap fraction in [0, 1) for averaged file spectra
+	Complex      bool      // Also return the raw complex coefficients of each bin
+	Parseval     bool      // Also return the Parseval energy ratio as a scaling check
+	// Samples are converted to physical units as value*Scale + Offset before
+	// the transform. A Scale of 0 selects 1.
+	Scale  float64
+	Offset float64
+}
+
+// units returns the scale and offset converting raw samples to physical units
+func (o FFTOptions) units() (float64, float64) {
+	if o.Scale == 0 {
+		return 1, o.Offset
+	}
+	return o.Scale, o.Offset
+}
+
 type FFTResult struct {
 	Frequencies []float64   `json:"frequencies"`
 	Magnitudes  []float64   `json:"magnitudes"`
-	Harmonics   [][]float64 `json:"harmonics"`
+	Phases      []float64   `json:"phases"`    // Radians
+	Harmonics   [][]float64 `json:"harmonics"` // [frequency, magnitude, order] rows set by FindHarmonics
 	SampleRate  float64     `json:"sampleRate"`
+	FloorDb     float64     `json:"floorDb"` // Floor the magnitudes were clamped to
+	// Raw coefficients of the windowed FFT, only set when requested
+	Real []float64 `json:"real,omitempty"`
+	Imag []float64 `json:"imag,omitempty"`
+	// Energy of the returned linear magnitudes over that of the windowed
+	// input, only set when requested. It is 1 when the magnitude scaling is
+	// correct.
+	ParsevalRatio float64 `json:"parsevalRatio,omitempty"`
+	// Set when a narrow tone stands out at the top of the band, which
+	// suggests content at or above Nyquist folded back into the spectrum.
+	// AliasingFrequency is the strongest bin there.
+	AliasingWarning   bool    `json:"aliasingWarning"`
+	AliasingFrequency float64 `json:"aliasingFrequency,omitempty"`
+	// Total harmonic distortion in percent of the fundamental, and the
+	// fundamental it was measured against, set by FindHarmonics
+	THD         float64 `json:"thd,omitempty"`
+	Fundamental float64 `json:"fundamental,omitempty"`
+	// Standard deviation in dB across the files of an averaged spectrum,
+	// one per frequency, only set by AverageSpectra
+	StdDev []float64 `json:"stdDev,omitempty"`
 }
 
+// The top aliasingBandFraction of the band is checked for aliasing, which is
+// flagged when its strongest bin has aliasingPeakRatio times the median power
+// of the bins below it and at least aliasingMinShare of the AC energy. Broadband
+// noise spreads evenly over the band, so only a narrow tone trips the check.
+const (
+	aliasingBandFraction = 0.05
+	aliasingPeakRatio    = 100 // 20 dB
+	aliasingMinShare     = 1e-6
+)
+
 func ComputeFFT(data []float64, sampleRate float64) (*FFTResult, error) {
+	return ComputeFFTWithOptions(data, sampleRate, FFTOptions{})
+}
+
+// ComputeFFTWithOptions computes the single-sided magnitude spectrum of data
+// using the window selected in opts
+func ComputeFFTWithOptions(data []float64, sampleRate float64, opts FFTOptions) (*FFTResult, error) {
 	// Validate input data
 	if len(data) == 0 {
 		return nil, fmt.Errorf("empty input data")
 	}
+	if opts.MinFreq < 0 || opts.MaxFreq < 0 || (opts.MaxFreq > 0 && opts.MaxFreq < opts.MinFreq) {
+		return nil, fmt.Errorf("invalid frequency range: %g to %g Hz", opts.MinFreq, opts.MaxFreq)
+	}
 
 	// Use larger FFT size for better low-frequency resolution
-	fftSize := 65536
-	log.Printf("Using %d points for FFT", fftSize)
+	fftSize := FFTSize
+	logging.Debugf("Using %d points for FFT", fftSize)
+
+	floor := opts.FloorDb
+	if floor == 0 {
+		floor = MinMagnitude
+	}
+
+	window, err := windowCoefficients(opts, fftSize)
+	if err != nil {
+		return nil, err
+	}
 
 	// Initialize FFT
 	fft := fourier.NewFFT(fftSize)
 
-	// Normalize input data
-	maxAbs := 0.0
+	if scale, offset := opts.units(); scale != 1 || offset != 0 {
+		scaled := make([]float64, len(data))
+		for i, v := range data {
+			scaled[i] = v*scale + offset
+		}
+		data = scaled
+	}
+
+	// Remove the DC offset
 	mean := 0.0
 	for _, v := range data {
 		mean += v
-		if abs := math.Abs(v); abs > maxAbs {
-			maxAbs = abs
-		}
 	}
 	mean /= float64(len(data))
 
-	// Store original scale for later
-	scale := maxAbs
-
-	// Prepare input data with proper scaling
+	// Prepare input data, keeping the signal in its own units
 	input := make([]float64, fftSize)
 	for i := 0; i < fftSize && i < len(data); i++ {
-		// Center and normalize, but don't scale to unit amplitude
 		input[i] = data[i] - mean
 	}
 
-	// Apply Blackman window
+	// Apply window
 	windowSum := 0.0
+	energy := 0.0
 	for i := range input {
-		// Blackman window coefficients
-		a0, a1, a2 := 0.42, 0.5, 0.08
-		t := float64(i) / float64(fftSize-1)
-		window := a0 - a1*math.Cos(2*math.Pi*t) + a2*math.Cos(4*math.Pi*t)
-		input[i] *= window
-		windowSum += window
+		input[i] *= window[i]
+		windowSum += window[i]
+		energy += input[i] * input[i]
+	}
+	if windowSum == 0 {
+		return nil, fmt.Errorf("window coefficients sum to zero")
 	}
 
 	// Compute FFT
 	coeffs := fft.Coefficients(nil, input)
 
+	return spectrumResult(fft, coeffs, nil, sampleRate, windowSum, energy, floor, opts), nil
+}
+
+// spectrumResult converts FFT coefficients to the scaled single-sided dB
+// spectrum. amplitudes overrides the coefficient magnitudes when averaging
+// several blocks, and energy is the sum of squares of the windowed input, or
+// its mean over the blocks. Magnitudes are in the units of the input, so a
+// sine of amplitude A peaks at 20*log10(A) dB.
+func spectrumResult(fft *fourier.FFT, coeffs []complex128, amplitudes []float64,
+	sampleRate, windowSum, energy, floor float64, opts FFTOptions) *FFTResult {
+	fftSize := fft.Len()
+
 	// Process only up to Nyquist frequency
 	numFreqs := fftSize/2 + 1
 	frequencies := make([]float64, numFreqs)
 	magnitudes := make([]float64, numFreqs)
+	phases := make([]float64, numFreqs)
 
 	// Window correction factor
 	windowCorrection := float64(fftSize) / windowSum
 
+	// Energy of the single-sided amplitudes; interior bins were doubled and
+	// hold the halves of a sinusoid's power
+	spectrumEnergy := 0.0
+
+	// AC energy, power of the bins below the top of the band and the
+	// strongest bin within it, for the aliasing check
+	aliasStart := int(math.Ceil(float64(numFreqs-1) * (1 - aliasingBandFraction)))
+	acEnergy := 0.0
+	lowerPowers := make([]float64, 0, aliasStart)
+	topPeak, topPeakPower := 0, 0.0
+
 	// Calculate magnitudes with proper scaling
 	for i := 0; i < numFreqs; i++ {
-		// Use fft.Freq to get correct frequency mapping
-		frequencies[i] = fft.Freq(i) * (sampleRate / 2)
+		// fft.Freq is in cycles per sample, so bin numFreqs-1 is Nyquist
+		frequencies[i] = fft.Freq(i) * sampleRate
 		magnitude := cmplx.Abs(coeffs[i])
+		if amplitudes != nil {
+			magnitude = amplitudes[i]
+		}
+		phases[i] = cmplx.Phase(coeffs[i])
 
 		// Apply proper scaling:
 		// 1. Window correction
@@ -92,21 +196,381 @@ func ComputeFFT(data []float64, sampleRate float64) (*FFTResult, error) {
 			magnitude *= 2 // Compensate for single-sided spectrum
 		}
 
-		// Convert to dB, preserving original signal scale
-		power := magnitude * scale
+		// Convert to dB
+		power := magnitude
+		if i > 0 && i < numFreqs-1 {
+			spectrumEnergy += power * power / 2
+		} else {
+			spectrumEnergy += power * power
+		}
+		if i > 0 {
+			acEnergy += power * power
+			if i < aliasStart {
+				lowerPowers = append(lowerPowers, power*power)
+			} else if power*power > topPeakPower {
+				topPeak, topPeakPower = i, power*power
+			}
+		}
 		if power > 0 {
-			magnitudes[i] = 20 * math.Log10(power)
+			magnitudes[i] = math.Max(20*math.Log10(power), floor)
 		} else {
-			magnitudes[i] = MinMagnitude
+			magnitudes[i] = floor
 		}
 	}
 
-	return &FFTResult{
-		Frequencies: frequencies,
-		Magnitudes:  magnitudes,
+	// Keep only the requested band; scaling was applied over the full spectrum
+	lo, hi := bandIndices(frequencies, opts.MinFreq, opts.MaxFreq)
+
+	result := &FFTResult{
+		Frequencies: frequencies[lo:hi],
+		Magnitudes:  magnitudes[lo:hi],
+		Phases:      phases[lo:hi],
 		Harmonics:   [][]float64{},
 		SampleRate:  sampleRate,
-	}, nil
+		FloorDb:     floor,
+	}
+	if acEnergy > 0 && len(lowerPowers) > 0 && topPeakPower >= aliasingMinShare*acEnergy {
+		sort.Float64s(lowerPowers)
+		if topPeakPower > aliasingPeakRatio*lowerPowers[len(lowerPowers)/2] {
+			result.AliasingWarning = true
+			result.AliasingFrequency = frequencies[topPeak]
+		}
+	}
+	// By Parseval's theorem the windowed input energy, corrected for the
+	// window gain the magnitudes were divided by, equals the spectrum energy
+	if opts.Parseval && energy > 0 {
+		result.ParsevalRatio = spectrumEnergy / (energy * float64(fftSize) / (windowSum * windowSum))
+	}
+	if opts.Complex {
+		result.Real = make([]float64, hi-lo)
+		result.Imag = make([]float64, hi-lo)
+		for i := lo; i < hi; i++ {
+			result.Real[i-lo] = real(coeffs[i])
+			result.Imag[i-lo] = imag(coeffs[i])
+		}
+	}
+	return result
+}
+
+// bandIndices returns the index range of the ascending frequencies that lie
+// within [minFreq, maxFreq]. A maxFreq of 0 means no upper bound.
+func bandIndices(frequencies []float64, minFreq, maxFreq float64) (int, int) {
+	lo := sort.SearchFloat64s(frequencies, minFreq)
+	hi := len(frequencies)
+	if maxFreq > 0 {
+		hi = sort.Search(len(frequencies), func(i int) bool { return frequencies[i] > maxFreq })
+	}
+	if hi < lo {
+		hi = lo
+	}
+	return lo, hi
+}
+
+// LimitPoints reduces the spectrum to at most maxPoints bins by keeping the
+// strongest bin of each group, so peaks survive the reduction.
+// A maxPoints of 0 or less disables the limit.
+func LimitPoints(result *FFTResult, maxPoints int) {
+	n := len(result.Magnitudes)
+	if maxPoints <= 0 || n <= maxPoints {
+		return
+	}
+
+	groupSize := int(math.Ceil(float64(n) / float64(maxPoints)))
+	frequencies := make([]float64, 0, maxPoints)
+	magnitudes := make([]float64, 0, maxPoints)
+	phases := make([]float64, 0, maxPoints)
+	var reals, imags, stdDevs []float64
+	hasComplex := len(result.Real) == n && len(result.Imag) == n
+	hasStdDev := len(result.StdDev) == n
+	for start := 0; start < n; start += groupSize {
+		end := start + groupSize
+		if end > n {
+			end = n
+		}
+		peak := start
+		for i := start + 1; i < end; i++ {
+			if result.Magnitudes[i] > result.Magnitudes[peak] {
+				peak = i
+			}
+		}
+		frequencies = append(frequencies, result.Frequencies[peak])
+		magnitudes = append(magnitudes, result.Magnitudes[peak])
+		if len(result.Phases) == n {
+			phases = append(phases, result.Phases[peak])
+		}
+		if hasComplex {
+			reals = append(reals, result.Real[peak])
+			imags = append(imags, result.Imag[peak])
+		}
+		if hasStdDev {
+			stdDevs = append(stdDevs, result.StdDev[peak])
+		}
+	}
+
+	result.Frequencies = frequencies
+	result.Magnitudes = magnitudes
+	if len(result.Phases) == n {
+		result.Phases = phases
+	}
+	if hasComplex {
+		result.Real, result.Imag = reals, imags
+	}
+	if hasStdDev {
+		result.StdDev = stdDevs
+	}
+}
+
+// Reference frequency of the fractional-octave band centres (IEC 61260)
+const bandReferenceFreq = 1000.0
+
+// LogBin re-bins the spectrum into fractional-octave bands with
+// bandsPerOctave bands per octave, replacing the frequencies with the band
+// centres and the magnitudes with the mean power of the bins in each band.
+// Each band keeps the phase and spread of its strongest bin. DC and bands holding no bin
+// are dropped, as are the complex coefficients.
+func LogBin(result *FFTResult, bandsPerOctave int) {
+	if bandsPerOctave <= 0 || len(result.Frequencies) == 0 {
+		return
+	}
+	n := len(result.Magnitudes)
+	step := 1 / float64(bandsPerOctave)
+	hasPhases := len(result.Phases) == n
+	hasStdDev := len(result.StdDev) == n
+
+	// Band index of a frequency, counted in band steps from the reference
+	band := func(freq float64) int {
+		return int(math.Round(math.Log2(freq/bandReferenceFreq) / step))
+	}
+
+	var frequencies, magnitudes, phases, stdDevs []float64
+	for i := 0; i < n; {
+		if result.Frequencies[i] <= 0 {
+			i++
+			continue
+		}
+		k := band(result.Frequencies[i])
+		power := 0.0
+		peak := i
+		count := 0
+		for ; i < n && band(result.Frequencies[i]) == k; i++ {
+			power += math.Pow(10, result.Magnitudes[i]/10)
+			if result.Magnitudes[i] > result.Magnitudes[peak] {
+				peak = i
+			}
+			count++
+		}
+		magnitude := 10 * math.Log10(power/float64(count))
+		if magnitude < result.FloorDb {
+			magnitude = result.FloorDb
+		}
+		frequencies = append(frequencies, bandReferenceFreq*math.Pow(2, float64(k)*step))
+		magnitudes = append(magnitudes, magnitude)
+		if hasPhases {
+			phases = append(phases, result.Phases[peak])
+		}
+		if hasStdDev {
+			stdDevs = append(stdDevs, result.StdDev[peak])
+		}
+	}
+
+	result.Frequencies = frequencies
+	result.Magnitudes = magnitudes
+	if hasPhases {
+		result.Phases = phases
+	}
+	if hasStdDev {
+		result.StdDev = stdDevs
+	}
+	result.Real, result.Imag = nil, nil
+}
+
+// windowCoefficients returns the window selected in opts for n points
+func windowCoefficients(opts FFTOptions, n int) ([]float64, error) {
+	if opts.CustomWindow != nil {
+		if len(opts.CustomWindow) != n {
+			return nil, fmt.Errorf("custom window has %d coefficients, expected %d",
+				len(opts.CustomWindow), n)
+		}
+		return opts.CustomWindow, nil
+	}
+
+	window := make([]float64, n)
+	for i := range window {
+		t := float64(i) / float64(n-1)
+		switch opts.Window {
+		case "", "blackman":
+			// Blackman window coefficients
+			a0, a1, a2 := 0.42, 0.5, 0.08
+			window[i] = a0 - a1*math.Cos(2*math.Pi*t) + a2*math.Cos(4*math.Pi*t)
+		case "hann":
+			window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*t)
+		case "rectangular":
+			window[i] = 1
+		default:
+			return nil, fmt.Errorf("unknown window: %s", opts.Window)
+		}
+	}
+	return window, nil
+}
+
+// FindPeaks returns the local maxima of result between minFreq and maxFreq
+// (0 for no upper bound) as [frequency, magnitude] pairs, strongest first.
+// A peak must rise at least prominenceDb above the deepest point separating
+// it from any stronger bin in the range, and bins at the result's dB floor
+// are never peaks. A maxPeaks of 0 or less returns all.
+func FindPeaks(result *FFTResult, minFreq, maxFreq, prominenceDb float64, maxPeaks int) [][]float64 {
+	peaks := [][]float64{}
+	if result == nil || len(result.Frequencies) != len(result.Magnitudes) {
+		return peaks
+	}
+
+	lo, hi := bandIndices(result.Frequencies, minFreq, maxFreq)
+	mags := result.Magnitudes[lo:hi]
+	for i := 1; i < len(mags)-1; i++ {
+		if mags[i] <= result.FloorDb || mags[i] <= mags[i-1] || mags[i] < mags[i+1] {
+			continue
+		}
+		if peakProminence(mags, i) >= prominenceDb {
+			peaks = append(peaks, []float64{result.Frequencies[lo+i], mags[i]})
+		}
+	}
+
+	// Sort by magnitude
+	sort.Slice(peaks, func(i, j int) bool {
+		return peaks[i][1] > peaks[j][1]
+	})
+
+	if maxPeaks > 0 && len(peaks) > maxPeaks {
+		peaks = peaks[:maxPeaks]
+	}
+
+	return peaks
+}
+
+// InterpolatePeaks refines [frequency, magnitude] peaks found on the bins of
+// result by fitting a parabola through each peak bin and its two neighbours
+// in dB, returning the sub-bin vertex estimates strongest first. Peaks at
+// the spectrum edges or not on a bin of result are returned unchanged.
+func InterpolatePeaks(result *FFTResult, peaks [][]float64) [][]float64 {
+	refined := make([][]float64, 0, len(peaks))
+	freqs, mags := result.Frequencies, result.Magnitudes
+	for _, peak := range peaks {
+		i := sort.SearchFloat64s(freqs, peak[0])
+		if i <= 0 || i >= len(freqs)-1 || freqs[i] != peak[0] {
+			refined = append(refined, []float64{peak[0], peak[1]})
+			continue
+		}
+
+		alpha, beta, gamma := mags[i-1], mags[i], mags[i+1]
+		curvature := alpha - 2*beta + gamma
+		if curvature >= 0 {
+			// Flat or not a maximum, nothing to fit
+			refined = append(refined, []float64{peak[0], peak[1]})
+			continue
+		}
+		// Vertex offset in bins, within half a bin of the peak
+		offset := 0.5 * (alpha - gamma) / curvature
+		binWidth := (freqs[i+1] - freqs[i-1]) / 2
+		refined = append(refined, []float64{
+			freqs[i] + offset*binWidth,
+			beta - 0.25*(alpha-gamma)*offset,
+		})
+	}
+
+	sort.Slice(refined, func(i, j int) bool {
+		return refined[i][1] > refined[j][1]
+	})
+	return refined
+}
+
+// peakProminence returns how far mags[peak] rises above the higher of the
+// minima found on each side before reaching a stronger bin or the edge
+func peakProminence(mags []float64, peak int) float64 {
+	leftMin := mags[peak]
+	for i := peak - 1; i >= 0 && mags[i] <= mags[peak]; i-- {
+		leftMin = math.Min(leftMin, mags[i])
+	}
+	rightMin := mags[peak]
+	for i := peak + 1; i < len(mags) && mags[i] <= mags[peak]; i++ {
+		rightMin = math.Min(rightMin, mags[i])
+	}
+	return mags[peak] - math.Max(leftMin, rightMin)
+}
+
+// Search window around each harmonic when FindHarmonics is given none, in
+// percent of the harmonic frequency
+const DefaultHarmonicTolerance = 2.0
+
+// FindHarmonics fills result.Harmonics with the strongest bin within
+// tolerance percent of each of the first nHarmonics multiples of fundamental,
+// so a drive slightly off its nominal frequency still matches, and sets THD
+// from them. The rows hold the matched frequency rather than the nominal
+// multiple. A fundamental of 0 uses the strongest bin above DC and a
+// tolerance of 0 selects DefaultHarmonicTolerance; windows are at least one
+// bin wide either side. Harmonics beyond the returned band are left out.
+func FindHarmonics(result *FFTResult, fundamental float64, nHarmonics int, tolerance float64) error {
+	if nHarmonics < 1 {
+		return fmt.Errorf("harmonic count must be at least 1, got %d", nHarmonics)
+	}
+	if fundamental < 0 || tolerance < 0 {
+		return fmt.Errorf("fundamental and tolerance must not be negative")
+	}
+	freqs, mags := result.Frequencies, result.Magnitudes
+	if len(freqs) < 2 || len(mags) != len(freqs) {
+		return fmt.Errorf("spectrum has too few bins for a harmonic search")
+	}
+	if tolerance == 0 {
+		tolerance = DefaultHarmonicTolerance
+	}
+	binWidth := freqs[1] - freqs[0]
+
+	if fundamental == 0 {
+		strongest := -1
+		for i, f := range freqs {
+			if f > 0 && (strongest < 0 || mags[i] > mags[strongest]) {
+				strongest = i
+			}
+		}
+		if strongest < 0 {
+			return fmt.Errorf("spectrum has no bins above DC")
+		}
+		fundamental = freqs[strongest]
+	}
+
+	harmonics := [][]float64{}
+	for order := 1; order <= nHarmonics; order++ {
+		target := float64(order) * fundamental
+		window := math.Max(target*tolerance/100, binWidth)
+		lo, hi := bandIndices(freqs, target-window, target+window)
+		if lo >= hi {
+			if target-window > freqs[len(freqs)-1] {
+				break
+			}
+			continue
+		}
+		peak := lo
+		for i := lo + 1; i < hi; i++ {
+			if mags[i] > mags[peak] {
+				peak = i
+			}
+		}
+		harmonics = append(harmonics, []float64{freqs[peak], mags[peak], float64(order)})
+	}
+	result.Harmonics = harmonics
+	result.Fundamental = fundamental
+
+	// THD = sqrt(sum of squared harmonic amplitudes) / fundamental amplitude
+	result.THD = 0
+	if len(harmonics) > 0 && harmonics[0][2] == 1 {
+		fundamentalAmplitude := math.Pow(10, harmonics[0][1]/20)
+		power := 0.0
+		for _, h := range harmonics[1:] {
+			amplitude := math.Pow(10, h[1]/20)
+			power += amplitude * amplitude
+		}
+		result.THD = 100 * math.Sqrt(power) / fundamentalAmplitude
+	}
+	return nil
 }
 
 func findPeaksWithFundamental(frequencies, magnitudes []float64) [][]float64 {
@@ -0,0 +1,92 @@
+package fft
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// testSignal returns two tones, one off-bin, at 51200 Hz
+func testSignal(n int) []float64 {
+	data := make([]float64, n)
+	for i := range data {
+		t := float64(i) / 51200
+		data[i] = math.Sin(2*math.Pi*1000*t) + 0.25*math.Sin(2*math.Pi*3333.3*t+0.4)
+	}
+	return data
+}
+
+func TestCustomRectangularWindowMatchesBuiltIn(t *testing.T) {
+	data := testSignal(FFTSize)
+	builtIn, err := ComputeFFTWithOptions(data, 51200, FFTOptions{Window: "rectangular"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The coherent gain correction makes the window's scale irrelevant
+	for _, level := range []float64{1, 2.5} {
+		window := make([]float64, FFTSize)
+		for i := range window {
+			window[i] = level
+		}
+		custom, err := ComputeFFTWithOptions(data, 51200, FFTOptions{CustomWindow: window})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(custom.Magnitudes) != len(builtIn.Magnitudes) {
+			t.Fatalf("got %d bins, want %d", len(custom.Magnitudes), len(builtIn.Magnitudes))
+		}
+		// Compare amplitudes so bins at the rounding floor, hundreds of dB
+		// down, cannot fail the comparison
+		for i := range builtIn.Magnitudes {
+			got, want := math.Pow(10, custom.Magnitudes[i]/20), math.Pow(10, builtIn.Magnitudes[i]/20)
+			if math.Abs(got-want) > 1e-9 {
+				t.Fatalf("window of %v: bin %d is %v dB, built-in %v dB",
+					level, i, custom.Magnitudes[i], builtIn.Magnitudes[i])
+			}
+		}
+	}
+}
+
+func TestCustomWindowLengthIsValidated(t *testing.T) {
+	_, err := ComputeFFTWithOptions(testSignal(FFTSize), 51200, FFTOptions{CustomWindow: make([]float64, 100)})
+	if err == nil {
+		t.Error("a 100-point custom window was accepted")
+	}
+}
+
+func TestTransferFunctionOfTooFewSamples(t *testing.T) {
+	_, _, _, err := TransferFunction([]float64{1}, []float64{1}, 51200)
+	if err == nil || !strings.Contains(err.Error(), "too few samples") {
+		t.Errorf("one sample gave %v, want a too few samples error", err)
+	}
+}
+
+func TestToneLandsOnItsBin(t *testing.T) {
+	const bin = 100
+	for _, rate := range []float64{1000, 51200} {
+		freq := bin * rate / FFTSize
+		data := make([]float64, FFTSize)
+		for i := range data {
+			data[i] = math.Sin(2 * math.Pi * freq * float64(i) / rate)
+		}
+		result, err := ComputeFFT(data, rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		peak := 0
+		for i, m := range result.Magnitudes {
+			if m > result.Magnitudes[peak] {
+				peak = i
+			}
+		}
+		if peak != bin || math.Abs(result.Frequencies[peak]-freq) > 1e-9 {
+			t.Errorf("%v Hz rate: %v Hz tone peaks in bin %d at %v Hz, want bin %d",
+				rate, freq, peak, result.Frequencies[peak], bin)
+		}
+		if top := result.Frequencies[len(result.Frequencies)-1]; math.Abs(top-rate/2) > 1e-9 {
+			t.Errorf("%v Hz rate: spectrum ends at %v Hz, want Nyquist %v Hz", rate, top, rate/2)
+		}
+	}
+}
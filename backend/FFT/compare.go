@@ -0,0 +1,177 @@
+package fft
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Relative tolerance for treating two frequency axes as the same bins
+const binTolerance = 1e-9
+
+// CompareFFT returns the magnitude difference b - a in dB on the frequency
+// bins of a. When the spectra share a sample rate and bins they are
+// subtracted directly; otherwise b is linearly interpolated onto the bins of
+// a, and bins of a outside the frequency span of b are dropped.
+func CompareFFT(a, b *FFTResult) ([]float64, []float64, error) {
+	if a == nil || b == nil || len(a.Frequencies) == 0 || len(b.Frequencies) == 0 {
+		return nil, nil, fmt.Errorf("both spectra must be non-empty")
+	}
+	if len(a.Magnitudes) != len(a.Frequencies) || len(b.Magnitudes) != len(b.Frequencies) {
+		return nil, nil, fmt.Errorf("spectra must have one magnitude per frequency")
+	}
+
+	if sameRate(a.SampleRate, b.SampleRate) && sameBins(a.Frequencies, b.Frequencies) {
+		delta := make([]float64, len(a.Magnitudes))
+		for i := range delta {
+			delta[i] = b.Magnitudes[i] - a.Magnitudes[i]
+		}
+		return append([]float64(nil), a.Frequencies...), delta, nil
+	}
+
+	lowest, highest := b.Frequencies[0], b.Frequencies[len(b.Frequencies)-1]
+	var freqs, delta []float64
+	for i, f := range a.Frequencies {
+		if f < lowest || f > highest {
+			continue
+		}
+		freqs = append(freqs, f)
+		delta = append(delta, interpolate(b.Frequencies, b.Magnitudes, f)-a.Magnitudes[i])
+	}
+	if len(freqs) == 0 {
+		return nil, nil, fmt.Errorf("spectra do not overlap in frequency")
+	}
+	return freqs, delta, nil
+}
+
+// AverageSpectra returns the mean dB magnitude of several spectra on the
+// bins of the first, with the standard deviation across them in StdDev.
+// Spectra on other bins are interpolated as in CompareFFT, and bins outside
+// the frequency span of any spectrum are dropped. Phases and complex
+// coefficients do not average meaningfully and are left out; the aliasing
+// warning of the first spectrum to raise one is kept.
+func AverageSpectra(spectra []*FFTResult) (*FFTResult, error) {
+	if len(spectra) == 0 {
+		return nil, fmt.Errorf("no spectra to average")
+	}
+	for _, s := range spectra {
+		if s == nil || len(s.Frequencies) == 0 || len(s.Magnitudes) != len(s.Frequencies) {
+			return nil, fmt.Errorf("spectra must be non-empty with one magnitude per frequency")
+		}
+	}
+
+	ref := spectra[0]
+	average := &FFTResult{
+		Phases:     []float64{},
+		Harmonics:  [][]float64{},
+		SampleRate: ref.SampleRate,
+		FloorDb:    ref.FloorDb,
+	}
+	for _, s := range spectra {
+		if s.AliasingWarning {
+			average.AliasingWarning = true
+			average.AliasingFrequency = s.AliasingFrequency
+			break
+		}
+	}
+	// Spectra on the bins of the first are read directly, the rest interpolated
+	aligned := make([]bool, len(spectra))
+	for j, s := range spectra {
+		aligned[j] = sameRate(ref.SampleRate, s.SampleRate) && sameBins(ref.Frequencies, s.Frequencies)
+	}
+	values := make([]float64, len(spectra))
+	for i, f := range ref.Frequencies {
+		covered := true
+		for j, s := range spectra {
+			if aligned[j] {
+				values[j] = s.Magnitudes[i]
+				continue
+			}
+			if f < s.Frequencies[0] || f > s.Frequencies[len(s.Frequencies)-1] {
+				covered = false
+				break
+			}
+			values[j] = interpolate(s.Frequencies, s.Magnitudes, f)
+		}
+		if !covered {
+			continue
+		}
+
+		mean := 0.0
+		for _, v := range values {
+			mean += v
+		}
+		mean /= float64(len(values))
+		variance := 0.0
+		for _, v := range values {
+			variance += (v - mean) * (v - mean)
+		}
+		average.Frequencies = append(average.Frequencies, f)
+		average.Magnitudes = append(average.Magnitudes, mean)
+		average.StdDev = append(average.StdDev, math.Sqrt(variance/float64(len(values))))
+	}
+	if len(average.Frequencies) == 0 {
+		return nil, fmt.Errorf("spectra do not overlap in frequency")
+	}
+	return average, nil
+}
+
+// sameRate reports whether two spectra were taken at the same sample rate,
+// treating an unset rate as matching
+func sameRate(a, b float64) bool {
+	return a == 0 || b == 0 || math.Abs(a-b) <= binTolerance*math.Max(a, b)
+}
+
+func sameBins(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > binTolerance*math.Max(math.Abs(a[i]), 1) {
+			return false
+		}
+	}
+	return true
+}
+
+// interpolate evaluates the piecewise-linear curve through (xs, ys) at x,
+// where xs is ascending and x lies within it
+func interpolate(xs, ys []float64, x float64) float64 {
+	j := sort.SearchFloat64s(xs, x)
+	if j < len(xs) && xs[j] == x {
+		return ys[j]
+	}
+	if j == 0 {
+		return ys[0]
+	}
+	if j == len(xs) {
+		return ys[len(ys)-1]
+	}
+	t := (x - xs[j-1]) / (xs[j] - xs[j-1])
+	return ys[j-1] + t*(ys[j]-ys[j-1])
+}
+
+// LimitDelta reduces a difference spectrum to at most maxPoints points,
+// keeping the largest absolute difference in each group of bins
+func LimitDelta(freqs, delta []float64, maxPoints int) ([]float64, []float64) {
+	n := len(delta)
+	if maxPoints <= 0 || n <= maxPoints {
+		return freqs, delta
+	}
+
+	groupSize := int(math.Ceil(float64(n) / float64(maxPoints)))
+	limitedFreqs := make([]float64, 0, maxPoints)
+	limitedDelta := make([]float64, 0, maxPoints)
+	for start := 0; start < n; start += groupSize {
+		end := min(start+groupSize, n)
+		peak := start
+		for i := start + 1; i < end; i++ {
+			if math.Abs(delta[i]) > math.Abs(delta[peak]) {
+				peak = i
+			}
+		}
+		limitedFreqs = append(limitedFreqs, freqs[peak])
+		limitedDelta = append(limitedDelta, delta[peak])
+	}
+	return limitedFreqs, limitedDelta
+}
@@ -0,0 +1,62 @@
+package fft
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Significant digits written for CSV values when no precision is given
+const defaultCSVPrecision = 6
+
+// formatCSV formats v with precision significant digits, 0 selecting
+// defaultCSVPrecision and a negative precision the shortest exact form
+func formatCSV(v float64, precision int) string {
+	if precision == 0 {
+		precision = defaultCSVPrecision
+	}
+	return strconv.FormatFloat(v, 'g', max(precision, -1), 64)
+}
+
+// ExportCSV writes a spectrum as Frequency (Hz), Magnitude (dB), Phase (rad)
+// rows with precision significant digits (see formatCSV). A known sample
+// rate is recorded first in a "# Sample Rate (Hz):" comment line so the
+// frequency axis can be checked when the file is read back. Phases are
+// omitted when the result has none.
+func ExportCSV(path string, result *FFTResult, precision int) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if result.SampleRate > 0 {
+		if _, err := fmt.Fprintf(file, "# Sample Rate (Hz): %s\n", strconv.FormatFloat(result.SampleRate, 'g', -1, 64)); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	hasPhases := len(result.Phases) == len(result.Magnitudes)
+	writer := csv.NewWriter(file)
+	header := []string{"Frequency (Hz)", "Magnitude (dB)"}
+	if hasPhases {
+		header = append(header, "Phase (rad)")
+	}
+	writer.Write(header)
+	for i, freq := range result.Frequencies {
+		row := []string{
+			formatCSV(freq, precision),
+			formatCSV(result.Magnitudes[i], precision),
+		}
+		if hasPhases {
+			row = append(row, formatCSV(result.Phases[i], precision))
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
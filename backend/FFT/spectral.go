@@ -0,0 +1,168 @@
+package fft
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+)
+
+// DefaultSegmentSize is the Welch segment length used when none is given
+const DefaultSegmentSize = 4096
+
+// Coherence returns the magnitude-squared coherence between tx and rx for
+// each frequency bin, estimated from Hann-windowed segments of segmentSize
+// samples with 50% overlap. Values near 1 mean rx follows tx linearly.
+func Coherence(tx, rx []float64, sampleRate float64, segmentSize int) ([]float64, []float64, error) {
+	if sampleRate <= 0 {
+		return nil, nil, fmt.Errorf("sample rate must be positive, got %v", sampleRate)
+	}
+	sxx, syy, sxy, err := welchSpectra(tx, rx, segmentSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	freqs := binFrequencies(len(sxx), sampleRate)
+	coh := make([]float64, len(sxx))
+	for k := range coh {
+		if denom := sxx[k] * syy[k]; denom > 0 {
+			magnitude := cmplx.Abs(sxy[k])
+			coh[k] = magnitude * magnitude / denom
+		}
+	}
+	return freqs, coh, nil
+}
+
+// TransferFunction estimates rx/tx as a function of frequency from the ratio
+// of the Welch-averaged cross-spectrum to the tx auto-spectrum (the H1
+// estimator), returning the gain in dB and the phase in degrees
+func TransferFunction(tx, rx []float64, sampleRate float64) ([]float64, []float64, []float64, error) {
+	if sampleRate <= 0 {
+		return nil, nil, nil, fmt.Errorf("sample rate must be positive, got %v", sampleRate)
+	}
+
+	n := min(len(tx), len(rx))
+	if n < 2 {
+		return nil, nil, nil, fmt.Errorf("too few samples for a transfer function: need at least 2 per signal, got %d", n)
+	}
+
+	// Short captures are analysed as a single segment
+	segmentSize := DefaultSegmentSize
+	if n < segmentSize {
+		segmentSize = n - n%2
+	}
+	sxx, _, sxy, err := welchSpectra(tx, rx, segmentSize)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	freqs := binFrequencies(len(sxx), sampleRate)
+	magDb := make([]float64, len(sxx))
+	phaseDeg := make([]float64, len(sxx))
+	for k := range sxx {
+		if sxx[k] == 0 {
+			magDb[k] = MinMagnitude
+			continue
+		}
+		h := sxy[k] / complex(sxx[k], 0)
+		if gain := cmplx.Abs(h); gain > 0 {
+			magDb[k] = 20 * math.Log10(gain)
+		} else {
+			magDb[k] = MinMagnitude
+		}
+		phaseDeg[k] = cmplx.Phase(h) * 180 / math.Pi
+	}
+	return freqs, magDb, phaseDeg, nil
+}
+
+// welchSpectra averages the auto-spectra of x and y and their cross-spectrum
+// conj(X)*Y over overlapping Hann-windowed segments. Both signals are
+// truncated to the shorter length and each segment has its mean removed.
+func welchSpectra(x, y []float64, segmentSize int) ([]float64, []float64, []complex128, error) {
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+	n := len(x)
+	if len(y) < n {
+		n = len(y)
+	}
+	if segmentSize < 2 || n < segmentSize {
+		return nil, nil, nil, fmt.Errorf("need at least %d samples per signal, got %d", segmentSize, n)
+	}
+
+	window, _ := windowCoefficients(FFTOptions{Window: "hann"}, segmentSize)
+	fft := fourier.NewFFT(segmentSize)
+	bins := segmentSize/2 + 1
+	sxx := make([]float64, bins)
+	syy := make([]float64, bins)
+	sxy := make([]complex128, bins)
+
+	segX := make([]float64, segmentSize)
+	segY := make([]float64, segmentSize)
+	var specX, specY []complex128
+	segments := 0
+	for start := 0; start+segmentSize <= n; start += segmentSize / 2 {
+		meanX, meanY := 0.0, 0.0
+		for i := 0; i < segmentSize; i++ {
+			meanX += x[start+i]
+			meanY += y[start+i]
+		}
+		meanX /= float64(segmentSize)
+		meanY /= float64(segmentSize)
+		for i := 0; i < segmentSize; i++ {
+			segX[i] = (x[start+i] - meanX) * window[i]
+			segY[i] = (y[start+i] - meanY) * window[i]
+		}
+
+		specX = fft.Coefficients(specX, segX)
+		specY = fft.Coefficients(specY, segY)
+		for k := 0; k < bins; k++ {
+			sxx[k] += real(specX[k])*real(specX[k]) + imag(specX[k])*imag(specX[k])
+			syy[k] += real(specY[k])*real(specY[k]) + imag(specY[k])*imag(specY[k])
+			sxy[k] += cmplx.Conj(specX[k]) * specY[k]
+		}
+		segments++
+	}
+
+	for k := 0; k < bins; k++ {
+		sxx[k] /= float64(segments)
+		syy[k] /= float64(segments)
+		sxy[k] /= complex(float64(segments), 0)
+	}
+	return sxx, syy, sxy, nil
+}
+
+// binFrequencies returns the frequencies of the first bins of a real FFT
+// whose segment length is 2*(bins-1)
+func binFrequencies(bins int, sampleRate float64) []float64 {
+	segmentSize := 2 * (bins - 1)
+	freqs := make([]float64, bins)
+	for k := range freqs {
+		freqs[k] = float64(k) * sampleRate / float64(segmentSize)
+	}
+	return freqs
+}
+
+// Goertzel returns the amplitude and phase in radians of the component of
+// data at targetFreq, using the generalised Goertzel algorithm so the
+// frequency need not fall on a DFT bin. The amplitude is that of a sinusoid,
+// 2|X|/N, and the phase is relative to a cosine starting at the first
+// sample. It costs one pass over data, against a full FFT for every bin.
+func Goertzel(data []float64, sampleRate, targetFreq float64) (magnitude, phase float64) {
+	n := len(data)
+	if n == 0 || sampleRate <= 0 {
+		return 0, 0
+	}
+	w := 2 * math.Pi * targetFreq / sampleRate
+	coeff := 2 * math.Cos(w)
+	var s1, s2 float64
+	for _, x := range data {
+		s1, s2 = x+coeff*s1-s2, s1
+	}
+
+	// X(w) = e^(-jw(N-1)) * (s[N-1] - e^(-jw) s[N-2])
+	y := complex(s1, 0) - cmplx.Exp(complex(0, -w))*complex(s2, 0)
+	coefficient := y * cmplx.Exp(complex(0, -w*float64(n-1)))
+	return 2 * cmplx.Abs(coefficient) / float64(n), cmplx.Phase(coefficient)
+}
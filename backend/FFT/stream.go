@@ -0,0 +1,150 @@
+package fft
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"novacal/timeseries"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+)
+
+// ComputeAveragedFFTFromFile streams a float32 file in FFTSize blocks,
+// overlapping by opts.Overlap, and averages their periodograms so the whole
+// capture contributes to the spectrum without loading it into memory. The
+// first headerBytes bytes are skipped and only samples [startIndex, endIndex)
+// are used, an endIndex of 0 reading to the end. Phases are those of the mean
+// block coefficients. Ranges shorter than one block give a zero-padded single
+// block.
+func ComputeAveragedFFTFromFile(path string, sampleRate float64, headerBytes int64, startIndex, endIndex int, opts FFTOptions) (*FFTResult, error) {
+	if opts.Overlap < 0 || opts.Overlap >= 1 {
+		return nil, fmt.Errorf("overlap must be in [0, 1), got %v", opts.Overlap)
+	}
+	if opts.MinFreq < 0 || opts.MaxFreq < 0 || (opts.MaxFreq > 0 && opts.MaxFreq < opts.MinFreq) {
+		return nil, fmt.Errorf("invalid frequency range: %g to %g Hz", opts.MinFreq, opts.MaxFreq)
+	}
+
+	fftSize := FFTSize
+	floor := opts.FloorDb
+	if floor == 0 {
+		floor = MinMagnitude
+	}
+	window, err := windowCoefficients(opts, fftSize)
+	if err != nil {
+		return nil, err
+	}
+	windowSum := 0.0
+	for _, w := range window {
+		windowSum += w
+	}
+	if windowSum == 0 {
+		return nil, fmt.Errorf("window coefficients sum to zero")
+	}
+
+	file, size, err := timeseries.OpenData(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+	if headerBytes < 0 || headerBytes > size {
+		return nil, fmt.Errorf("header size %d is outside the %d-byte file", headerBytes, size)
+	}
+	totalSamples := int((size - headerBytes) / 4) // 4 bytes per float32
+	if totalSamples == 0 {
+		return nil, fmt.Errorf("empty input data")
+	}
+	if startIndex < 0 {
+		startIndex = 0
+	}
+	if endIndex <= 0 || endIndex > totalSamples {
+		endIndex = totalSamples
+	}
+	if startIndex >= endIndex {
+		return nil, fmt.Errorf("invalid index range: start=%d, end=%d", startIndex, endIndex)
+	}
+	if _, err := file.Seek(headerBytes+int64(startIndex)*4, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("error seeking to start: %v", err)
+	}
+
+	hop := int(float64(fftSize) * (1 - opts.Overlap))
+	if hop < 1 {
+		hop = 1
+	}
+
+	fft := fourier.NewFFT(fftSize)
+	reader := bufio.NewReader(io.LimitReader(file, int64(endIndex-startIndex)*4))
+	block := make([]float64, fftSize)
+	input := make([]float64, fftSize)
+	power := make([]float64, fftSize/2+1)
+	coeffSum := make([]complex128, fftSize/2+1)
+	var coeffs []complex128
+
+	// readSamples fills dst from the file in physical units
+	unitScale, unitOffset := opts.units()
+	var raw [4]byte
+	readSamples := func(dst []float64) (int, error) {
+		for i := range dst {
+			if _, err := io.ReadFull(reader, raw[:]); err != nil {
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					return i, nil
+				}
+				return i, err
+			}
+			dst[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(raw[:])))*unitScale + unitOffset
+		}
+		return len(dst), nil
+	}
+
+	filled, err := readSamples(block)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	blocks := 0
+	energy := 0.0
+	for {
+		// Centre each block and apply the window
+		mean := 0.0
+		for _, v := range block[:filled] {
+			mean += v
+		}
+		mean /= float64(filled)
+		for i := range input {
+			input[i] = 0
+			if i < filled {
+				input[i] = (block[i] - mean) * window[i]
+			}
+			energy += input[i] * input[i]
+		}
+
+		coeffs = fft.Coefficients(coeffs, input)
+		for k := range power {
+			power[k] += real(coeffs[k])*real(coeffs[k]) + imag(coeffs[k])*imag(coeffs[k])
+			coeffSum[k] += coeffs[k]
+		}
+		blocks++
+
+		// Slide by one hop; a partial trailing block is dropped
+		if filled < fftSize {
+			break
+		}
+		copy(block, block[hop:])
+		n, err := readSamples(block[fftSize-hop:])
+		if err != nil {
+			return nil, fmt.Errorf("error reading file: %v", err)
+		}
+		if n < hop {
+			break
+		}
+	}
+
+	amplitudes := make([]float64, len(power))
+	for k := range power {
+		amplitudes[k] = math.Sqrt(power[k] / float64(blocks))
+		coeffSum[k] /= complex(float64(blocks), 0)
+	}
+
+	return spectrumResult(fft, coeffSum, amplitudes, sampleRate, windowSum, energy/float64(blocks),
+		floor, opts), nil
+}
@@ -1,12 +1,16 @@
 package fir
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"math"
+	"novacal/logging"
+	"novacal/timeseries"
 	"os"
 	"path/filepath"
+	"sort"
 )
 
 // ProcessFIRResult holds all return values from ProcessFIR
@@ -14,7 +18,15 @@ type ProcessFIRResult struct {
 	FIRCoefficients []float64
 	FilteredSignal  []float64
 	StackedWaveform []float64
-	PerfectSquare   []float64
+	PerfectSquare   []float64 // Ideal target cycle, a square wave unless another TargetWaveform is set
+	Stabilization   float64   // Stabilization value used, chosen by the sweep in auto mode
+	StackFrequency  float64   // Hz, the cycle rate stacked at, refined from the data when RefinePeriod is set
+	// Frequency response of the FIR filter
+	ResponseFrequencies []float64
+	ResponseMagnitude   []float64 // dB
+	ResponsePhase       []float64 // radians
+	// Paths of the stacked and target waveform CSVs when SaveIntermediates is set
+	IntermediateFiles []string
 }
 
 // FIRConfig holds the configuration for FIR filter generation
@@ -24,80 +36,460 @@ type FIRConfig struct {
 	SampleRate    float64 `json:"sampleRate"`
 	BaseFrequency float64 `json:"baseFrequency"`
 	Stabilization float64 `json:"stabilization"`
+	// Cycle selection
+	CyclesToRead   int  `json:"cyclesToRead"`   // Cycles to read from the file (0 = default)
+	ReadFullFile   bool `json:"readFullFile"`   // Read the entire file instead of CyclesToRead
+	MaxCycles      int  `json:"maxCycles"`      // Maximum cycles to stack (0 = default)
+	SettlingCycles int  `json:"settlingCycles"` // Cycles to skip at the start of the file
+	// Sample encoding, "float32" (default, same as the plot view) or "float64"
+	DataType string `json:"dataType"`
+	// Bytes of instrument header skipped before the first sample
+	HeaderBytes int64 `json:"headerBytes"`
+	// Measure the cycle period from the data before stacking, "" (default)
+	// to trust BaseFrequency, "zerocrossing" or "autocorrelation"
+	RefinePeriod string `json:"refinePeriod"`
+	// Ideal response to fit, "square" (default), "sine" or "triangle"
+	TargetWaveform string `json:"targetWaveform"`
+	// Regularization scheme, "diagmean" (default) or "identity"
+	Regularization string `json:"regularization"`
+	// Sweep candidate stabilization values and keep the best one
+	AutoStabilization bool `json:"autoStabilization"`
+	// Write the stacked and target waveforms to the results directory
+	SaveIntermediates bool `json:"saveIntermediates"`
+	// Significant digits of the intermediate CSVs, 0 for 6 and negative for
+	// full precision
+	Precision int `json:"precision"`
+	// Results directory, fir_results next to the input file by default
+	OutputDir string `json:"outputDir"`
+}
+
+// Candidate values tried when AutoStabilization is set
+var stabilizationCandidates = []float64{1e-4, 1e-3, 1e-2, 1e-1, 1}
+
+const (
+	defaultCyclesToRead   = 10
+	defaultMaxCycles      = 5
+	frequencyResponseSize = 512  // Points in the returned frequency response
+	minResponseDb         = -200 // Floor for zero magnitude in the response
+)
+
+// Accepted range for the Stabilization parameter
+const (
+	minStabilization = 0.0
+	maxStabilization = 10.0
+)
+
+// Validate checks the configuration before any processing so callers get
+// actionable errors instead of NaN coefficients
+func (c FIRConfig) Validate() error {
+	if c.FilePath == "" {
+		return fmt.Errorf("no input file specified")
+	}
+	info, err := os.Stat(c.FilePath)
+	if err != nil {
+		return fmt.Errorf("input file %s is not accessible: %v", c.FilePath, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("input path %s is a directory, not a file", c.FilePath)
+	}
+	// Compressed sizes say nothing about the header, which is checked on read
+	if c.HeaderBytes < 0 || (c.HeaderBytes > info.Size() && !timeseries.IsCompressed(c.FilePath)) {
+		return fmt.Errorf("header size %d is outside the %d-byte file", c.HeaderBytes, info.Size())
+	}
+	if c.SampleRate <= 0 {
+		return fmt.Errorf("sample rate must be positive, got %v", c.SampleRate)
+	}
+	if c.BaseFrequency <= 0 {
+		return fmt.Errorf("base frequency must be positive, got %v", c.BaseFrequency)
+	}
+	if c.BaseFrequency >= c.SampleRate/2 {
+		return fmt.Errorf("base frequency %v Hz must be below the Nyquist frequency %v Hz",
+			c.BaseFrequency, c.SampleRate/2)
+	}
+	if !c.AutoStabilization && (c.Stabilization < minStabilization || c.Stabilization > maxStabilization) {
+		return fmt.Errorf("stabilization must be between %v and %v, got %v",
+			minStabilization, maxStabilization, c.Stabilization)
+	}
+	if c.CyclesToRead < 0 || c.MaxCycles < 0 {
+		return fmt.Errorf("cycle counts cannot be negative")
+	}
+	if c.SettlingCycles < 0 {
+		return fmt.Errorf("settling cycles cannot be negative: %d", c.SettlingCycles)
+	}
+	switch c.RefinePeriod {
+	case "", "zerocrossing", "autocorrelation":
+	default:
+		return fmt.Errorf("unknown period refinement: %s", c.RefinePeriod)
+	}
+	if _, err := elementSize(c.DataType); err != nil {
+		return err
+	}
+	return nil
 }
 
 // ProcessFIR processes the FIR filter on binary data
 func ProcessFIR(config FIRConfig, progressCallback func(int)) (*ProcessFIRResult, error) {
-	// Read and parse binary data - only read first few cycles worth of data
+	return ProcessFIRContext(context.Background(), config, progressCallback)
+}
+
+// ProcessFIRContext processes the FIR filter like ProcessFIR, giving up
+// between processing stages once ctx is done
+func ProcessFIRContext(ctx context.Context, config FIRConfig, progressCallback func(int)) (*ProcessFIRResult, error) {
+	// stage reports progress and stops the run if ctx has ended meanwhile
+	stage := func(progress int) error {
+		progressCallback(progress)
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("FIR processing stopped at %d%%: %v", progress, err)
+		}
+		return nil
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid FIR configuration: %v", err)
+	}
+
+	// Read and parse binary data - by default only read the first few cycles
 	samplesPerCycle := int(config.SampleRate / config.BaseFrequency)
-	samplesToRead := samplesPerCycle * 10 // Read 10 cycles worth of data
+	samplesToRead := 0 // 0 reads the whole file
+	if !config.ReadFullFile {
+		samplesToRead = samplesPerCycle * config.CyclesRequired()
+	}
 
-	data, err := readPartialBinaryFile(config.FilePath, samplesToRead)
+	data, err := readPartialBinaryFile(config.FilePath, samplesToRead, config.DataType, config.HeaderBytes)
 	if err != nil {
 		return nil, err
 	}
-	progressCallback(20)
+	if settlingSamples := config.SettlingCycles * samplesPerCycle; settlingSamples >= len(data) {
+		return nil, fmt.Errorf("settling region (%d samples) exceeds available data (%d samples)",
+			settlingSamples, len(data))
+	}
+	if err := stage(20); err != nil {
+		return nil, err
+	}
+
+	maxCycles := config.MaxCycles
+	if maxCycles <= 0 {
+		maxCycles = defaultMaxCycles
+	}
 
 	// Process signals with progress updates
 	nSamples := 2048
-	stackedCoil := stackAndResample(data, config.SampleRate, config.BaseFrequency, nSamples)
-	progressCallback(40)
+	stackFrequency := config.BaseFrequency
+	if config.RefinePeriod != "" {
+		stackFrequency = refineFrequency(data[config.SettlingCycles*samplesPerCycle:], config.SampleRate,
+			config.BaseFrequency, config.RefinePeriod)
+	}
+	stackedCoil := stackAndResample(data, config.SampleRate, stackFrequency, nSamples,
+		maxCycles, config.SettlingCycles)
+	if err := stage(40); err != nil {
+		return nil, err
+	}
 
-	perfectSquare := generatePerfectSquareWave(stackedCoil)
-	progressCallback(60)
+	perfectSquare, err := generateTargetWaveform(stackedCoil, config.TargetWaveform)
+	if err != nil {
+		return nil, err
+	}
+	if err := stage(60); err != nil {
+		return nil, err
+	}
 
 	// Calculate FIR coefficients and apply filter
-	firCoefficients := regularizedLeastSquares(stackedCoil, perfectSquare, config.Stabilization)
-	progressCallback(80)
+	var firCoefficients []float64
+	stabilization := config.Stabilization
+	if config.AutoStabilization {
+		firCoefficients, stabilization, err = autoRegularizedLeastSquares(stackedCoil, perfectSquare, config.Regularization)
+	} else {
+		firCoefficients, err = regularizedLeastSquares(stackedCoil, perfectSquare, stabilization, config.Regularization)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := stage(80); err != nil {
+		return nil, err
+	}
 
 	filteredSignal := applyFIRFilter(stackedCoil, firCoefficients)
+	responseFreqs, responseMag, responsePhase := FrequencyResponse(firCoefficients, config.SampleRate, frequencyResponseSize)
 	progressCallback(100)
 
 	// Create results directory
-	resultsDir := filepath.Join(filepath.Dir(config.FilePath), "fir_results")
+	resultsDir := config.ResultsDir()
 	if err := os.MkdirAll(resultsDir, 0755); err != nil {
 		return nil, fmt.Errorf("error creating results directory: %v", err)
 	}
+	if err := checkWritable(resultsDir); err != nil {
+		return nil, fmt.Errorf("results directory %s is not writable: %v", resultsDir, err)
+	}
+
+	var intermediateFiles []string
+	if config.SaveIntermediates {
+		stackedPath := filepath.Join(resultsDir, fmt.Sprintf("stacked_%s.csv", config.CoilName))
+		perfectPath := filepath.Join(resultsDir, fmt.Sprintf("perfect_%s.csv", config.CoilName))
+		if err := ExportWaveformCSV(stackedPath, stackedCoil, config.Precision); err != nil {
+			return nil, fmt.Errorf("error saving stacked waveform: %v", err)
+		}
+		if err := ExportWaveformCSV(perfectPath, perfectSquare, config.Precision); err != nil {
+			return nil, fmt.Errorf("error saving target waveform: %v", err)
+		}
+		intermediateFiles = []string{stackedPath, perfectPath}
+	}
 
 	return &ProcessFIRResult{
 		FIRCoefficients: firCoefficients,
 		FilteredSignal:  filteredSignal,
 		StackedWaveform: stackedCoil,
 		PerfectSquare:   perfectSquare,
+		Stabilization:   stabilization,
+		StackFrequency:  stackFrequency,
+
+		ResponseFrequencies: responseFreqs,
+		ResponseMagnitude:   responseMag,
+		ResponsePhase:       responsePhase,
+		IntermediateFiles:   intermediateFiles,
 	}, nil
 }
 
-// Add this new function to read only part of the file
-func readPartialBinaryFile(filePath string, numSamples int) ([]float64, error) {
-	file, err := os.Open(filePath)
+// CyclesRequired returns the minimum number of base-frequency cycles the
+// input file must hold, including the settling region
+func (c FIRConfig) CyclesRequired() int {
+	if c.ReadFullFile {
+		return c.SettlingCycles + 1
+	}
+	cyclesToRead := c.CyclesToRead
+	if cyclesToRead <= 0 {
+		cyclesToRead = defaultCyclesToRead
+	}
+	// Read the settling region on top of the cycles we want to keep
+	return cyclesToRead + c.SettlingCycles
+}
+
+// SampleSize returns the number of bytes per sample for the configured data type
+func (c FIRConfig) SampleSize() (int, error) {
+	return elementSize(c.DataType)
+}
+
+// ResultsDir returns the directory FIR results are written to
+func (c FIRConfig) ResultsDir() string {
+	if c.OutputDir != "" {
+		return c.OutputDir
+	}
+	return filepath.Join(filepath.Dir(c.FilePath), "fir_results")
+}
+
+// checkWritable creates and removes a probe file, since directory permission
+// bits do not reflect read-only mounts
+func checkWritable(dir string) error {
+	probe, err := os.CreateTemp(dir, ".novacal-write-test-*")
+	if err != nil {
+		return err
+	}
+	name := probe.Name()
+	probe.Close()
+	return os.Remove(name)
+}
+
+// FrequencyResponse evaluates the DTFT of the FIR coefficients at nPoints
+// frequencies from DC to Nyquist, returning the frequencies, magnitude (dB)
+// and phase (radians)
+func FrequencyResponse(coeffs []float64, sampleRate float64, nPoints int) ([]float64, []float64, []float64) {
+	if nPoints < 2 || len(coeffs) == 0 {
+		return []float64{}, []float64{}, []float64{}
+	}
+
+	frequencies := make([]float64, nPoints)
+	magnitudes := make([]float64, nPoints)
+	phases := make([]float64, nPoints)
+
+	for k := 0; k < nPoints; k++ {
+		freq := float64(k) * (sampleRate / 2) / float64(nPoints-1)
+		omega := 2 * math.Pi * freq / sampleRate
+
+		var re, im float64
+		for n, c := range coeffs {
+			re += c * math.Cos(omega*float64(n))
+			im -= c * math.Sin(omega*float64(n))
+		}
+
+		frequencies[k] = freq
+		if mag := math.Hypot(re, im); mag > 0 {
+			magnitudes[k] = 20 * math.Log10(mag)
+		} else {
+			magnitudes[k] = minResponseDb
+		}
+		phases[k] = math.Atan2(im, re)
+	}
+
+	return frequencies, magnitudes, phases
+}
+
+// elementSize returns the number of bytes per sample for a data type
+func elementSize(dataType string) (int, error) {
+	switch dataType {
+	case "", "float32":
+		return 4, nil
+	case "float64":
+		return 8, nil
+	default:
+		return 0, fmt.Errorf("unsupported data type: %s", dataType)
+	}
+}
+
+// readPartialBinaryFile reads the first numSamples samples following a
+// headerBytes header, or every sample when numSamples <= 0
+func readPartialBinaryFile(filePath string, numSamples int, dataType string, headerBytes int64) ([]float64, error) {
+	size, err := elementSize(dataType)
+	if err != nil {
+		return nil, err
+	}
+
+	file, fileSize, err := timeseries.OpenData(filePath)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	// Read only the bytes we need (4 bytes per float32)
-	bytesToRead := numSamples * 4
-	buffer := make([]byte, bytesToRead)
+	if headerBytes < 0 || headerBytes > fileSize {
+		return nil, fmt.Errorf("header size %d is outside the %d-byte file", headerBytes, fileSize)
+	}
+	dataBytes := fileSize - headerBytes
+	if dataBytes%int64(size) != 0 {
+		return nil, fmt.Errorf("file size %d is not a multiple of %d bytes, check the data type",
+			dataBytes, size)
+	}
+	totalSamples := int(dataBytes) / size
+	if numSamples <= 0 {
+		numSamples = totalSamples
+	} else if numSamples > totalSamples {
+		return nil, fmt.Errorf("requested %d samples but file only contains %d %s samples",
+			numSamples, totalSamples, dataTypeName(dataType))
+	}
 
-	n, err := file.Read(buffer)
-	if err != nil && err != io.EOF {
+	// Read only the bytes we need
+	if _, err := file.Seek(headerBytes, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, numSamples*size)
+	if _, err := io.ReadFull(file, buffer); err != nil {
 		return nil, err
 	}
 
 	// Convert bytes to float64
-	samples := n / 4
-	data := make([]float64, samples)
-	for i := 0; i < samples; i++ {
-		bits := binary.LittleEndian.Uint32(buffer[i*4 : (i+1)*4])
-		data[i] = float64(math.Float32frombits(bits))
+	data := make([]float64, numSamples)
+	for i := 0; i < numSamples; i++ {
+		if size == 8 {
+			bits := binary.LittleEndian.Uint64(buffer[i*8 : (i+1)*8])
+			data[i] = math.Float64frombits(bits)
+		} else {
+			bits := binary.LittleEndian.Uint32(buffer[i*4 : (i+1)*4])
+			data[i] = float64(math.Float32frombits(bits))
+		}
+
+		// Decoding with the wrong type typically yields NaN or Inf values
+		if math.IsNaN(data[i]) || math.IsInf(data[i], 0) {
+			return nil, fmt.Errorf("invalid sample at index %d when decoding as %s, check the data type",
+				i, dataTypeName(dataType))
+		}
 	}
 
 	return data, nil
 }
 
-func stackAndResample(data []float64, sampleRate, waveFrequency float64, nSamples int) []float64 {
+// dataTypeName returns the display name of a data type
+func dataTypeName(dataType string) string {
+	if dataType == "" {
+		return "float32"
+	}
+	return dataType
+}
+
+// Largest relative correction refineFrequency applies to the stated base
+// frequency; a bigger one means the measurement locked onto something else
+const maxFrequencyCorrection = 0.2
+
+// refineFrequency measures the cycle rate of data, which starts after the
+// settling region, by the given method ("zerocrossing" or
+// "autocorrelation"). It falls back to the stated frequency when the data
+// yields no period within maxFrequencyCorrection of it.
+func refineFrequency(data []float64, sampleRate, stated float64, method string) float64 {
+	statedPeriod := sampleRate / stated
+	var period float64
+	switch method {
+	case "zerocrossing":
+		period = crossingPeriod(data, statedPeriod)
+	case "autocorrelation":
+		period = correlationPeriod(data, statedPeriod)
+	}
+	if period <= 0 || math.Abs(period-statedPeriod) > maxFrequencyCorrection*statedPeriod {
+		logging.Warnf("Could not refine the %v Hz base frequency by %s, stacking at the stated frequency",
+			stated, method)
+		return stated
+	}
+	refined := sampleRate / period
+	logging.Infof("Refined base frequency from %v Hz to %.6g Hz by %s", stated, refined, method)
+	return refined
+}
+
+// crossingPeriod returns the median spacing in samples between successive
+// rising crossings of the mean, located to a fraction of a sample. Crossings
+// closer than half the stated period are noise on the previous one and are
+// skipped.
+func crossingPeriod(data []float64, statedPeriod float64) float64 {
+	mean := calculateMean(data)
+	var crossings []float64
+	for i := 0; i < len(data)-1; i++ {
+		if data[i] >= mean || data[i+1] < mean {
+			continue
+		}
+		at := float64(i) + (mean-data[i])/(data[i+1]-data[i])
+		if len(crossings) > 0 && at-crossings[len(crossings)-1] < statedPeriod/2 {
+			continue
+		}
+		crossings = append(crossings, at)
+	}
+	if len(crossings) < 2 {
+		return 0
+	}
+	spacings := make([]float64, len(crossings)-1)
+	for i := range spacings {
+		spacings[i] = crossings[i+1] - crossings[i]
+	}
+	sort.Float64s(spacings)
+	mid := len(spacings) / 2
+	if len(spacings)%2 == 0 {
+		return (spacings[mid-1] + spacings[mid]) / 2
+	}
+	return spacings[mid]
+}
+
+// correlationPeriod returns the autocorrelation period of data in samples,
+// looking no further than one and a half stated periods and refined to a
+// fraction of a sample with a parabola through the peak
+func correlationPeriod(data []float64, statedPeriod float64) float64 {
+	correlation, lag := timeseries.AutoCorrelate(data, int(1.5*statedPeriod)+1)
+	if lag <= 0 || lag >= len(correlation)-1 {
+		return float64(lag)
+	}
+	// Undo the overlap bias as AutoCorrelate does when picking the lag
+	n := float64(len(data))
+	unbiased := func(l int) float64 { return correlation[l] * n / (n - float64(l)) }
+	left, centre, right := unbiased(lag-1), unbiased(lag), unbiased(lag+1)
+	if curve := left - 2*centre + right; curve < 0 {
+		return float64(lag) + 0.5*(left-right)/curve
+	}
+	return float64(lag)
+}
+
+// stackAndResample averages up to maxCycles cycles found anywhere in data,
+// after skipping settlingCycles cycles at the start, and resamples the
+// average to nSamples points
+func stackAndResample(data []float64, sampleRate, waveFrequency float64, nSamples, maxCycles, settlingCycles int) []float64 {
 	samplesPerCycle := int(sampleRate / waveFrequency)
 
+	// Skip the settling region before looking for cycles
+	if skip := settlingCycles * samplesPerCycle; skip > 0 && skip < len(data) {
+		data = data[skip:]
+	}
+
 	// Add safety check for data length
 	if len(data) < samplesPerCycle*2 {
 		// If we don't have enough data for 2 cycles, return what we have resampled
@@ -107,9 +499,8 @@ func stackAndResample(data []float64, sampleRate, waveFrequency float64, nSample
 	// Find mean for zero crossings
 	mean := calculateMean(data)
 
-	// Only look for zero crossings in first few cycles
-	searchLength := min(len(data), samplesPerCycle*4)
-	zeroCrossings := findZeroCrossings(data[:searchLength], mean)
+	// Look for zero crossings across all available data
+	zeroCrossings := findZeroCrossings(data, mean)
 
 	// If we can't find zero crossings, just use fixed intervals
 	if len(zeroCrossings) < 2 {
@@ -120,14 +511,21 @@ func stackAndResample(data []float64, sampleRate, waveFrequency float64, nSample
 		return resample(data, nSamples)
 	}
 
-	// Stack a maximum of 5 cycles
-	maxCycles := 5
+	// Stack up to maxCycles cycles that start on a crossing in the same
+	// direction as the first one and don't overlap the previous cycle
 	var stackedCycles [][]float64
+	rising := data[zeroCrossings[0]] < mean
+	nextStart := 0
 
-	for i := 0; i < len(zeroCrossings)-1 && len(stackedCycles) < maxCycles; i += 2 {
-		start := zeroCrossings[i]
-		end := start + samplesPerCycle
+	for _, start := range zeroCrossings {
+		if len(stackedCycles) >= maxCycles {
+			break
+		}
+		if start < nextStart || (data[start] < mean) != rising {
+			continue
+		}
 
+		end := start + samplesPerCycle
 		if end > len(data) {
 			break
 		}
@@ -135,6 +533,7 @@ func stackAndResample(data []float64, sampleRate, waveFrequency float64, nSample
 		cycle := make([]float64, samplesPerCycle)
 		copy(cycle, data[start:end])
 		stackedCycles = append(stackedCycles, cycle)
+		nextStart = start + samplesPerCycle/2
 	}
 
 	// If we couldn't stack any cycles, return resampled input
@@ -159,6 +558,67 @@ func stackAndResample(data []float64, sampleRate, waveFrequency float64, nSample
 	return resample(avgCycle, nSamples)
 }
 
+// generateTargetWaveform builds the ideal cycle the FIR filter should map the
+// stacked signal onto
+func generateTargetWaveform(signal []float64, waveform string) ([]float64, error) {
+	switch waveform {
+	case "", "square":
+		return generatePerfectSquareWave(signal), nil
+	case "sine":
+		return generatePerfectSineWave(signal), nil
+	case "triangle":
+		return generatePerfectTriangleWave(signal), nil
+	default:
+		return nil, fmt.Errorf("unknown target waveform: %s", waveform)
+	}
+}
+
+// fundamentalComponent returns the mean, amplitude and phase of the
+// fundamental of a signal holding exactly one cycle, so that
+// signal[i] ~ mean + amplitude*sin(2*pi*i/n + phase)
+func fundamentalComponent(signal []float64) (float64, float64, float64) {
+	n := len(signal)
+	mean := calculateMean(signal)
+
+	var sinSum, cosSum float64
+	for i, v := range signal {
+		theta := 2 * math.Pi * float64(i) / float64(n)
+		sinSum += (v - mean) * math.Sin(theta)
+		cosSum += (v - mean) * math.Cos(theta)
+	}
+	sinSum *= 2 / float64(n)
+	cosSum *= 2 / float64(n)
+
+	return mean, math.Hypot(sinSum, cosSum), math.Atan2(cosSum, sinSum)
+}
+
+func generatePerfectSineWave(signal []float64) []float64 {
+	n := len(signal)
+	mean, amplitude, phase := fundamentalComponent(signal)
+
+	result := make([]float64, n)
+	for i := range result {
+		theta := 2*math.Pi*float64(i)/float64(n) + phase
+		result[i] = mean + amplitude*math.Sin(theta)
+	}
+	return result
+}
+
+func generatePerfectTriangleWave(signal []float64) []float64 {
+	n := len(signal)
+	mean, amplitude, phase := fundamentalComponent(signal)
+
+	// A triangle wave of peak P has a fundamental of amplitude 8P/pi^2
+	peak := amplitude * math.Pi * math.Pi / 8
+
+	result := make([]float64, n)
+	for i := range result {
+		theta := 2*math.Pi*float64(i)/float64(n) + phase
+		result[i] = mean + peak*(2/math.Pi)*math.Asin(math.Sin(theta))
+	}
+	return result
+}
+
 func generatePerfectSquareWave(signal []float64) []float64 {
 	n := len(signal)
 	mean := calculateMean(signal)
@@ -205,7 +665,54 @@ func generatePerfectSquareWave(signal []float64) []float64 {
 	return result
 }
 
-func regularizedLeastSquares(imperfect, perfect []float64, regParam float64) []float64 {
+func regularizedLeastSquares(imperfect, perfect []float64, regParam float64, scheme string) ([]float64, error) {
+	ATA, ATb := normalEquations(imperfect, perfect)
+	return solveRegularized(ATA, ATb, regParam, scheme)
+}
+
+// autoRegularizedLeastSquares solves the system for each stabilization
+// candidate and keeps the one minimizing log residual norm plus log solution
+// norm, a simple approximation of the L-curve corner
+func autoRegularizedLeastSquares(imperfect, perfect []float64, scheme string) ([]float64, float64, error) {
+	ATA, ATb := normalEquations(imperfect, perfect)
+
+	var bestCoeffs []float64
+	bestParam := 0.0
+	bestScore := math.Inf(1)
+	var lastErr error
+
+	for _, regParam := range stabilizationCandidates {
+		coeffs, err := solveRegularized(copyMatrix(ATA), append([]float64(nil), ATb...), regParam, scheme)
+		if err != nil {
+			// Too little regularization can leave the system singular
+			lastErr = err
+			continue
+		}
+
+		filtered := applyFIRFilter(imperfect, coeffs)
+		residual := 0.0
+		for i := range filtered {
+			diff := filtered[i] - perfect[i]
+			residual += diff * diff
+		}
+		solutionNorm := dotProduct(coeffs, coeffs)
+
+		score := math.Log(residual) + math.Log(solutionNorm)
+		if score < bestScore {
+			bestScore = score
+			bestParam = regParam
+			bestCoeffs = coeffs
+		}
+	}
+
+	if bestCoeffs == nil {
+		return nil, 0, fmt.Errorf("no stabilization candidate produced a valid solution: %v", lastErr)
+	}
+	return bestCoeffs, bestParam, nil
+}
+
+// normalEquations builds A^T*A and A^T*b for the circulant matrix of imperfect
+func normalEquations(imperfect, perfect []float64) ([][]float64, []float64) {
 	n := len(imperfect)
 
 	// Create Toeplitz matrix
@@ -215,24 +722,45 @@ func regularizedLeastSquares(imperfect, perfect []float64, regParam float64) []f
 	}
 
 	// Compute A^T * A and A^T * b
-	ATA := matrixMultiply(transposeMatrix(A), A)
-	ATb := matrixVectorMultiply(transposeMatrix(A), perfect)
+	AT := transposeMatrix(A)
+	return matrixMultiply(AT, A), matrixVectorMultiply(AT, perfect)
+}
 
-	// Add regularization
-	diagMean := 0.0
-	for i := 0; i < n; i++ {
-		diagMean += ATA[i][i]
+// solveRegularized adds the regularization term to the diagonal of ATA and
+// solves the system. ATA and ATb are modified in place.
+func solveRegularized(ATA [][]float64, ATb []float64, regParam float64, scheme string) ([]float64, error) {
+	n := len(ATA)
+
+	// Scale the ridge according to the selected scheme
+	var scale float64
+	switch scheme {
+	case "", "diagmean":
+		for i := 0; i < n; i++ {
+			scale += ATA[i][i]
+		}
+		scale /= float64(n)
+	case "identity":
+		scale = 1
+	default:
+		return nil, fmt.Errorf("unknown regularization scheme: %s", scheme)
 	}
-	diagMean /= float64(n)
 
 	for i := 0; i < n; i++ {
-		ATA[i][i] += diagMean * regParam
+		ATA[i][i] += scale * regParam
 	}
 
 	// Solve system using Gaussian elimination
 	return solveLinearSystem(ATA, ATb)
 }
 
+func copyMatrix(m [][]float64) [][]float64 {
+	result := make([][]float64, len(m))
+	for i := range m {
+		result[i] = append([]float64(nil), m[i]...)
+	}
+	return result
+}
+
 func applyFIRFilter(signal, coeffs []float64) []float64 {
 	N := len(signal)
 	filtered := make([]float64, N)
@@ -344,12 +872,37 @@ func matrixVectorMultiply(m [][]float64, v []float64) []float64 {
 	return result
 }
 
-func solveLinearSystem(A [][]float64, b []float64) []float64 {
+// solveLinearSystem solves A*x = b by Gaussian elimination with partial
+// pivoting. A and b are modified in place. An error is returned when the
+// matrix is singular or too ill-conditioned to solve reliably.
+func solveLinearSystem(A [][]float64, b []float64) ([]float64, error) {
 	n := len(A)
 	x := make([]float64, n)
 
+	// Pivots smaller than this relative to the largest entry are treated as zero
+	maxAbs := 0.0
+	for i := range A {
+		for _, v := range A[i] {
+			maxAbs = math.Max(maxAbs, math.Abs(v))
+		}
+	}
+	tolerance := maxAbs * float64(n) * 1e-15
+
 	// Forward elimination
 	for i := 0; i < n; i++ {
+		// Swap in the row with the largest pivot
+		pivotRow := i
+		for k := i + 1; k < n; k++ {
+			if math.Abs(A[k][i]) > math.Abs(A[pivotRow][i]) {
+				pivotRow = k
+			}
+		}
+		if math.Abs(A[pivotRow][i]) <= tolerance || math.IsNaN(A[pivotRow][i]) {
+			return nil, fmt.Errorf("linear system is singular at column %d, try a larger stabilization value", i)
+		}
+		A[i], A[pivotRow] = A[pivotRow], A[i]
+		b[i], b[pivotRow] = b[pivotRow], b[i]
+
 		pivot := A[i][i]
 		for j := i; j < n; j++ {
 			A[i][j] /= pivot
@@ -373,7 +926,7 @@ func solveLinearSystem(A [][]float64, b []float64) []float64 {
 		}
 	}
 
-	return x
+	return x, nil
 }
 
 // Add helper function
@@ -0,0 +1,184 @@
+package fir
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"novacal/timeseries"
+	"os"
+)
+
+// ApplyOptions holds optional settings for ApplyFIRToFileWithOptions
+type ApplyOptions struct {
+	Boundary         string    // Samples assumed past the end of the file, "zero" (default) or "reflect"
+	DataType         string    // Sample encoding of input and output, "float32" (default) or "float64"
+	HeaderBytes      int64     // Input header skipped before the first sample; the output has none
+	ProgressCallback func(int) // Optional progress updates from 0 to 100
+	// Optional, called before each chunk is read; an error stops filtering
+	Checkpoint func() error
+}
+
+// Number of samples read from the input per iteration
+const applyChunkSize = 65536
+
+// ApplyFIRToFile filters a whole recording with coeffs and writes the result
+// to outputPath, zero-padding past the end of the file
+func ApplyFIRToFile(inputPath, outputPath string, coeffs []float64) error {
+	return ApplyFIRToFileWithOptions(inputPath, outputPath, coeffs, ApplyOptions{})
+}
+
+// ApplyFIRToFileWithOptions filters a recording in a streaming fashion so
+// memory use is bounded by the chunk and filter sizes. The filter follows the
+// same convention as the one used to design the coefficients:
+// y[n] = sum_k coeffs[k] * x[n+k]
+func ApplyFIRToFileWithOptions(inputPath, outputPath string, coeffs []float64, opts ApplyOptions) error {
+	if len(coeffs) == 0 {
+		return fmt.Errorf("no FIR coefficients provided")
+	}
+	if opts.Boundary != "" && opts.Boundary != "zero" && opts.Boundary != "reflect" {
+		return fmt.Errorf("unknown boundary mode: %s", opts.Boundary)
+	}
+	size, err := elementSize(opts.DataType)
+	if err != nil {
+		return err
+	}
+	progress := opts.ProgressCallback
+	if progress == nil {
+		progress = func(int) {}
+	}
+
+	in, inputSize, err := timeseries.OpenData(inputPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if opts.HeaderBytes < 0 || opts.HeaderBytes > inputSize {
+		return fmt.Errorf("header size %d is outside the %d-byte file", opts.HeaderBytes, inputSize)
+	}
+	dataBytes := inputSize - opts.HeaderBytes
+	if dataBytes%int64(size) != 0 {
+		return fmt.Errorf("file size %d is not a multiple of %d bytes, check the data type", dataBytes, size)
+	}
+	totalSamples := dataBytes / int64(size)
+	if _, err := in.Seek(opts.HeaderBytes, io.SeekStart); err != nil {
+		return err
+	}
+
+	// Truncating the output must not destroy the input still being read
+	if inputInfo, err := os.Stat(inputPath); err == nil {
+		if outputInfo, err := os.Stat(outputPath); err == nil && os.SameFile(inputInfo, outputInfo) {
+			return fmt.Errorf("output %s is the input file", outputPath)
+		}
+	}
+
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	reader := bufio.NewReader(in)
+	writer := bufio.NewWriter(out)
+	taps := len(coeffs)
+	buffer := make([]byte, applyChunkSize*size)
+	var pending []float64
+	// Input sample just before pending, so reflection still sees taps samples
+	// when the file ends exactly on a chunk boundary
+	var previous []float64
+	var processed int64
+
+	for {
+		if opts.Checkpoint != nil {
+			if err := opts.Checkpoint(); err != nil {
+				return err
+			}
+		}
+
+		n, readErr := io.ReadFull(reader, buffer)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return readErr
+		}
+		pending = append(pending, decodeSamples(buffer[:n-n%size], size)...)
+
+		// Extend past the end of the file once all samples have been read
+		atEnd := readErr != nil
+		if atEnd {
+			history := append(append([]float64(nil), previous...), pending...)
+			pending = append(pending, boundarySamples(history, taps-1, opts.Boundary)...)
+		}
+
+		// Every output needs taps samples starting at its own position
+		ready := len(pending) - taps + 1
+		if ready > 0 {
+			for i := 0; i < ready; i++ {
+				if err := writeSample(writer, dotProduct(coeffs, pending[i:i+taps]), size); err != nil {
+					return err
+				}
+			}
+			previous = append(previous[:0], pending[ready-1])
+			pending = append(pending[:0], pending[ready:]...)
+			processed += int64(ready)
+			progress(int(processed * 100 / max64(totalSamples, 1)))
+		}
+
+		if atEnd {
+			break
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	progress(100)
+	return nil
+}
+
+// boundarySamples returns count samples to append after the end of data
+func boundarySamples(data []float64, count int, mode string) []float64 {
+	extra := make([]float64, count)
+	if mode != "reflect" {
+		return extra
+	}
+
+	// Mirror around the last sample without repeating it
+	last := len(data) - 1
+	for j := range extra {
+		if idx := last - (j + 1); idx >= 0 {
+			extra[j] = data[idx]
+		}
+	}
+	return extra
+}
+
+func decodeSamples(buffer []byte, size int) []float64 {
+	samples := make([]float64, len(buffer)/size)
+	for i := range samples {
+		if size == 8 {
+			samples[i] = math.Float64frombits(binary.LittleEndian.Uint64(buffer[i*8:]))
+		} else {
+			samples[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buffer[i*4:])))
+		}
+	}
+	return samples
+}
+
+func writeSample(w io.Writer, value float64, size int) error {
+	var bytes [8]byte
+	if size == 8 {
+		binary.LittleEndian.PutUint64(bytes[:], math.Float64bits(value))
+	} else {
+		binary.LittleEndian.PutUint32(bytes[:], math.Float32bits(float32(value)))
+	}
+	_, err := w.Write(bytes[:size])
+	return err
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,107 @@
+package fir
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"novacal/timeseries"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReflectAtChunkBoundaryUsesFullHistory(t *testing.T) {
+	dir := t.TempDir()
+	input, output := filepath.Join(dir, "in.bin"), filepath.Join(dir, "out.bin")
+	ramp := make([]float64, applyChunkSize)
+	for i := range ramp {
+		ramp[i] = float64(i)
+	}
+	if err := timeseries.WriteBinaryFile(input, ramp); err != nil {
+		t.Fatal(err)
+	}
+
+	// y[n] = x[n+2], so the last output is the second reflected sample
+	if err := ApplyFIRToFileWithOptions(input, output, []float64{0, 0, 1}, ApplyOptions{Boundary: "reflect"}); err != nil {
+		t.Fatal(err)
+	}
+	filtered, err := timeseries.ReadRange(output, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := len(ramp) - 1
+	if got, want := filtered[last], ramp[last-2]; got != want {
+		t.Errorf("last output %v, want the reflected sample %v", got, want)
+	}
+}
+
+func TestApplyRefusesToOverwriteItsInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := timeseries.WriteBinaryFile(path, []float64{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyFIRToFile(path, path, []float64{1}); err == nil {
+		t.Error("filtering a file onto itself was accepted")
+	}
+	if data, err := timeseries.ReadRange(path, 0, 0); err != nil || len(data) != 3 {
+		t.Errorf("input now reads %v (%v), want its 3 samples", data, err)
+	}
+}
+
+func TestApplyStopsAtFailedCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.bin")
+	if err := timeseries.WriteBinaryFile(input, make([]float64, 3*applyChunkSize)); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := errors.New("time limit")
+	calls := 0
+	err := ApplyFIRToFileWithOptions(input, filepath.Join(dir, "out.bin"), []float64{1}, ApplyOptions{
+		Checkpoint: func() error {
+			if calls++; calls == 2 {
+				return stop
+			}
+			return nil
+		},
+	})
+	if err != stop || calls != 2 {
+		t.Errorf("got %v after %d checkpoints, want the checkpoint error after 2", err, calls)
+	}
+}
+
+func TestReadPartialSkipsHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	raw := binary.LittleEndian.AppendUint32(nil, math.Float32bits(1e9))
+	for _, v := range []float32{0.25, -0.5, 0.75} {
+		raw = binary.LittleEndian.AppendUint32(raw, math.Float32bits(v))
+	}
+	if err := os.WriteFile(path, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := readPartialBinaryFile(path, 2, "float32", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2 || data[0] != 0.25 || data[1] != -0.5 {
+		t.Errorf("read %v, want [0.25 -0.5] after the header", data)
+	}
+}
+
+func TestReadPartialRejectsShortFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "short.bin")
+	if err := timeseries.WriteBinaryFile(path, []float64{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readPartialBinaryFile(path, 10, "float32", 0); err == nil {
+		t.Error("reading 10 samples from a 4-sample file succeeded")
+	}
+	// The 16 bytes of float32 samples hold only 2 float64 samples
+	if _, err := readPartialBinaryFile(path, 4, "float64", 0); err == nil {
+		t.Error("float32 file read as 4 float64 samples succeeded")
+	}
+	if data, err := readPartialBinaryFile(path, 4, "float32", 0); err != nil || len(data) != 4 {
+		t.Errorf("read %v (%v), want the 4 samples", data, err)
+	}
+}
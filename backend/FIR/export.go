@@ -0,0 +1,114 @@
+package fir
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// BinaryHeader is written as a JSON sidecar next to binary coefficient files
+type BinaryHeader struct {
+	SampleRate float64 `json:"sampleRate"`
+	CoilName   string  `json:"coilName"`
+	NumTaps    int     `json:"numTaps"`
+	Format     string  `json:"format"`
+}
+
+// ExportCoefficientsBinary writes coeffs to path as packed little-endian
+// float64 values and the header to path + ".json"
+func ExportCoefficientsBinary(path string, coeffs []float64, sampleRate float64, coilName string) error {
+	buffer := make([]byte, len(coeffs)*8)
+	for i, c := range coeffs {
+		binary.LittleEndian.PutUint64(buffer[i*8:], math.Float64bits(c))
+	}
+	if err := os.WriteFile(path, buffer, 0644); err != nil {
+		return err
+	}
+
+	header, err := json.MarshalIndent(BinaryHeader{
+		SampleRate: sampleRate,
+		CoilName:   coilName,
+		NumTaps:    len(coeffs),
+		Format:     "float64le",
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+".json", header, 0644)
+}
+
+// Significant digits written for CSV values when no precision is given
+const defaultCSVPrecision = 6
+
+// ExportWaveformCSV writes one resampled cycle as Index,Value rows with
+// precision significant digits, 0 selecting 6 and a negative precision the
+// shortest exact form
+func ExportWaveformCSV(path string, waveform []float64, precision int) error {
+	if precision == 0 {
+		precision = defaultCSVPrecision
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"Index", "Value"})
+	for i, v := range waveform {
+		writer.Write([]string{strconv.Itoa(i), strconv.FormatFloat(v, 'g', max(precision, -1), 64)})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// LoadCoefficients reads coefficients exported by exportFIR, either a binary
+// file of float64 values or a CSV with Index,Coefficient rows
+func LoadCoefficients(path string) ([]float64, error) {
+	if filepath.Ext(path) == ".bin" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(data)%8 != 0 {
+			return nil, fmt.Errorf("binary coefficient file size %d is not a multiple of 8", len(data))
+		}
+		return decodeSamples(data, 8), nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip the coil name and header lines, keep rows with a numeric coefficient
+	var coeffs []float64
+	for _, record := range records {
+		if len(record) < 2 {
+			continue
+		}
+		if value, err := strconv.ParseFloat(record[1], 64); err == nil {
+			coeffs = append(coeffs, value)
+		}
+	}
+	if len(coeffs) == 0 {
+		return nil, fmt.Errorf("no coefficients found in %s", path)
+	}
+	return coeffs, nil
+}
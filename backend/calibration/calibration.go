@@ -2,10 +2,13 @@ package calibration
 
 import (
 	"fmt"
-	"log"
 	"math"
 	"math/cmplx"
+	fft "novacal/FFT"
+	"novacal/logging"
+	"novacal/timeseries"
 	"os"
+	"runtime"
 	"sort"
 	"sync"
 
@@ -18,24 +21,35 @@ import (
 var (
 	AllFreqs             [][]float64
 	AllTransferFunctions [][]complex128
-	AllCoilData          map[string]*CoilData
 )
 
-// Initialize AllCoilData map
-func init() {
-	AllCoilData = make(map[string]*CoilData)
-}
-
 // Struct definitions
 type CoilData struct {
 	Freqs             [][]float64
 	TransferFunctions [][]complex128
+	Harmonics         []HarmonicResult
 }
 
 type CalibrationResult struct {
 	Frequencies []float64
 	Amplitudes  []float64
 	Phases      []float64
+	Harmonics   []HarmonicResult // Odd harmonics of square wave drives
+	// Amplitudes relative to their value at ReferenceFrequency, in dB, when
+	// normalization was requested
+	NormalizedAmplitudes []float64
+	ReferenceFrequency   float64
+	// Why normalization was skipped for this coil, empty when it succeeded
+	NormalizationWarning string `json:",omitempty"`
+}
+
+// HarmonicResult holds the response at one odd harmonic of a square wave drive
+type HarmonicResult struct {
+	DriveFrequency float64 // Fundamental frequency of the square wave
+	Order          int     // Harmonic number, 1 for the fundamental
+	Frequency      float64 // Frequency of the detected harmonic peak
+	Amplitude      float64 // dB
+	Phase          float64 // Degrees
 }
 
 type PlotlyData struct {
@@ -47,9 +61,11 @@ type PlotlyData struct {
 }
 
 type CalResults struct {
-	Frequencies []float64
-	Amplitudes  []float64
-	Phases      []float64
+	Frequencies          []float64
+	Amplitudes           []float64
+	Phases               []float64
+	NormalizedAmplitudes []float64 // Optional, see CalibrationResult
+	ReferenceFrequency   float64
 }
 
 // Helper type for sorting
@@ -65,12 +81,92 @@ func (s sortedComplexSlice) Swap(i, j int) {
 	s.tf[i], s.tf[j] = s.tf[j], s.tf[i]
 }
 
+// DefaultSampleRate is the sample rate of recordings made with the standard station setup
+const DefaultSampleRate = 51200.0
+
+// SpectralOptions controls how each station's transfer function is
+// estimated and how the coil responses are reported. The zero value takes a
+// single FFT over the whole recording.
+type SpectralOptions struct {
+	// Samples per averaged segment; 0, or a size covering the whole
+	// recording, uses a single segment
+	SegmentSize int
+	Overlap     float64 // Fraction of each segment shared with the next, in [0, 1)
+	// Measure only the drive frequency, or the odd harmonics of square
+	// drives, with the Goertzel algorithm at their exact frequencies
+	// instead of searching a full FFT for peaks
+	Goertzel bool
+	// Odd harmonics of each square drive, the fundamental included, that
+	// Goertzel measures; 0 uses defaultGoertzelHarmonics
+	Harmonics int
+	// Frequency in Hz at which each coil's amplitude curve is set to 0 dB
+	// in NormalizedAmplitudes, 0 to skip normalization
+	NormalizeFrequency float64
+	// Sample rates of individual sine and square stations by coil and drive
+	// frequency, for stations recorded at other than the run's sample rate
+	SineRates, SquareRates map[string]map[float64]float64
+}
+
+// Fraction of the strongest tx component a square wave harmonic must reach to
+// be kept, matching the FFT peak threshold
+const harmonicThreshold = 0.04
+
+// Odd harmonics measured per square drive unless SpectralOptions.Harmonics
+// says otherwise. An ideal square wave's harmonic of order n has 1/n of the
+// fundamental, so orders past 1/harmonicThreshold = 25 would be dropped anyway.
+const defaultGoertzelHarmonics = 13
+
 // Main calibration function
-func RunCalibration(sineFilePaths, squareFilePaths map[string]map[float64]map[string]string, progressCallback func(int)) (map[string]CalibrationResult, error) {
-	const sampleRate = 51200.0
+func RunCalibration(sineFilePaths, squareFilePaths map[string]map[float64]map[string]string, sampleRate float64, progressCallback func(int)) (map[string]CalibrationResult, error) {
+	return RunCalibrationWithCheckpoint(sineFilePaths, squareFilePaths, sampleRate, progressCallback, nil)
+}
 
-	// Reset global data
-	AllCoilData = make(map[string]*CoilData)
+// RunCalibrationWithCheckpoint runs the calibration like RunCalibration,
+// calling checkpoint before each station is processed. A checkpoint that
+// blocks pauses the run between stations; nil disables it. Stations are
+// processed on up to runtime.NumCPU workers so that a pause holds back the
+// stations still queued.
+func RunCalibrationWithCheckpoint(sineFilePaths, squareFilePaths map[string]map[float64]map[string]string, sampleRate float64, progressCallback func(int), checkpoint func()) (map[string]CalibrationResult, error) {
+	var check func() error
+	if checkpoint != nil {
+		check = func() error {
+			checkpoint()
+			return nil
+		}
+	}
+	return RunCalibrationWithOptions(sineFilePaths, squareFilePaths, sampleRate, SpectralOptions{}, progressCallback, check)
+}
+
+// RunCalibrationWithOptions runs the calibration like
+// RunCalibrationWithCheckpoint, averaging each transfer function over the
+// overlapping segments selected by opts to reduce scatter on noisy
+// recordings. A checkpoint error skips the remaining stations and fails the
+// run with that error.
+func RunCalibrationWithOptions(sineFilePaths, squareFilePaths map[string]map[float64]map[string]string, sampleRate float64, opts SpectralOptions, progressCallback func(int), checkpoint func() error) (map[string]CalibrationResult, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("sample rate must be positive, got %v", sampleRate)
+	}
+	if opts.SegmentSize < 0 {
+		return nil, fmt.Errorf("segment size must not be negative, got %d", opts.SegmentSize)
+	}
+	if opts.Overlap < 0 || opts.Overlap >= 1 {
+		return nil, fmt.Errorf("overlap must be in [0, 1), got %v", opts.Overlap)
+	}
+	if opts.NormalizeFrequency < 0 {
+		return nil, fmt.Errorf("normalization frequency must not be negative, got %v", opts.NormalizeFrequency)
+	}
+	for _, rates := range []map[string]map[float64]float64{opts.SineRates, opts.SquareRates} {
+		for coil, coilRates := range rates {
+			for freq, rate := range coilRates {
+				if rate <= 0 {
+					return nil, fmt.Errorf("sample rate of coil %s at %g Hz must be positive, got %v", coil, freq, rate)
+				}
+			}
+		}
+	}
+
+	// Each run collects its own coil data so concurrent runs do not mix
+	store := &coilStore{coils: make(map[string]*CoilData)}
 
 	// Count total stations
 	totalStations := 0
@@ -89,13 +185,32 @@ func RunCalibration(sineFilePaths, squareFilePaths map[string]map[float64]map[st
 	var progressMutex sync.Mutex
 
 	// Process coils
+	workers := make(chan struct{}, runtime.NumCPU())
 	processCoil := func(coil string, freq float64, paths map[string]string, isSquare bool) {
 		defer wg.Done()
+		workers <- struct{}{}
+		defer func() { <-workers }()
+		if checkpoint != nil {
+			if err := checkpoint(); err != nil {
+				errChan <- err
+				return
+			}
+		}
+
+		rates := opts.SineRates
+		if isSquare {
+			rates = opts.SquareRates
+		}
+		rate := sampleRate
+		if stationRate, ok := rates[coil][freq]; ok {
+			rate = stationRate
+		}
+
 		var err error
 		if isSquare {
-			err = processSquareWave(coil, freq, paths["tx"], paths["rx"], sampleRate)
+			err = processSquareWave(store, coil, freq, paths["tx"], paths["rx"], rate, opts)
 		} else {
-			err = processSineWave(coil, freq, paths["tx"], paths["rx"], sampleRate)
+			err = processSineWave(store, coil, freq, paths["tx"], paths["rx"], rate, opts)
 		}
 		if err != nil {
 			errChan <- fmt.Errorf("error processing %s wave for coil %s: %v",
@@ -144,12 +259,52 @@ func RunCalibration(sineFilePaths, squareFilePaths map[string]map[float64]map[st
 	}
 
 	// Calculate final response
-	return CalculateFinalResponse()
+	results, err := CalculateFinalResponse(store.coils)
+	if err != nil || opts.NormalizeFrequency == 0 {
+		return results, err
+	}
+	// A coil that cannot be normalized keeps its absolute amplitudes only
+	for coil, result := range results {
+		if err := normalizeAmplitudes(&result, opts.NormalizeFrequency); err != nil {
+			result.NormalizationWarning = fmt.Sprintf("amplitudes not normalized: %v", err)
+		}
+		results[coil] = result
+	}
+	return results, nil
+}
+
+// normalizeAmplitudes fills in the amplitudes of result relative to their
+// value at refFreq, interpolated linearly between the nearest measured
+// frequencies when refFreq was not measured itself
+func normalizeAmplitudes(result *CalibrationResult, refFreq float64) error {
+	freqs := result.Frequencies
+	if len(freqs) == 0 {
+		return fmt.Errorf("no measured frequencies")
+	}
+	if refFreq < freqs[0] || refFreq > freqs[len(freqs)-1] {
+		return fmt.Errorf("reference frequency %g Hz is outside the measured range %g to %g Hz",
+			refFreq, freqs[0], freqs[len(freqs)-1])
+	}
+
+	j := sort.SearchFloat64s(freqs, refFreq)
+	ref := result.Amplitudes[j]
+	if freqs[j] != refFreq {
+		t := (refFreq - freqs[j-1]) / (freqs[j] - freqs[j-1])
+		ref = result.Amplitudes[j-1] + t*(result.Amplitudes[j]-result.Amplitudes[j-1])
+	}
+
+	normalized := make([]float64, len(result.Amplitudes))
+	for i, amplitude := range result.Amplitudes {
+		normalized[i] = amplitude - ref
+	}
+	result.NormalizedAmplitudes = normalized
+	result.ReferenceFrequency = refFreq
+	return nil
 }
 
 // Add these missing functions
-func processSineWave(coil string, freq float64, txPath, rxPath string, sampleRate float64) error {
-	log.Printf("Processing sine wave: coil=%s, freq=%f, tx=%s, rx=%s", coil, freq, txPath, rxPath)
+func processSineWave(store *coilStore, coil string, freq float64, txPath, rxPath string, sampleRate float64, opts SpectralOptions) error {
+	logging.Debugf("Processing sine wave: coil=%s, freq=%f, tx=%s, rx=%s", coil, freq, txPath, rxPath)
 	txSignal, err := readBinaryFile(txPath)
 	if err != nil {
 		return fmt.Errorf("error reading tx file %s: %v", txPath, err)
@@ -160,22 +315,23 @@ func processSineWave(coil string, freq float64, txPath, rxPath string, sampleRat
 		return fmt.Errorf("error reading rx file %s: %v", rxPath, err)
 	}
 
-	validFreqs, transferFunction := CalculateSineTransferFunction(txSignal, rxSignal, sampleRate, freq)
-
-	coilDataMutex.Lock()
-	if _, exists := AllCoilData[coil]; !exists {
-		AllCoilData[coil] = &CoilData{}
+	var validFreqs []float64
+	var transferFunction []complex128
+	if opts.Goertzel {
+		validFreqs = []float64{freq}
+		transferFunction, _ = CalculateGoertzelTransferFunction(txSignal, rxSignal, sampleRate, validFreqs, opts)
+	} else {
+		validFreqs, transferFunction = CalculateAveragedSineTransferFunction(txSignal, rxSignal, sampleRate, freq, opts)
 	}
-	AllCoilData[coil].Freqs = append(AllCoilData[coil].Freqs, validFreqs)
-	AllCoilData[coil].TransferFunctions = append(AllCoilData[coil].TransferFunctions, transferFunction)
-	coilDataMutex.Unlock()
 
-	log.Printf("Processed sine wave for frequency %.3f Hz (Coil: %s)", freq, coil)
+	store.add(coil, validFreqs, transferFunction, nil)
+
+	logging.Infof("Processed sine wave for frequency %.3f Hz (Coil: %s)", freq, coil)
 	return nil
 }
 
-func processSquareWave(coil string, freq float64, txPath, rxPath string, sampleRate float64) error {
-	log.Printf("Processing square wave: coil=%s, freq=%f, tx=%s, rx=%s", coil, freq, txPath, rxPath)
+func processSquareWave(store *coilStore, coil string, freq float64, txPath, rxPath string, sampleRate float64, opts SpectralOptions) error {
+	logging.Debugf("Processing square wave: coil=%s, freq=%f, tx=%s, rx=%s", coil, freq, txPath, rxPath)
 	txSignal, err := readBinaryFile(txPath)
 	if err != nil {
 		return fmt.Errorf("error reading tx file %s: %v", txPath, err)
@@ -186,24 +342,65 @@ func processSquareWave(coil string, freq float64, txPath, rxPath string, sampleR
 		return fmt.Errorf("error reading rx file %s: %v", rxPath, err)
 	}
 
-	validFreqs, transferFunction, _, _, _ := CalculateTransferFunction(txSignal, rxSignal, sampleRate)
-
-	coilDataMutex.Lock()
-	if _, exists := AllCoilData[coil]; !exists {
-		AllCoilData[coil] = &CoilData{}
+	var validFreqs []float64
+	var transferFunction []complex128
+	if opts.Goertzel {
+		if freq <= 0 {
+			return fmt.Errorf("square wave frequency must be positive for Goertzel measurement, got %v", freq)
+		}
+		validFreqs, transferFunction = goertzelHarmonics(txSignal, rxSignal, sampleRate, freq, opts)
+	} else {
+		validFreqs, transferFunction, _, _, _ = CalculateAveragedTransferFunction(txSignal, rxSignal, sampleRate, opts)
 	}
-	AllCoilData[coil].Freqs = append(AllCoilData[coil].Freqs, validFreqs)
-	AllCoilData[coil].TransferFunctions = append(AllCoilData[coil].TransferFunctions, transferFunction)
-	coilDataMutex.Unlock()
+	harmonics := harmonicTable(freq, validFreqs, transferFunction)
 
-	log.Printf("Processed square wave for frequency %.3f Hz (Coil: %s)", freq, coil)
+	store.add(coil, validFreqs, transferFunction, harmonics)
+
+	logging.Infof("Processed square wave for frequency %.3f Hz (Coil: %s)", freq, coil)
 	return nil
 }
 
-func CalculateFinalResponse() (map[string]CalibrationResult, error) {
+// harmonicTable labels the transfer function peaks of a square wave drive at
+// driveFreq with their harmonic order, keeping only odd harmonics
+func harmonicTable(driveFreq float64, peakFreqs []float64, transferFunction []complex128) []HarmonicResult {
+	var harmonics []HarmonicResult
+	if driveFreq <= 0 {
+		return harmonics
+	}
+
+	for i, peakFreq := range peakFreqs {
+		order := int(math.Round(peakFreq / driveFreq))
+		if order < 1 || order%2 == 0 {
+			continue
+		}
+		harmonics = append(harmonics, HarmonicResult{
+			DriveFrequency: driveFreq,
+			Order:          order,
+			Frequency:      peakFreq,
+			Amplitude:      amplitudeDb(transferFunction[i]),
+			Phase:          cmplx.Phase(transferFunction[i]) * 180 / math.Pi,
+		})
+	}
+
+	sort.Slice(harmonics, func(i, j int) bool {
+		return harmonics[i].Order < harmonics[j].Order
+	})
+	return harmonics
+}
+
+// amplitudeDb returns the gain of a transfer function value in dB, clamped to
+// the FFT dB floor so a dead rx channel gives a finite value that can still
+// be sent as JSON
+func amplitudeDb(tf complex128) float64 {
+	return math.Max(20*math.Log10(cmplx.Abs(tf)), fft.MinMagnitude)
+}
+
+// CalculateFinalResponse combines the stations collected for each coil into
+// its sorted, phase-unwrapped calibration result
+func CalculateFinalResponse(allCoilData map[string]*CoilData) (map[string]CalibrationResult, error) {
 	result := make(map[string]CalibrationResult)
 
-	for coil, coilData := range AllCoilData {
+	for coil, coilData := range allCoilData {
 		var allFreqsFlat []float64
 		var allTransferFunctionsFlat []complex128
 
@@ -224,7 +421,7 @@ func CalculateFinalResponse() (map[string]CalibrationResult, error) {
 		phases := make([]float64, len(allTransferFunctionsFlat))
 
 		for i, tf := range allTransferFunctionsFlat {
-			amplitudes[i] = 20 * math.Log10(cmplx.Abs(tf))
+			amplitudes[i] = amplitudeDb(tf)
 			phases[i] = cmplx.Phase(tf) * 180 / math.Pi
 		}
 
@@ -235,10 +432,20 @@ func CalculateFinalResponse() (map[string]CalibrationResult, error) {
 			phases[i] -= meanPhase
 		}
 
+		// Order harmonics by drive frequency, then harmonic number
+		harmonics := append([]HarmonicResult(nil), coilData.Harmonics...)
+		sort.SliceStable(harmonics, func(i, j int) bool {
+			if harmonics[i].DriveFrequency != harmonics[j].DriveFrequency {
+				return harmonics[i].DriveFrequency < harmonics[j].DriveFrequency
+			}
+			return harmonics[i].Order < harmonics[j].Order
+		})
+
 		result[coil] = CalibrationResult{
 			Frequencies: allFreqsFlat,
 			Amplitudes:  amplitudes,
 			Phases:      phases,
+			Harmonics:   harmonics,
 		}
 	}
 
@@ -249,14 +456,37 @@ func CalculateFinalResponse() (map[string]CalibrationResult, error) {
 	return result, nil
 }
 
-// Add mutex for thread safety
-var coilDataMutex sync.Mutex
+// coilStore collects the stations of one calibration run, which its
+// workers add to concurrently
+type coilStore struct {
+	mu    sync.Mutex
+	coils map[string]*CoilData
+}
+
+// add appends one station's frequencies, transfer function and harmonics to
+// the data of coil
+func (s *coilStore) add(coil string, freqs []float64, transferFunction []complex128, harmonics []HarmonicResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, exists := s.coils[coil]
+	if !exists {
+		data = &CoilData{}
+		s.coils[coil] = data
+	}
+	data.Freqs = append(data.Freqs, freqs)
+	data.TransferFunctions = append(data.TransferFunctions, transferFunction)
+	data.Harmonics = append(data.Harmonics, harmonics...)
+}
 
 // Add these missing functions:
 
 // readBinaryFile reads a binary file containing float32 values
 func readBinaryFile(filePath string) ([]float64, error) {
-	data, err := os.ReadFile(filePath)
+	read := os.ReadFile
+	if timeseries.IsCompressed(filePath) {
+		read = timeseries.ReadDecompressed
+	}
+	data, err := read(filePath)
 	if err != nil {
 		return nil, err
 	}
@@ -313,30 +543,74 @@ func unwrapPhase(phases []float64) []float64 {
 
 // CalculateTransferFunction calculates the transfer function between two signals
 func CalculateTransferFunction(txSignal, rxSignal []float64, sampleRate float64) ([]float64, []complex128, []complex128, []complex128, []float64) {
-	N := len(txSignal)
+	return CalculateAveragedTransferFunction(txSignal, rxSignal, sampleRate, SpectralOptions{})
+}
+
+// segmentStarts returns the start of each segment of opts.SegmentSize
+// samples within n samples, along with the size actually used
+func segmentStarts(n int, opts SpectralOptions) ([]int, int) {
+	size := opts.SegmentSize
+	if size <= 0 || size >= n {
+		return []int{0}, n
+	}
+	hop := max(int(float64(size)*(1-opts.Overlap)), 1)
+	var starts []int
+	for start := 0; start+size <= n; start += hop {
+		starts = append(starts, start)
+	}
+	return starts, size
+}
+
+// CalculateAveragedTransferFunction calculates the transfer function between
+// two signals at the tx spectral peaks, averaged over the segments selected
+// by opts. Each peak is sum(conj(Tx)*Rx) / sum(|Tx|^2) over the segments,
+// which reduces to Rx/Tx for a single segment. The returned tx and rx
+// spectra are the mean segment coefficients.
+func CalculateAveragedTransferFunction(txSignal, rxSignal []float64, sampleRate float64, opts SpectralOptions) ([]float64, []complex128, []complex128, []complex128, []float64) {
+	starts, N := segmentStarts(min(len(txSignal), len(rxSignal)), opts)
 	T := 1.0 / sampleRate
 
 	window := blackmanHarris(N)
+	fft := fourier.NewFFT(N)
+
+	numFreqs := N/2 + 1
+	txFFT := make([]complex128, numFreqs)
+	rxFFT := make([]complex128, numFreqs)
+	crossSpectrum := make([]complex128, numFreqs)
+	txPower := make([]float64, numFreqs)
 
 	txSignalWindowed := make([]float64, N)
 	rxSignalWindowed := make([]float64, N)
-	for i := 0; i < N; i++ {
-		txSignalWindowed[i] = txSignal[i] * window[i]
-		rxSignalWindowed[i] = rxSignal[i] * window[i]
+	var txSegment, rxSegment []complex128
+	for _, start := range starts {
+		for i := 0; i < N; i++ {
+			txSignalWindowed[i] = txSignal[start+i] * window[i]
+			rxSignalWindowed[i] = rxSignal[start+i] * window[i]
+		}
+		txSegment = fft.Coefficients(txSegment, txSignalWindowed)
+		rxSegment = fft.Coefficients(rxSegment, rxSignalWindowed)
+		for i := range txFFT {
+			txFFT[i] += txSegment[i]
+			rxFFT[i] += rxSegment[i]
+			crossSpectrum[i] += cmplx.Conj(txSegment[i]) * rxSegment[i]
+			txPower[i] += real(txSegment[i])*real(txSegment[i]) + imag(txSegment[i])*imag(txSegment[i])
+		}
+	}
+	segments := complex(float64(len(starts)), 0)
+	for i := range txFFT {
+		txFFT[i] /= segments
+		rxFFT[i] /= segments
 	}
 
-	fft := fourier.NewFFT(N)
-	txFFT := fft.Coefficients(nil, txSignalWindowed)
-	rxFFT := fft.Coefficients(nil, rxSignalWindowed)
-
-	freqs := make([]float64, N/2+1)
+	freqs := make([]float64, numFreqs)
 	for i := range freqs {
 		freqs[i] = float64(i) / (float64(N) * T)
 	}
 
-	txMagnitude := make([]float64, len(txFFT))
-	for i, v := range txFFT {
-		txMagnitude[i] = cmplx.Abs(v)
+	// RMS of the segment magnitudes, so averaging keeps the peak heights
+	txMagnitude := make([]float64, numFreqs)
+	for i, p := range txPower {
+		txMagnitude[i] = math.Sqrt(p / float64(len(starts)))
 	}
 
 	peaks := findPeaks(txMagnitude, 0.04*floats.Max(txMagnitude))
@@ -345,7 +619,7 @@ func CalculateTransferFunction(txSignal, rxSignal []float64, sampleRate float64)
 	transferFunction := make([]complex128, len(peaks))
 	for i, peak := range peaks {
 		validFreqs[i] = freqs[peak]
-		transferFunction[i] = rxFFT[peak] / txFFT[peak]
+		transferFunction[i] = crossSpectrum[peak] / complex(txPower[peak], 0)
 	}
 
 	return validFreqs, transferFunction, txFFT, rxFFT, freqs
@@ -353,29 +627,99 @@ func CalculateTransferFunction(txSignal, rxSignal []float64, sampleRate float64)
 
 // CalculateSineTransferFunction calculates the transfer function for a sine wave
 func CalculateSineTransferFunction(txSignal, rxSignal []float64, sampleRate, expectedFreq float64) ([]float64, []complex128) {
-	N := len(txSignal)
+	return CalculateAveragedSineTransferFunction(txSignal, rxSignal, sampleRate, expectedFreq, SpectralOptions{})
+}
+
+// CalculateAveragedSineTransferFunction calculates the transfer function for
+// a sine wave at expectedFreq, averaging sum(conj(tx)*rx) / sum(|tx|^2) over
+// the segments selected by opts
+func CalculateAveragedSineTransferFunction(txSignal, rxSignal []float64, sampleRate, expectedFreq float64, opts SpectralOptions) ([]float64, []complex128) {
+	starts, N := segmentStarts(min(len(txSignal), len(rxSignal)), opts)
 	T := 1.0 / sampleRate
-	t := make([]float64, N)
-	for i := range t {
-		t[i] = float64(i) * T
-	}
 
 	k := int(expectedFreq * float64(N) * T)
-	txComplex := complex(0, 0)
-	rxComplex := complex(0, 0)
-
-	for i := 0; i < N; i++ {
-		expTerm := cmplx.Exp(complex(0, -2*math.Pi*float64(k)*float64(i)/float64(N)))
-		txComplex += complex(txSignal[i], 0) * expTerm
-		rxComplex += complex(rxSignal[i], 0) * expTerm
+	expTerms := make([]complex128, N)
+	for i := range expTerms {
+		expTerms[i] = cmplx.Exp(complex(0, -2*math.Pi*float64(k)*float64(i)/float64(N)))
 	}
 
-	txComplex *= 2.0 / complex(float64(N), 0)
-	rxComplex *= 2.0 / complex(float64(N), 0)
+	crossSpectrum := complex(0, 0)
+	txPower := 0.0
+	for _, start := range starts {
+		txComplex := complex(0, 0)
+		rxComplex := complex(0, 0)
+		for i := 0; i < N; i++ {
+			txComplex += complex(txSignal[start+i], 0) * expTerms[i]
+			rxComplex += complex(rxSignal[start+i], 0) * expTerms[i]
+		}
+
+		txComplex *= 2.0 / complex(float64(N), 0)
+		rxComplex *= 2.0 / complex(float64(N), 0)
+
+		crossSpectrum += cmplx.Conj(txComplex) * rxComplex
+		txPower += real(txComplex)*real(txComplex) + imag(txComplex)*imag(txComplex)
+	}
 
-	transferFunction := rxComplex / txComplex
+	transferFunction := crossSpectrum / complex(txPower, 0)
 
 	return []float64{expectedFreq}, []complex128{transferFunction}
 }
 
+// CalculateGoertzelTransferFunction measures the transfer function at each of
+// freqs with the Goertzel algorithm, averaging sum(conj(Tx)*Rx) / sum(|Tx|^2)
+// over the segments selected by opts like the FFT estimates. Segments are not
+// windowed, as in the sine estimate. The RMS tx amplitude at each frequency
+// is returned alongside.
+func CalculateGoertzelTransferFunction(txSignal, rxSignal []float64, sampleRate float64, freqs []float64, opts SpectralOptions) ([]complex128, []float64) {
+	starts, N := segmentStarts(min(len(txSignal), len(rxSignal)), opts)
+
+	transferFunction := make([]complex128, len(freqs))
+	txAmplitude := make([]float64, len(freqs))
+	for i, freq := range freqs {
+		crossSpectrum := complex(0, 0)
+		txPower := 0.0
+		for _, start := range starts {
+			txMag, txPhase := fft.Goertzel(txSignal[start:start+N], sampleRate, freq)
+			rxMag, rxPhase := fft.Goertzel(rxSignal[start:start+N], sampleRate, freq)
+			tx := cmplx.Rect(txMag, txPhase)
+			crossSpectrum += cmplx.Conj(tx) * cmplx.Rect(rxMag, rxPhase)
+			txPower += txMag * txMag
+		}
+		if txPower > 0 {
+			transferFunction[i] = crossSpectrum / complex(txPower, 0)
+		}
+		txAmplitude[i] = math.Sqrt(txPower / float64(len(starts)))
+	}
+	return transferFunction, txAmplitude
+}
+
+// goertzelHarmonics measures the first opts.Harmonics odd harmonics of a
+// square wave drive at driveFreq below Nyquist, keeping those whose tx
+// amplitude reaches harmonicThreshold of the strongest
+func goertzelHarmonics(txSignal, rxSignal []float64, sampleRate, driveFreq float64, opts SpectralOptions) ([]float64, []complex128) {
+	count := opts.Harmonics
+	if count <= 0 {
+		count = defaultGoertzelHarmonics
+	}
+	var freqs []float64
+	for order := 1; len(freqs) < count && float64(order)*driveFreq < sampleRate/2; order += 2 {
+		freqs = append(freqs, float64(order)*driveFreq)
+	}
+	transferFunction, txAmplitude := CalculateGoertzelTransferFunction(txSignal, rxSignal, sampleRate, freqs, opts)
+
+	strongest := 0.0
+	for _, amplitude := range txAmplitude {
+		strongest = math.Max(strongest, amplitude)
+	}
+	var validFreqs []float64
+	var validTF []complex128
+	for i, amplitude := range txAmplitude {
+		if amplitude > 0 && amplitude >= harmonicThreshold*strongest {
+			validFreqs = append(validFreqs, freqs[i])
+			validTF = append(validTF, transferFunction[i])
+		}
+	}
+	return validFreqs, validTF
+}
+
 // ... rest of your existing functions ...
@@ -0,0 +1,175 @@
+package calibration
+
+import (
+	"encoding/json"
+	"math"
+	"math/cmplx"
+	"novacal/timeseries"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// squareStation writes a square wave tx recording at driveFreq and an rx
+// recording of it scaled by gain, returning the calibration file paths
+func squareStation(t *testing.T, driveFreq, gain float64) map[string]map[float64]map[string]string {
+	t.Helper()
+	tx := make([]float64, int(DefaultSampleRate))
+	rx := make([]float64, len(tx))
+	for i := range tx {
+		tx[i] = math.Copysign(1, math.Sin(2*math.Pi*driveFreq*float64(i)/DefaultSampleRate+0.1))
+		rx[i] = gain * tx[i]
+	}
+	dir := t.TempDir()
+	paths := map[string]string{"tx": filepath.Join(dir, "tx.bin"), "rx": filepath.Join(dir, "rx.bin")}
+	if err := timeseries.WriteBinaryFile(paths["tx"], tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := timeseries.WriteBinaryFile(paths["rx"], rx); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]map[float64]map[string]string{"coil": {driveFreq: paths}}
+}
+
+func TestSquareDriveFillsHarmonicTable(t *testing.T) {
+	const driveFreq, gain = 100.0, 0.5
+	results, err := RunCalibration(nil, squareStation(t, driveFreq, gain), DefaultSampleRate, func(int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	harmonics := results["coil"].Harmonics
+	orders := make(map[int]bool)
+	for _, h := range harmonics {
+		if h.Order%2 == 0 {
+			t.Errorf("even harmonic %d in the table", h.Order)
+		}
+		if math.Abs(h.Frequency-float64(h.Order)*driveFreq) > 1 {
+			t.Errorf("harmonic %d at %v Hz, want %v Hz", h.Order, h.Frequency, float64(h.Order)*driveFreq)
+		}
+		if want := 20 * math.Log10(gain); math.Abs(h.Amplitude-want) > 0.1 {
+			t.Errorf("harmonic %d amplitude %.2f dB, want %.2f dB", h.Order, h.Amplitude, want)
+		}
+		orders[h.Order] = true
+	}
+	for _, order := range []int{1, 3, 5, 7} {
+		if !orders[order] {
+			t.Errorf("harmonic %d missing from %+v", order, harmonics)
+		}
+	}
+}
+
+func TestGoertzelHarmonicsAreCapped(t *testing.T) {
+	drive := make([]float64, int(DefaultSampleRate))
+	for i := range drive {
+		drive[i] = math.Copysign(1, math.Sin(2*math.Pi*10*float64(i)/DefaultSampleRate+0.1))
+	}
+
+	for _, tt := range []struct{ harmonics, want int }{{0, defaultGoertzelHarmonics}, {3, 3}} {
+		freqs, _ := goertzelHarmonics(drive, drive, DefaultSampleRate, 10, SpectralOptions{Harmonics: tt.harmonics})
+		if len(freqs) == 0 || len(freqs) > tt.want {
+			t.Errorf("harmonics %d: measured %d tones, want 1 to %d", tt.harmonics, len(freqs), tt.want)
+		}
+	}
+}
+
+func TestDeadRxChannelGivesFiniteResults(t *testing.T) {
+	results, err := RunCalibration(nil, squareStation(t, 100, 0), DefaultSampleRate, func(int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := json.Marshal(results); err != nil {
+		t.Errorf("results of a dead rx channel cannot be encoded: %v", err)
+	}
+}
+
+func TestNormalizationOutsideRangeWarns(t *testing.T) {
+	// 20 kHz lies above every harmonic of a 100 Hz square drive that is measured
+	results, err := RunCalibrationWithOptions(nil, squareStation(t, 100, 0.5), DefaultSampleRate,
+		SpectralOptions{NormalizeFrequency: 20000}, func(int) {}, nil)
+	if err != nil {
+		t.Fatalf("normalization failure failed the run: %v", err)
+	}
+	result := results["coil"]
+	if result.NormalizationWarning == "" {
+		t.Error("no normalization warning for an out-of-range reference")
+	}
+	if result.NormalizedAmplitudes != nil || len(result.Amplitudes) == 0 {
+		t.Errorf("got %d normalized and %d absolute amplitudes, want none and some",
+			len(result.NormalizedAmplitudes), len(result.Amplitudes))
+	}
+}
+
+func TestConcurrentRunsKeepTheirOwnCoils(t *testing.T) {
+	gains := []float64{0.5, 2}
+	stations := make([]map[string]map[float64]map[string]string, len(gains))
+	for i, gain := range gains {
+		stations[i] = squareStation(t, 100, gain)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]map[string]CalibrationResult, len(gains))
+	errs := make([]error, len(gains))
+	for i := range gains {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = RunCalibration(nil, stations[i], DefaultSampleRate, func(int) {})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, gain := range gains {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		harmonics := results[i]["coil"].Harmonics
+		if len(harmonics) == 0 {
+			t.Fatalf("run %d has no harmonics", i)
+		}
+		for _, h := range harmonics {
+			if want := 20 * math.Log10(gain); math.Abs(h.Amplitude-want) > 0.1 {
+				t.Errorf("run %d harmonic %d amplitude %.2f dB, want %.2f dB", i, h.Order, h.Amplitude, want)
+			}
+		}
+	}
+}
+
+func TestOverlapSetsSegmentCount(t *testing.T) {
+	for _, tt := range []struct {
+		overlap float64
+		want    int
+	}{{0, 8}, {0.5, 15}, {0.75, 29}} {
+		starts, size := segmentStarts(8192, SpectralOptions{SegmentSize: 1024, Overlap: tt.overlap})
+		if size != 1024 || len(starts) != tt.want {
+			t.Errorf("overlap %v: %d segments of %d samples, want %d of 1024", tt.overlap, len(starts), size, tt.want)
+		}
+	}
+}
+
+func TestOverlappedAveragingRecoversSinusoid(t *testing.T) {
+	const freq, gain, phase = 1000.0, 0.5, -math.Pi / 4
+	tx := make([]float64, 8192)
+	rx := make([]float64, len(tx))
+	for i := range tx {
+		arg := 2 * math.Pi * freq * float64(i) / DefaultSampleRate
+		tx[i] = math.Sin(arg)
+		rx[i] = gain * math.Sin(arg+phase)
+	}
+
+	for _, overlap := range []float64{0, 0.5} {
+		opts := SpectralOptions{SegmentSize: 1024, Overlap: overlap}
+		freqs, transfer, _, _, _ := CalculateAveragedTransferFunction(tx, rx, DefaultSampleRate, opts)
+		if len(freqs) != 1 || freqs[0] != freq {
+			t.Fatalf("overlap %v: peaks at %v, want only %v Hz", overlap, freqs, freq)
+		}
+		if math.Abs(cmplx.Abs(transfer[0])-gain) > 1e-6 || math.Abs(cmplx.Phase(transfer[0])-phase) > 1e-6 {
+			t.Errorf("overlap %v: transfer function %v, want gain %v at phase %v", overlap, transfer[0], gain, phase)
+		}
+
+		_, sine := CalculateAveragedSineTransferFunction(tx, rx, DefaultSampleRate, freq, opts)
+		if math.Abs(cmplx.Abs(sine[0])-gain) > 1e-6 || math.Abs(cmplx.Phase(sine[0])-phase) > 1e-6 {
+			t.Errorf("overlap %v: sine transfer function %v, want gain %v at phase %v", overlap, sine[0], gain, phase)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package calibration
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+// Size of exported plot images
+const (
+	plotWidth  = 8 * vg.Inch
+	plotHeight = 5 * vg.Inch
+)
+
+// SavePlots renders the amplitude and phase curves of each coil, and the
+// normalized amplitude curve when present, to PNG files in dir and returns
+// the paths written. phaseUnit is the unit of the phases, "deg" or "rad".
+func SavePlots(dir string, results map[string]CalResults, phaseUnit string) ([]string, error) {
+	phaseLabel := "Phase (radians)"
+	if phaseUnit == "deg" {
+		phaseLabel = "Phase (degrees)"
+	}
+
+	var paths []string
+	for coil, result := range results {
+		if len(result.Frequencies) == 0 {
+			continue
+		}
+		if len(result.Amplitudes) != len(result.Frequencies) || len(result.Phases) != len(result.Frequencies) {
+			return paths, fmt.Errorf("mismatched result lengths for coil %s", coil)
+		}
+
+		name := sanitizeFileName(coil)
+		curves := []struct {
+			suffix string
+			title  string
+			label  string
+			values []float64
+		}{
+			{"amplitude", "Amplitude Response", "Amplitude (dB)", result.Amplitudes},
+			{"phase", "Phase Response", phaseLabel, result.Phases},
+		}
+		if len(result.NormalizedAmplitudes) == len(result.Frequencies) {
+			curves = append(curves, struct {
+				suffix string
+				title  string
+				label  string
+				values []float64
+			}{"normalized", fmt.Sprintf("Amplitude Response Normalized at %g Hz", result.ReferenceFrequency),
+				"Relative Amplitude (dB)", result.NormalizedAmplitudes})
+		}
+
+		for _, curve := range curves {
+			path := filepath.Join(dir, fmt.Sprintf("calibration_%s_%s.png", name, curve.suffix))
+			title := fmt.Sprintf("%s - %s", coil, curve.title)
+			if err := saveCurve(path, title, curve.label, result.Frequencies, curve.values); err != nil {
+				return paths, fmt.Errorf("error saving %s plot for coil %s: %v", curve.suffix, coil, err)
+			}
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// saveCurve draws values against frequency on a logarithmic frequency axis
+func saveCurve(path, title, yLabel string, frequencies, values []float64) error {
+	p := plot.New()
+	p.Title.Text = title
+	p.X.Label.Text = "Frequency (Hz)"
+	p.Y.Label.Text = yLabel
+	p.X.Scale = plot.LogScale{}
+	p.X.Tick.Marker = plot.LogTicks{Prec: -1}
+	p.Add(plotter.NewGrid())
+
+	// Log axes cannot show non-positive frequencies
+	points := make(plotter.XYs, 0, len(frequencies))
+	for i, freq := range frequencies {
+		if freq > 0 {
+			points = append(points, plotter.XY{X: freq, Y: values[i]})
+		}
+	}
+	if len(points) == 0 {
+		return fmt.Errorf("no positive frequencies to plot")
+	}
+
+	line, scatter, err := plotter.NewLinePoints(points)
+	if err != nil {
+		return err
+	}
+	scatter.Radius = vg.Points(2)
+	p.Add(line, scatter)
+
+	return p.Save(plotWidth, plotHeight, path)
+}
+
+// sanitizeFileName replaces characters that are not safe in file names
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?* `, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
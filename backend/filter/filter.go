@@ -0,0 +1,315 @@
+package filter
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// Highest supported Butterworth order; higher orders lose precision in
+// transfer function form
+const maxOrder = 10
+
+// Largest error in dB of a design's gain at its cutoffs and in its passband
+// before it is rejected as too ill-conditioned to use
+const maxResponseErrorDb = 0.1
+
+// Butterworth designs a digital Butterworth filter of the given order with
+// the bilinear transform. kind is "lowpass" or "highpass" with one cutoff,
+// or "bandpass" or "bandstop" with two, all in Hz. Band filters have twice
+// the order. It returns the numerator b and denominator a with a[0] = 1.
+// High orders with cutoffs far below Nyquist, narrow bands above all, cannot
+// be represented in b/a form and are rejected with an error.
+func Butterworth(order int, cutoffs []float64, kind string, sampleRate float64) ([]float64, []float64, error) {
+	if order < 1 || order > maxOrder {
+		return nil, nil, fmt.Errorf("filter order must be between 1 and %d, got %d", maxOrder, order)
+	}
+	if sampleRate <= 0 {
+		return nil, nil, fmt.Errorf("sample rate must be positive, got %v", sampleRate)
+	}
+	wantCutoffs := 1
+	if kind == "bandpass" || kind == "bandstop" {
+		wantCutoffs = 2
+	}
+	if len(cutoffs) != wantCutoffs {
+		return nil, nil, fmt.Errorf("%s filter needs %d cutoff frequencies, got %d", kind, wantCutoffs, len(cutoffs))
+	}
+	for _, fc := range cutoffs {
+		if fc <= 0 || fc >= sampleRate/2 {
+			return nil, nil, fmt.Errorf("cutoff %v Hz must be between 0 and the Nyquist frequency %v Hz", fc, sampleRate/2)
+		}
+	}
+	if wantCutoffs == 2 && cutoffs[0] >= cutoffs[1] {
+		return nil, nil, fmt.Errorf("band edges must be increasing, got %v", cutoffs)
+	}
+
+	// Analog prototype with unit cutoff: poles on the left half of the unit circle
+	poles := make([]complex128, order)
+	for k := range poles {
+		theta := math.Pi * float64(2*k+order+1) / float64(2*order)
+		poles[k] = cmplx.Exp(complex(0, theta))
+	}
+	var zeros []complex128
+	gain := 1.0
+
+	// Pre-warp the cutoffs so they land exactly after the bilinear transform
+	warped := make([]float64, len(cutoffs))
+	for i, fc := range cutoffs {
+		warped[i] = 2 * sampleRate * math.Tan(math.Pi*fc/sampleRate)
+	}
+
+	switch kind {
+	case "lowpass":
+		wc := warped[0]
+		for i := range poles {
+			poles[i] *= complex(wc, 0)
+		}
+		gain = math.Pow(wc, float64(order))
+	case "highpass":
+		wc := warped[0]
+		for i := range poles {
+			poles[i] = complex(wc, 0) / poles[i]
+		}
+		zeros = make([]complex128, order)
+		gain = 1 / real(productOfNegated(poles, wc))
+	case "bandpass", "bandstop":
+		wo := math.Sqrt(warped[0] * warped[1])
+		bw := warped[1] - warped[0]
+		transformed := make([]complex128, 0, 2*order)
+		for _, p := range poles {
+			scaled := p * complex(bw/2, 0)
+			if kind == "bandstop" {
+				scaled = complex(bw/2, 0) / p
+			}
+			root := cmplx.Sqrt(scaled*scaled - complex(wo*wo, 0))
+			transformed = append(transformed, scaled+root, scaled-root)
+		}
+		poles = transformed
+		if kind == "bandpass" {
+			zeros = make([]complex128, order)
+			gain = math.Pow(bw, float64(order))
+		} else {
+			for i := 0; i < order; i++ {
+				zeros = append(zeros, complex(0, wo), complex(0, -wo))
+			}
+			gain = 1
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown filter kind: %s", kind)
+	}
+
+	// Bilinear transform; zeros at infinity map to z = -1
+	fs2 := complex(2*sampleRate, 0)
+	num, den := complex(1, 0), complex(1, 0)
+	digitalZeros := make([]complex128, 0, len(poles))
+	for _, z := range zeros {
+		digitalZeros = append(digitalZeros, (fs2+z)/(fs2-z))
+		num *= fs2 - z
+	}
+	for len(digitalZeros) < len(poles) {
+		digitalZeros = append(digitalZeros, -1)
+	}
+	digitalPoles := make([]complex128, len(poles))
+	for i, p := range poles {
+		digitalPoles[i] = (fs2 + p) / (fs2 - p)
+		den *= fs2 - p
+	}
+	gain *= real(num / den)
+
+	b := polynomial(digitalZeros)
+	a := polynomial(digitalPoles)
+	for i := range b {
+		b[i] *= gain
+	}
+	if err := checkResponse(b, a, cutoffs, kind, sampleRate); err != nil {
+		return nil, nil, fmt.Errorf("order %d is too high for this %s filter: %v", order, kind, err)
+	}
+	return b, a, nil
+}
+
+// checkResponse verifies that the design still has half power at each
+// cutoff and unit gain in its passband, which rounding in the polynomial
+// coefficients destroys once the order is too high. The comparisons are
+// written so that NaN gains fail too.
+func checkResponse(b, a, cutoffs []float64, kind string, sampleRate float64) error {
+	halfPower := 10 * math.Log10(0.5)
+	for _, fc := range cutoffs {
+		if gain := gainDb(b, a, fc, sampleRate); !(math.Abs(gain-halfPower) <= maxResponseErrorDb) {
+			return fmt.Errorf("gain at %v Hz is %.3g dB instead of %.3g dB", fc, gain, halfPower)
+		}
+	}
+	passband := 0.0
+	switch kind {
+	case "highpass":
+		passband = sampleRate / 2
+	case "bandpass":
+		// Centre of the band once the cutoffs are pre-warped
+		w0 := math.Tan(math.Pi * cutoffs[0] / sampleRate)
+		w1 := math.Tan(math.Pi * cutoffs[1] / sampleRate)
+		passband = math.Atan(math.Sqrt(w0*w1)) * sampleRate / math.Pi
+	}
+	if gain := gainDb(b, a, passband, sampleRate); !(math.Abs(gain) <= maxResponseErrorDb) {
+		return fmt.Errorf("passband gain at %v Hz is %.3g dB instead of 0 dB", passband, gain)
+	}
+	return nil
+}
+
+// gainDb returns the gain in dB of the transfer function b/a at freq
+func gainDb(b, a []float64, freq, sampleRate float64) float64 {
+	return 20 * math.Log10(cmplx.Abs(response(b, a, freq, sampleRate)))
+}
+
+// response evaluates the transfer function b/a on the unit circle at freq
+func response(b, a []float64, freq, sampleRate float64) complex128 {
+	z := cmplx.Exp(complex(0, -2*math.Pi*freq/sampleRate))
+	eval := func(coeffs []float64) complex128 {
+		sum, zk := complex(0, 0), complex(1, 0)
+		for _, c := range coeffs {
+			sum += complex(c, 0) * zk
+			zk *= z
+		}
+		return sum
+	}
+	return eval(b) / eval(a)
+}
+
+// Apply filters data with the transfer function b/a using direct form II
+// transposed, starting from rest
+func Apply(b, a, data []float64) []float64 {
+	if len(a) == 0 || a[0] == 0 {
+		return data
+	}
+	bn, an := normalize(b, a)
+	return applyFrom(bn, an, data, make([]float64, len(an)))
+}
+
+// FiltFilt filters data forward and then backward with b/a, cancelling the
+// phase response. The ends are extended by odd reflection and the filter
+// starts in its steady state for the first sample to suppress edge transients.
+func FiltFilt(b, a, data []float64) []float64 {
+	if len(a) == 0 || a[0] == 0 || len(data) == 0 {
+		return data
+	}
+	bn, an := normalize(b, a)
+
+	// Odd reflection keeps the signal and its slope continuous at the ends
+	pad := 3 * len(an)
+	if pad > len(data)-1 {
+		pad = len(data) - 1
+	}
+	n := len(data)
+	extended := make([]float64, 0, n+2*pad)
+	for i := pad; i >= 1; i-- {
+		extended = append(extended, 2*data[0]-data[i])
+	}
+	extended = append(extended, data...)
+	for i := n - 2; i >= n-1-pad; i-- {
+		extended = append(extended, 2*data[n-1]-data[i])
+	}
+
+	zi := steadyState(bn, an)
+	forward := applyFrom(bn, an, extended, scaled(zi, extended[0]))
+	reverse(forward)
+	backward := applyFrom(bn, an, forward, scaled(zi, forward[0]))
+	reverse(backward)
+	return backward[pad : pad+n]
+}
+
+// normalize pads b and a to the same length and scales them so a[0] = 1
+func normalize(b, a []float64) ([]float64, []float64) {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	bn := make([]float64, n)
+	an := make([]float64, n)
+	for i := range b {
+		bn[i] = b[i] / a[0]
+	}
+	for i := range a {
+		an[i] = a[i] / a[0]
+	}
+	return bn, an
+}
+
+// steadyState returns the filter state reached after a long run of unit
+// input, so a signal starting at value v can begin from v times this state
+func steadyState(bn, an []float64) []float64 {
+	n := len(an)
+	sumB, sumA := 0.0, 0.0
+	for i := range an {
+		sumB += bn[i]
+		sumA += an[i]
+	}
+	state := make([]float64, n)
+	if sumA == 0 {
+		return state
+	}
+	gain := sumB / sumA
+	for j := n - 1; j >= 1; j-- {
+		state[j-1] = bn[j] - an[j]*gain + state[j]
+	}
+	return state
+}
+
+func scaled(values []float64, factor float64) []float64 {
+	out := make([]float64, len(values))
+	for i, v := range values {
+		out[i] = v * factor
+	}
+	return out
+}
+
+func reverse(values []float64) {
+	for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+		values[i], values[j] = values[j], values[i]
+	}
+}
+
+// applyFrom runs the normalised filter over data from the given state, which
+// has len(an) elements with the last one always zero
+func applyFrom(bn, an, data, state []float64) []float64 {
+	n := len(an)
+	filtered := make([]float64, len(data))
+	for i, x := range data {
+		y := bn[0]*x + state[0]
+		for j := 1; j < n; j++ {
+			next := 0.0
+			if j < n-1 {
+				next = state[j]
+			}
+			state[j-1] = bn[j]*x - an[j]*y + next
+		}
+		filtered[i] = y
+	}
+	return filtered
+}
+
+// productOfNegated returns the product of -p/wc over poles, which normalises
+// the highpass gain to unity at high frequencies
+func productOfNegated(poles []complex128, wc float64) complex128 {
+	product := complex(1, 0)
+	for _, p := range poles {
+		product *= -p / complex(wc, 0)
+	}
+	return product
+}
+
+// polynomial expands the monic polynomial with the given roots, returning
+// real coefficients from the highest power down
+func polynomial(roots []complex128) []float64 {
+	coeffs := []complex128{1}
+	for _, r := range roots {
+		next := make([]complex128, len(coeffs)+1)
+		for i, c := range coeffs {
+			next[i] += c
+			next[i+1] -= c * r
+		}
+		coeffs = next
+	}
+	real64 := make([]float64, len(coeffs))
+	for i, c := range coeffs {
+		real64[i] = real(c)
+	}
+	return real64
+}
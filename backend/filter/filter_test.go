@@ -0,0 +1,94 @@
+package filter
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+func TestButterworthCutoffIsMinus3dB(t *testing.T) {
+	const rate = 51200.0
+	halfPower := 10 * math.Log10(0.5)
+	tests := []struct {
+		kind     string
+		cutoffs  []float64
+		passband float64 // Frequency with unit gain
+	}{
+		{"lowpass", []float64{1000}, 0},
+		{"highpass", []float64{1000}, rate / 2},
+		{"bandpass", []float64{800, 1200}, math.Sqrt(800 * 1200)},
+		{"bandstop", []float64{800, 1200}, 0},
+	}
+	for _, tt := range tests {
+		for _, order := range []int{1, 2, 4} {
+			b, a, err := Butterworth(order, tt.cutoffs, tt.kind, rate)
+			if err != nil {
+				t.Fatalf("%s order %d: %v", tt.kind, order, err)
+			}
+			for _, fc := range tt.cutoffs {
+				if got := gainDb(b, a, fc, rate); math.Abs(got-halfPower) > 0.01 {
+					t.Errorf("%s order %d: gain %.3f dB at %v Hz, want %.3f dB", tt.kind, order, got, fc, halfPower)
+				}
+			}
+			if got := gainDb(b, a, tt.passband, rate); math.Abs(got) > 0.01 {
+				t.Errorf("%s order %d: passband gain %.3f dB at %v Hz, want 0 dB", tt.kind, order, got, tt.passband)
+			}
+		}
+	}
+}
+
+func TestButterworthRollOff(t *testing.T) {
+	// Each order adds 20 dB per decade well above the cutoff
+	const rate = 51200.0
+	for _, order := range []int{1, 2, 3} {
+		b, a, err := Butterworth(order, []float64{10}, "lowpass", rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slope := gainDb(b, a, 100, rate) - gainDb(b, a, 1000, rate)
+		if want := 20 * float64(order); math.Abs(slope-want) > 1 {
+			t.Errorf("order %d: %.2f dB per decade, want %v", order, slope, want)
+		}
+	}
+}
+
+func TestButterworthRejectsIllConditionedDesigns(t *testing.T) {
+	// A high-order narrow band far below Nyquist has no usable b/a form
+	if _, _, err := Butterworth(8, []float64{50, 60}, "bandpass", 51200); err == nil {
+		t.Error("order 8 bandpass at 50-60 Hz was accepted")
+	}
+	if _, _, err := Butterworth(8, []float64{1000}, "lowpass", 51200); err != nil {
+		t.Errorf("order 8 lowpass at 1 kHz was rejected: %v", err)
+	}
+}
+
+func TestFiltFiltHasZeroPhase(t *testing.T) {
+	const rate, freq = 51200.0, 500.0
+	b, a, err := Butterworth(4, []float64{2000}, "lowpass", rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]float64, 51200)
+	for i := range data {
+		data[i] = math.Sin(2 * math.Pi * freq * float64(i) / rate)
+	}
+
+	// Phase of the output against the input sine away from the edges
+	phase := func(y []float64) float64 {
+		var in, quad float64
+		for i := len(y) / 4; i < 3*len(y)/4; i++ {
+			w := 2 * math.Pi * freq * float64(i) / rate
+			in += y[i] * math.Sin(w)
+			quad += y[i] * math.Cos(w)
+		}
+		return math.Atan2(quad, in)
+	}
+
+	if got := phase(FiltFilt(b, a, data)); math.Abs(got) > 1e-3 {
+		t.Errorf("FiltFilt phase %.4f rad, want 0", got)
+	}
+	want := cmplx.Phase(response(b, a, freq, rate))
+	if got := phase(Apply(b, a, data)); math.Abs(got-want) > 1e-2 {
+		t.Errorf("Apply phase %.4f rad, want the filter's %.4f rad", got, want)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// job is a long-running operation started by a client request
+type job struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Started time.Time `json:"started"`
+	Paused  bool      `json:"paused"`
+	Timeout string    `json:"timeout"` // Time limit, e.g. "10m0s"
+
+	resume   chan struct{}   // Closed to release a paused job
+	pausedBy *websocket.Conn // Connection that paused the job
+
+	// ctx expires when the job exceeds its time limit; the work checks it
+	// at its checkpoints
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+
+	// The time limit runs on timer, which is stopped while the job is
+	// paused and re-armed with the time that was left
+	timer     *time.Timer
+	deadline  time.Time
+	remaining time.Duration
+}
+
+// Time limits in seconds of the job types, overridable through
+// NOVACAL_TIMEOUT_<TYPE> (e.g. NOVACAL_TIMEOUT_CALIBRATE). Other operations
+// get defaultOperationTimeout. Time spent paused does not count towards the
+// limit.
+var operationTimeouts = map[string]int{
+	"plot":         120,
+	"computeFFT":   600,
+	"batchFFT":     1800,
+	"calibrate":    1800,
+	"generateFIR":  900,
+	"calculateFIR": 1800,
+}
+
+const defaultOperationTimeout = 600
+
+// operationTimeout returns the time limit of an operation type
+func operationTimeout(jobType string) time.Duration {
+	seconds, ok := operationTimeouts[jobType]
+	if !ok {
+		seconds = defaultOperationTimeout
+	}
+	return time.Duration(envInt("NOVACAL_TIMEOUT_"+strings.ToUpper(jobType), seconds)) * time.Second
+}
+
+// jobRegistry tracks the operations currently running across all connections
+type jobRegistry struct {
+	mu     sync.Mutex
+	jobs   map[string]*job
+	nextID int
+}
+
+var jobs = &jobRegistry{jobs: make(map[string]*job)}
+
+// start registers a new job of the given type
+func (r *jobRegistry) start(jobType string) *job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	timeout := operationTimeout(jobType)
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		ID:       fmt.Sprintf("%s-%d", jobType, r.nextID),
+		Type:     jobType,
+		Started:  time.Now(),
+		Timeout:  timeout.String(),
+		ctx:      ctx,
+		cancel:   cancel,
+		timeout:  timeout,
+		timer:    time.AfterFunc(timeout, cancel),
+		deadline: time.Now().Add(timeout),
+	}
+	r.jobs[j.ID] = j
+	return j
+}
+
+// finish removes a job once it has completed or failed
+func (r *jobRegistry) finish(j *job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j.timer.Stop()
+	j.cancel()
+	delete(r.jobs, j.ID)
+}
+
+// err returns an error once j has exceeded its time limit
+func (j *job) err() error {
+	if j.ctx.Err() == nil {
+		return nil
+	}
+	return fmt.Errorf("%s exceeded its %v time limit", j.Type, j.timeout)
+}
+
+// count returns the number of running jobs
+func (r *jobRegistry) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.jobs)
+}
+
+// list returns a snapshot of the running jobs
+func (r *jobRegistry) list() []job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]job, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		list = append(list, job{ID: j.ID, Type: j.Type, Started: j.Started, Paused: j.Paused, Timeout: j.Timeout})
+	}
+	return list
+}
+
+// pause marks a job as paused; it stops at its next checkpoint
+func (r *jobRegistry) pause(id string, owner *websocket.Conn) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[id]
+	if !ok {
+		return fmt.Errorf("no running job with id %s", id)
+	}
+	if !j.Paused {
+		j.Paused = true
+		j.resume = make(chan struct{})
+		if j.timer.Stop() {
+			j.remaining = time.Until(j.deadline)
+		}
+	}
+	j.pausedBy = owner
+	return nil
+}
+
+// resume releases a paused job
+func (r *jobRegistry) resume(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[id]
+	if !ok {
+		return fmt.Errorf("no running job with id %s", id)
+	}
+	r.release(j)
+	return nil
+}
+
+// resumePausedBy releases every job paused from conn, so a client that
+// disconnects cannot leave work blocked forever
+func (r *jobRegistry) resumePausedBy(conn *websocket.Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, j := range r.jobs {
+		if j.Paused && j.pausedBy == conn {
+			r.release(j)
+		}
+	}
+}
+
+// release unpauses j; the caller holds r.mu
+func (r *jobRegistry) release(j *job) {
+	if j.Paused {
+		j.Paused = false
+		j.pausedBy = nil
+		close(j.resume)
+		if j.ctx.Err() == nil {
+			j.deadline = time.Now().Add(j.remaining)
+			j.timer = time.AfterFunc(j.remaining, j.cancel)
+		}
+	}
+}
+
+// checkpoint blocks while j is paused. Jobs call it between iterations, at
+// points where waiting loses no state, and stop with the returned error once
+// the job has run out of time.
+func (r *jobRegistry) checkpoint(j *job) error {
+	for {
+		if err := j.err(); err != nil {
+			return err
+		}
+		r.mu.Lock()
+		if !j.Paused {
+			r.mu.Unlock()
+			return nil
+		}
+		resume := j.resume
+		r.mu.Unlock()
+		select {
+		case <-resume:
+		case <-j.ctx.Done():
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPausedTimeDoesNotCountTowardsTimeout(t *testing.T) {
+	j := jobs.start("test")
+	defer jobs.finish(j)
+
+	// Shorten the limit to 100ms
+	const limit = 100 * time.Millisecond
+	j.timer.Stop()
+	j.timeout, j.deadline = limit, time.Now().Add(limit)
+	j.timer = time.AfterFunc(limit, j.cancel)
+
+	if err := jobs.pause(j.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * limit)
+	if err := j.err(); err != nil {
+		t.Fatalf("timed out while paused: %v", err)
+	}
+
+	if err := jobs.resume(j.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := jobs.checkpoint(j); err != nil {
+		t.Fatalf("timed out straight after resuming: %v", err)
+	}
+
+	time.Sleep(3 * limit)
+	if err := jobs.checkpoint(j); err == nil {
+		t.Error("still running after exceeding the limit")
+	}
+}
+
+func TestPausedJobMakesNoProgressUntilResumed(t *testing.T) {
+	j := jobs.start("test")
+	defer jobs.finish(j)
+
+	const steps = 5
+	progress := make(chan int)
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < steps; i++ {
+			if err := jobs.checkpoint(j); err != nil {
+				done <- err
+				return
+			}
+			progress <- i
+		}
+		done <- nil
+	}()
+
+	next := 0
+	for ; next < 2; next++ {
+		if got := <-progress; got != next {
+			t.Fatalf("step %d reported as %d", next, got)
+		}
+	}
+	if err := jobs.pause(j.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	// A step already past its checkpoint may still finish
+	select {
+	case got := <-progress:
+		if got != next {
+			t.Fatalf("step %d reported as %d", next, got)
+		}
+		next++
+	case <-time.After(50 * time.Millisecond):
+	}
+	select {
+	case got := <-progress:
+		t.Fatalf("step %d ran while paused", got)
+	case err := <-done:
+		t.Fatalf("finished while paused (%v)", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := jobs.resume(j.ID); err != nil {
+		t.Fatal(err)
+	}
+	for ; next < steps; next++ {
+		if got := <-progress; got != next {
+			t.Fatalf("step %d reported as %d after resuming", next, got)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Errorf("failed after resuming: %v", err)
+	}
+}
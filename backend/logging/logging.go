@@ -0,0 +1,82 @@
+// Package logging provides leveled logging on top of the standard logger so
+// verbose diagnostics can be switched off without touching call sites
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Level orders messages by severity, lower values being more severe
+type Level int32
+
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+)
+
+// DefaultLevel is used when no level is configured
+const DefaultLevel = LevelInfo
+
+var current atomic.Int32
+
+func init() {
+	current.Store(int32(DefaultLevel))
+}
+
+// ParseLevel converts "error", "warn", "info" or "debug" to a Level
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "error":
+		return LevelError, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "info":
+		return LevelInfo, nil
+	case "debug":
+		return LevelDebug, nil
+	default:
+		return DefaultLevel, fmt.Errorf("unknown log level: %s", name)
+	}
+}
+
+// SetLevel sets the most verbose level that is still written
+func SetLevel(level Level) {
+	current.Store(int32(level))
+}
+
+// Enabled reports whether messages at level are written, letting callers skip
+// building expensive log output
+func Enabled(level Level) bool {
+	return Level(current.Load()) >= level
+}
+
+func logf(level Level, prefix, format string, args ...interface{}) {
+	if Enabled(level) {
+		log.Printf(prefix+format, args...)
+	}
+}
+
+// Errorf logs a failure
+func Errorf(format string, args ...interface{}) {
+	logf(LevelError, "ERROR ", format, args...)
+}
+
+// Warnf logs a recoverable problem
+func Warnf(format string, args ...interface{}) {
+	logf(LevelWarn, "WARN ", format, args...)
+}
+
+// Infof logs normal progress
+func Infof(format string, args ...interface{}) {
+	logf(LevelInfo, "INFO ", format, args...)
+}
+
+// Debugf logs detailed diagnostics such as request and result dumps
+func Debugf(format string, args ...interface{}) {
+	logf(LevelDebug, "DEBUG ", format, args...)
+}
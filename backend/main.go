@@ -2,40 +2,110 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"math"
 	"net"
 	"net/http"
+	"net/url"
 	fft "novacal/FFT"
 	"novacal/calibration"
+	"novacal/filter"
 	"novacal/fir"
+	"novacal/logging"
 	"novacal/timeseries"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
+	CheckOrigin: checkOrigin,
+}
+
+// allowedOrigins lists extra origins permitted to open a WebSocket, taken
+// from the comma-separated NOVACAL_ALLOWED_ORIGINS variable
+var allowedOrigins = parseOrigins(os.Getenv("NOVACAL_ALLOWED_ORIGINS"))
+
+func parseOrigins(value string) map[string]bool {
+	origins := make(map[string]bool)
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin != "" {
+			origins[strings.ToLower(origin)] = true
+		}
+	}
+	return origins
+}
+
+// checkOrigin accepts the packaged app (file:// pages), localhost on any
+// port, clients that send no Origin header, and the configured allowlist.
+// The opaque "null" origin of sandboxed frames and data: pages is refused
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "file://" {
+		return true
+	}
+	if allowedOrigins[strings.ToLower(strings.TrimRight(origin, "/"))] {
 		return true
-	},
+	}
+
+	u, err := url.Parse(origin)
+	if err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		switch u.Hostname() {
+		case "localhost", "127.0.0.1", "::1":
+			return true
+		}
+	}
+
+	logging.Warnf("Rejected WebSocket connection from origin %s", origin)
+	return false
 }
 
 type Message struct {
-	Type    string `json:"type"`
-	Message string `json:"message"`
+	Type      string `json:"type"`
+	Message   string `json:"message"`
+	ErrorCode string `json:"errorCode,omitempty"`
 }
 
+// Error codes sent with error messages so the frontend can choose a recovery action
+const (
+	ErrInvalidRequest    = "INVALID_REQUEST"
+	ErrFileNotFound      = "FILE_NOT_FOUND"
+	ErrReadError         = "READ_ERROR"
+	ErrWriteError        = "WRITE_ERROR"
+	ErrCalibrationFailed = "CALIBRATION_FAILED"
+	ErrFIRFailed         = "FIR_FAILED"
+	ErrProcessingFailed  = "PROCESSING_FAILED"
+	ErrAccessDenied      = "ACCESS_DENIED"
+	ErrTimeout           = "TIMEOUT" // The operation ran past its time limit
+	ErrBusy              = "BUSY"    // The request queue is full, retry later
+)
+
 type DirectoryRequest struct {
-	Type string `json:"type"`
-	Path string `json:"path"`
+	Type       string   `json:"type"`
+	Path       string   `json:"path"`
+	Extensions []string `json:"extensions"` // Only list files with these extensions, e.g. ".bin"
+	DirsOnly   bool     `json:"dirsOnly"`
+	FilesOnly  bool     `json:"filesOnly"`
 }
 
 type FileInfo struct {
@@ -50,29 +120,317 @@ type DirectoryResponse struct {
 }
 
 type PlotRequest struct {
-	Type             string   `json:"type"`
-	Files            []string `json:"files"`
-	StartIndex       int      `json:"startIndex"`
-	EndIndex         int      `json:"endIndex"`
-	DecimationFactor int      `json:"decimationFactor"`
+	Type               string                   `json:"type"`
+	Files              []string                 `json:"files"`
+	BaseDir            string                   `json:"baseDir"` // Resolves relative paths, see fileBase
+	StartIndex         int                      `json:"startIndex"`
+	EndIndex           int                      `json:"endIndex"`
+	DecimationFactor   int                      `json:"decimationFactor"`
+	MaxPoints          int                      `json:"maxPoints"`          // Optional, can only lower the server cap
+	DownsampleMethod   string                   `json:"downsampleMethod"`   // "extrema" (default), "peakhold", "stride" or "average"
+	DownsampleMode     string                   `json:"downsampleMode"`     // Same as downsampleMethod, either may be set
+	StrictIndices      bool                     `json:"strictIndices"`      // Error on out-of-range indices instead of clamping
+	NumChannels        int                      `json:"numChannels"`        // Interleaved channels per file, 0 or 1 for plain files
+	Channel            int                      `json:"channel"`            // Channel to plot in interleaved files
+	RequireEqualLength bool                     `json:"requireEqualLength"` // Error instead of annotating files of different lengths
+	Smooth             int                      `json:"smooth"`             // Smoothing window in samples, 0 for none
+	SmoothMethod       string                   `json:"smoothMethod"`       // "mean" (default) or "median"
+	Transform          string                   `json:"transform"`          // "none" (default), "derivative" or "integral"
+	SampleRate         float64                  `json:"sampleRate"`         // Scales transforms to seconds when set
+	IntegralInitial    float64                  `json:"integralInitial"`    // Integral value at startIndex
+	HeaderBytes        int64                    `json:"headerBytes"`        // Instrument header skipped at the start of each file
+	NotchFilter        *timeseries.NotchOptions `json:"notchFilter"`        // Hum removal at sampleRate, applied first
+	ScaleFactor        float64                  `json:"scaleFactor"`        // Physical units per raw count, 0 selects 1
+	Offset             float64                  `json:"offset"`             // Added after scaling
+	RawThreshold       int                      `json:"rawThreshold"`       // Ranges up to this many samples skip downsampling, 0 for 2000 or maxPoints
 }
 
-// Add these constants at the top
+// Caps on the number of points returned per file, overridable through the
+// NOVACAL_MAX_PLOT_POINTS and NOVACAL_MAX_FFT_POINTS environment variables
+var (
+	maxPlotPoints = envInt("NOVACAL_MAX_PLOT_POINTS", 50000)
+	maxFFTPoints  = envInt("NOVACAL_MAX_FFT_POINTS", 40000)
+)
+
+// Maximum number of samples to process at once, overridable through
+// NOVACAL_MAX_SAMPLES. Plot reads over larger ranges skip samples instead;
+// analyses that need every sample reject them. Compressed files may not
+// decompress to more than this many float32 samples.
+var maxSamples = envInt("NOVACAL_MAX_SAMPLES", 1000000)
+
+// Maximum number of FIR coefficients applyFIR accepts, overridable through
+// NOVACAL_MAX_FIR_TAPS. Filtering costs one multiply per tap and sample.
+var maxFIRTaps = envInt("NOVACAL_MAX_FIR_TAPS", 65536)
+
+// Number of float32 samples read per chunk from calibration files,
+// overridable through NOVACAL_CHUNK_SAMPLES
+var chunkSamples = envInt("NOVACAL_CHUNK_SAMPLES", 65536)
+
+// Largest WebSocket message or REST body accepted, overridable through
+// NOVACAL_MAX_MESSAGE_MB; larger messages close the connection
+var maxMessageBytes = int64(envInt("NOVACAL_MAX_MESSAGE_MB", 16)) << 20
+
+// Requests a connection may have waiting behind the running one, overridable
+// through NOVACAL_QUEUE_SIZE; further requests are refused with ErrBusy
+var requestQueueSize = envInt("NOVACAL_QUEUE_SIZE", 64)
+
+// WebSocket keepalive timing. A client that answers no ping within pongWait
+// is treated as dead and disconnected.
 const (
-	maxSamples = 1000000 // Maximum number of samples to process at once
-	bufferSize = 4096    // Size of read buffer
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+	writeWait  = 10 * time.Second
+)
+
+// envInt reads a positive integer from the environment, falling back to def
+func envInt(name string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return def
+	}
+	return value
+}
+
+// phaseScale returns the factor converting phases from the native unit of a
+// result to the requested unit. An empty unit means radians, which changed
+// the default of calibration and transfer function phases from degrees.
+func phaseScale(native, requested string) (float64, error) {
+	if requested == "" {
+		requested = "rad"
+	}
+	if requested == native {
+		return 1, nil
+	}
+	switch requested {
+	case "deg":
+		return 180 / math.Pi, nil
+	case "rad":
+		return math.Pi / 180, nil
+	default:
+		return 0, fmt.Errorf("unknown phase unit: %s", requested)
+	}
+}
+
+// convertPhases scales phases in place from the native unit to the requested one
+func convertPhases(phases []float64, native, requested string) error {
+	scale, err := phaseScale(native, requested)
+	if err != nil {
+		return err
+	}
+	for i := range phases {
+		phases[i] *= scale
+	}
+	return nil
+}
+
+// pointLimit returns the effective points cap for a request, letting the
+// client lower the server cap but never raise it
+func pointLimit(requested, serverMax int) int {
+	if requested > 0 && requested < serverMax {
+		return requested
+	}
+	return serverMax
+}
+
+// Open WebSocket connections, closed cleanly on shutdown
+var (
+	connectionsMutex sync.Mutex
+	connections      = make(map[*websocket.Conn]bool)
 )
 
+func trackConnection(conn *websocket.Conn) {
+	connectionsMutex.Lock()
+	defer connectionsMutex.Unlock()
+	connections[conn] = true
+}
+
+func untrackConnection(conn *websocket.Conn) {
+	connectionsMutex.Lock()
+	defer connectionsMutex.Unlock()
+	delete(connections, conn)
+}
+
+func connectionCount() int {
+	connectionsMutex.Lock()
+	defer connectionsMutex.Unlock()
+	return len(connections)
+}
+
+// sendClose sends a close frame so the client can tell why the connection
+// ended. The server uses 1001 (going away) on shutdown and when a client
+// stops answering pings, and 1009 (message too big) for oversized messages;
+// clients should reconnect after any code other than 1000 (normal closure).
+func sendClose(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+}
+
+// closeAllConnections sends a close frame to every client and closes the
+// underlying connections
+func closeAllConnections() {
+	connectionsMutex.Lock()
+	defer connectionsMutex.Unlock()
+
+	for conn := range connections {
+		sendClose(conn, websocket.CloseGoingAway, "server shutting down")
+		conn.Close()
+	}
+}
+
 // Add a mutex to protect WebSocket writes
 var wsWriteMutex sync.Mutex
 
+// sendError sends an error message with a machine-readable code
+func sendError(conn jsonWriter, code, message string) error {
+	return safeWriteJSON(conn, Message{
+		Type:      "error",
+		Message:   message,
+		ErrorCode: code,
+	})
+}
+
+// fileErrorCode distinguishes missing files and oversized ranges from other
+// read failures
+func fileErrorCode(err error) string {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrFileNotFound
+	}
+	if errors.Is(err, timeseries.ErrRangeTooLong) {
+		return ErrInvalidRequest
+	}
+	return ErrReadError
+}
+
+// rootDir confines every path a client may read or write. It is set through
+// NOVACAL_ROOT_DIR; when empty, access is unrestricted as for a local install.
+var rootDir = configuredRoot()
+
+func configuredRoot() string {
+	root := os.Getenv("NOVACAL_ROOT_DIR")
+	if root == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		log.Fatalf("Invalid NOVACAL_ROOT_DIR %q: %v", root, err)
+	}
+	return abs
+}
+
+// resolvePath returns the absolute, cleaned form of path, rejecting paths
+// that escape rootDir
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if rootDir == "" {
+		return abs, nil
+	}
+
+	// Symlinks inside the root may point outside it, so compare real paths
+	resolved, err := realPath(abs)
+	if err != nil {
+		return "", fmt.Errorf("access denied: cannot resolve %s: %v", path, err)
+	}
+	root, err := realPath(rootDir)
+	if err != nil {
+		return "", fmt.Errorf("access denied: cannot resolve the allowed root directory: %v", err)
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("access denied: %s is outside the allowed root directory", path)
+	}
+	return abs, nil
+}
+
+// realPath returns path with every symlink resolved. Trailing components that
+// do not exist yet, such as a new output file, are kept below the real path
+// of their nearest existing parent; a dangling link is followed to its target.
+func realPath(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return resolved, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	if target, err := os.Readlink(path); err == nil {
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		return realPath(target)
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path, nil
+	}
+	realParent, err := realPath(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(realParent, filepath.Base(path)), nil
+}
+
+// checkPaths verifies that every non-empty path stays within rootDir
+func checkPaths(paths ...string) error {
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if _, err := resolvePath(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonWriter is implemented by *websocket.Conn and requestConn
+type jsonWriter interface {
+	WriteJSON(v interface{}) error
+}
+
 // Create a safe write method
-func safeWriteJSON(conn *websocket.Conn, v interface{}) error {
+func safeWriteJSON(conn jsonWriter, v interface{}) error {
 	wsWriteMutex.Lock()
 	defer wsWriteMutex.Unlock()
 	return conn.WriteJSON(v)
 }
 
+// requestConn tags every message written for a request, including progress
+// and error messages, with the client-supplied request id
+type requestConn struct {
+	*websocket.Conn
+	requestID string
+}
+
+func (c *requestConn) WriteJSON(v interface{}) error {
+	if c.requestID == "" {
+		return c.Conn.WriteJSON(v)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	id, err := json.Marshal(c.requestID)
+	if err != nil {
+		return err
+	}
+
+	// Splice the id into the top-level object rather than re-encoding large payloads
+	if len(data) < 2 || data[0] != '{' {
+		return fmt.Errorf("cannot add a request id to a non-object message")
+	}
+	tagged := make([]byte, 0, len(data)+len(id)+16)
+	tagged = append(tagged, `{"requestId":`...)
+	tagged = append(tagged, id...)
+	if len(data) > 2 {
+		tagged = append(tagged, ',')
+	}
+	tagged = append(tagged, data[1:]...)
+	return c.Conn.WriteMessage(websocket.TextMessage, tagged)
+}
+
 // findAvailablePort tries to find an available port starting from the given port
 func findAvailablePort(startPort int) (int, error) {
 	for port := startPort; port < startPort+100; port++ {
@@ -88,6 +446,16 @@ func findAvailablePort(startPort int) (int, error) {
 }
 
 func main() {
+	if name := os.Getenv("NOVACAL_LOG_LEVEL"); name != "" {
+		level, err := logging.ParseLevel(name)
+		if err != nil {
+			log.Fatalf("Invalid NOVACAL_LOG_LEVEL: %v", err)
+		}
+		logging.SetLevel(level)
+	}
+	timeseries.SetCacheLimit(int64(envInt("NOVACAL_CACHE_MB", timeseries.DefaultCacheBytes>>20)) << 20)
+	timeseries.SetDecompressLimit(int64(maxSamples) * 4)
+
 	// Try to find an available port starting from 8080
 	port, err := findAvailablePort(8080)
 	if err != nil {
@@ -95,167 +463,291 @@ func main() {
 	}
 
 	addr := fmt.Sprintf(":%d", port)
-	log.Printf("Starting Go backend server on http://localhost%s", addr)
+	logging.Infof("Starting Go backend server on http://localhost%s", addr)
+	portFile := announcePort(port)
+	if portFile != "" {
+		defer os.Remove(portFile)
+	}
 
 	http.HandleFunc("/ws", handleWebSocket)
-	if err := http.ListenAndServe(addr, nil); err != nil {
+	registerREST(http.DefaultServeMux)
+	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "ok",
+			"port":   port,
+		})
+	})
+
+	server := &http.Server{Addr: addr}
+
+	// Shut down cleanly when the desktop shell stops the backend
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		sig := <-signals
+		logging.Infof("Received %v, shutting down", sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Hijacked WebSocket connections are not closed by Shutdown
+		closeAllConnections()
+		if err := server.Shutdown(ctx); err != nil {
+			logging.Errorf("Shutdown error: %v", err)
+		}
+	}()
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatal("Server error:", err)
 	}
+	logging.Infof("Server stopped")
+}
+
+// Name of the file written next to the executable with the chosen port
+const portFileName = "novacal.port"
+
+// announcePort makes the chosen port discoverable by the frontend, both as a
+// machine-parseable stdout line and as a file next to the executable. It
+// returns the path of the port file, or "" if it could not be written.
+func announcePort(port int) string {
+	fmt.Printf("NOVACAL_PORT=%d\n", port)
+
+	dir := GetExecutablePath()
+	if dir == "" {
+		return ""
+	}
+	path := filepath.Join(dir, portFileName)
+	if err := os.WriteFile(path, []byte(strconv.Itoa(port)), 0644); err != nil {
+		logging.Errorf("Error writing port file: %v", err)
+		return ""
+	}
+	return path
 }
 
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("Upgrade error:", err)
+		logging.Errorf("Upgrade error: %v", err)
 		return
 	}
 	defer conn.Close()
 
-	log.Println("New client connected")
+	trackConnection(conn)
+	defer untrackConnection(conn)
+
+	logging.Infof("New client connected")
+
+	// Bound message sizes, and drop clients that stop answering pings
+	conn.SetReadLimit(maxMessageBytes)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	// Client pings also show it is alive; answer them like the default handler
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(writeWait))
+		if errors.Is(err, websocket.ErrCloseSent) {
+			return nil
+		}
+		return err
+	})
+	stopPings := make(chan struct{})
+	defer close(stopPings)
+	go func() {
+		ticker := time.NewTicker(pingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+					return
+				}
+			case <-stopPings:
+				return
+			}
+		}
+	}()
+
+	// Requests run in order on a worker so job control messages can still be
+	// read and handled while a long job is in progress
+	type queuedMessage struct {
+		messageType int
+		data        []byte
+	}
+	queue := make(chan queuedMessage, requestQueueSize)
+	defer close(queue)
+	defer jobs.resumePausedBy(conn)
+	defer watchers.stop(conn, "")
+	defer lastBrowsed.forget(conn)
+	go func() {
+		for m := range queue {
+			handleMessage(conn, m.messageType, m.data)
+		}
+	}()
 
 	for {
 		messageType, message, err := conn.ReadMessage()
 		if err != nil {
-			log.Println("Read error:", err)
+			var netErr net.Error
+			switch {
+			case errors.Is(err, websocket.ErrReadLimit):
+				// The websocket library has already sent a 1009 close frame
+				logging.Warnf("Closing connection: message exceeds %d bytes", maxMessageBytes)
+			case errors.As(err, &netErr) && netErr.Timeout():
+				logging.Warnf("Closing connection: client stopped responding to pings")
+				sendClose(conn, websocket.CloseGoingAway, "ping timeout")
+			case websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway):
+				// The default close handler has echoed the client's close code
+				logging.Infof("Client disconnected")
+			default:
+				logging.Infof("Read error: %v", err)
+			}
 			break
 		}
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		if isJobControl(message) {
+			handleMessage(conn, messageType, message)
+			continue
+		}
+		// Refuse rather than block when the queue is full, since blocking
+		// would stop pongs and job control messages being read
+		select {
+		case queue <- queuedMessage{messageType, message}:
+		default:
+			var msg struct {
+				RequestID string `json:"requestId"`
+			}
+			json.Unmarshal(message, &msg)
+			logging.Warnf("Request queue full, refusing request")
+			sendError(&requestConn{Conn: conn, requestID: msg.RequestID}, ErrBusy,
+				fmt.Sprintf("Server busy: %d requests already queued", requestQueueSize))
+		}
+	}
+}
 
-		handleMessage(conn, messageType, message)
+// isJobControl reports whether a message controls running jobs and so must
+// bypass the request queue
+func isJobControl(message []byte) bool {
+	var msg struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return false
+	}
+	switch msg.Type {
+	case "listJobs", "pauseJob", "resumeJob":
+		return true
 	}
+	return false
 }
 
-func handleMessage(conn *websocket.Conn, messageType int, message []byte) {
+func handleMessage(wsConn *websocket.Conn, messageType int, message []byte) {
 	var msg struct {
-		Type  string   `json:"type"`
-		Files []string `json:"files"`
-		Path  string   `json:"path"`
+		Type      string   `json:"type"`
+		Files     []string `json:"files"`
+		Path      string   `json:"path"`
+		RequestID string   `json:"requestId"` // Echoed in every response to this request
+		BaseDir   string   `json:"baseDir"`   // Resolves relative paths, see fileBase
 	}
 
 	if err := json.Unmarshal(message, &msg); err != nil {
-		log.Println("Error parsing message:", err)
+		logging.Errorf("Error parsing message: %v", err)
 		return
 	}
 
+	conn := &requestConn{Conn: wsConn, requestID: msg.RequestID}
+	base := fileBase(msg.BaseDir, lastBrowsed.get(wsConn))
+
 	switch msg.Type {
 	case "listDirectory":
-		files, err := listDirectory(msg.Path)
-		if err != nil {
-			log.Println("Error listing directory:", err)
+		var dirReq DirectoryRequest
+		if err := json.Unmarshal(message, &dirReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid directory request format")
 			return
 		}
 
-		response := DirectoryResponse{
-			Type:  "directoryContents",
-			Files: files,
-		}
-
-		if err := safeWriteJSON(conn, response); err != nil {
-			log.Println("Write error:", err)
-		}
-	case "plot":
-		var plotReq PlotRequest
-		if err := json.Unmarshal(message, &plotReq); err != nil {
-			safeWriteJSON(conn, Message{
-				Type:    "error",
-				Message: "Invalid plot request format",
-			})
+		if err := resolveRequestPaths(base, &dirReq.Path); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
 			return
 		}
 
-		if len(plotReq.Files) == 0 {
-			safeWriteJSON(conn, Message{
-				Type:    "error",
-				Message: "No files selected for plotting",
-			})
+		files, err := listDirectory(dirReq)
+		if err != nil {
+			logging.Errorf("Error listing directory: %v", err)
+			sendError(conn, fileErrorCode(err), fmt.Sprintf("Error listing directory: %v", err))
 			return
 		}
-
-		// Filter for .bin files
-		var binFiles []string
-		for _, file := range plotReq.Files {
-			if filepath.Ext(file) == ".bin" {
-				binFiles = append(binFiles, file)
+		if dirReq.Path != "" {
+			if dir, err := resolvePath(dirReq.Path); err == nil {
+				dirHistory.visit(dir)
+				lastBrowsed.set(wsConn, dir)
 			}
 		}
 
-		if len(binFiles) == 0 {
-			safeWriteJSON(conn, Message{
-				Type:    "error",
-				Message: "No .bin files selected",
-			})
-			return
+		response := DirectoryResponse{
+			Type:  "directoryContents",
+			Files: files,
 		}
 
-		// If this is the initial plot request (startIndex and endIndex are 0)
-		if plotReq.StartIndex == 0 && plotReq.EndIndex == 0 {
-			// Get total length first
-			totalLength, err := timeseries.GetTotalFileLength(binFiles)
-			if err != nil {
-				safeWriteJSON(conn, Message{
-					Type:    "error",
-					Message: fmt.Sprintf("Error getting file length: %v", err),
-				})
-				return
-			}
-			plotReq.EndIndex = int(totalLength)
+		if err := safeWriteJSON(conn, response); err != nil {
+			logging.Errorf("Write error: %v", err)
 		}
-
-		// Read and downsample the data
-		fileData, err := timeseries.ReadAndDownsample(
-			binFiles,
-			plotReq.StartIndex,
-			plotReq.EndIndex,
-			plotReq.DecimationFactor,
-		)
-		if err != nil {
-			safeWriteJSON(conn, Message{
-				Type:    "error",
-				Message: fmt.Sprintf("Error reading files: %v", err),
-			})
+	case "recentDirs":
+		recent, pinned := dirHistory.list()
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":   "recentDirs",
+			"recent": recent,
+			"pinned": pinned,
+		})
+	case "pinDir":
+		var pinReq struct {
+			Type   string `json:"type"`
+			Path   string `json:"path"`
+			Pinned bool   `json:"pinned"` // false removes the favourite
+		}
+		if err := json.Unmarshal(message, &pinReq); err != nil || pinReq.Path == "" {
+			sendError(conn, ErrInvalidRequest, "Invalid pin request format")
 			return
 		}
-
-		// Send the plot data back to the client
-		plotData := struct {
-			Type  string                `json:"type"`
-			Files []timeseries.FileData `json:"files"`
-		}{
-			Type:  "plotData",
-			Files: fileData,
+		dir, err := resolveFilePath(pinReq.Path, base)
+		if err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
 		}
+		dirHistory.pin(dir, pinReq.Pinned)
 
-		if err := safeWriteJSON(conn, plotData); err != nil {
-			log.Println("Error sending plot data:", err)
-		}
+		recent, pinned := dirHistory.list()
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":   "recentDirs",
+			"recent": recent,
+			"pinned": pinned,
+		})
+	case "plot":
+		handlePlot(conn, message)
 	case "getTotalLength":
 		var lengthReq struct {
-			Type  string   `json:"type"`
-			Files []string `json:"files"`
+			Type        string   `json:"type"`
+			Files       []string `json:"files"`
+			HeaderBytes int64    `json:"headerBytes"`
 		}
 		if err := json.Unmarshal(message, &lengthReq); err != nil {
-			safeWriteJSON(conn, Message{
-				Type:    "error",
-				Message: "Invalid length request format",
-			})
+			sendError(conn, ErrInvalidRequest, "Invalid length request format")
 			return
 		}
 
 		// Validate file paths
-		validPaths, err := validateFilePaths(lengthReq.Files)
+		validPaths, err := validateFilePaths(lengthReq.Files, base)
 		if err != nil {
-			safeWriteJSON(conn, Message{
-				Type:    "error",
-				Message: fmt.Sprintf("Error validating files: %v", err),
-			})
+			sendError(conn, ErrFileNotFound, fmt.Sprintf("Error validating files: %v", err))
 			return
 		}
 
-		totalLength, err := timeseries.GetTotalFileLength(validPaths)
+		totalLength, err := timeseries.GetTotalFileLength(validPaths, lengthReq.HeaderBytes)
 		if err != nil {
-			safeWriteJSON(conn, Message{
-				Type:    "error",
-				Message: fmt.Sprintf("Error getting file length: %v", err),
-			})
+			sendError(conn, fileErrorCode(err), fmt.Sprintf("Error getting file length: %v", err))
 			return
 		}
 
@@ -268,378 +760,2395 @@ func handleMessage(conn *websocket.Conn, messageType int, message []byte) {
 		}
 
 		if err := safeWriteJSON(conn, response); err != nil {
-			log.Println("Write error:", err)
+			logging.Errorf("Write error: %v", err)
 		}
-	case "calibrate":
-		var calibrationReq struct {
-			Type string `json:"type"`
-			Data []struct {
-				Station   string  `json:"station"`
-				FullPath  string  `json:"fullPath"`
-				Waveform  string  `json:"waveform"`
-				Frequency float64 `json:"frequency"`
-				Tx        string  `json:"tx"`
-				Rx        string  `json:"rx"`
-				Coil      string  `json:"coil"`
-			} `json:"data"`
+	case "detectDataType":
+		var detectReq struct {
+			Type  string   `json:"type"`
+			Files []string `json:"files"`
 		}
-
-		log.Printf("Received calibration request")
-
-		if err := json.Unmarshal(message, &calibrationReq); err != nil {
-			log.Printf("Error unmarshaling calibration request: %v", err)
-			safeWriteJSON(conn, Message{
-				Type:    "error",
-				Message: "Invalid calibration request format",
-			})
+		if err := json.Unmarshal(message, &detectReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid detect request format")
 			return
 		}
 
-		log.Printf("Calibration data: %+v", calibrationReq.Data)
-
-		// Organize data for calibration
-		sineFilePaths := make(map[string]map[float64]map[string]string)
-		squareFilePaths := make(map[string]map[float64]map[string]string)
+		validPaths, err := validateFilePaths(detectReq.Files, base)
+		if err != nil {
+			sendError(conn, ErrFileNotFound, fmt.Sprintf("Error validating files: %v", err))
+			return
+		}
 
-		for _, item := range calibrationReq.Data {
-			var targetMap map[string]map[float64]map[string]string
-			if item.Waveform == "Sine" {
-				targetMap = sineFilePaths
-			} else {
-				targetMap = squareFilePaths
+		type detectedFile struct {
+			Path           string `json:"path"`
+			DataType       string `json:"dataType"`
+			BytesPerSample int    `json:"bytesPerSample"`
+			NumSamples     int64  `json:"numSamples"`
+		}
+		detected := make([]detectedFile, 0, len(validPaths))
+		for _, path := range validPaths {
+			dataType, err := timeseries.DetectDataType(path)
+			if err != nil {
+				sendError(conn, fileErrorCode(err), fmt.Sprintf("Error detecting data type of %s: %v", path, err))
+				return
 			}
-
-			if _, exists := targetMap[item.Coil]; !exists {
-				targetMap[item.Coil] = make(map[float64]map[string]string)
+			size, err := timeseries.DataSize(path)
+			if err != nil {
+				sendError(conn, fileErrorCode(err), fmt.Sprintf("Error reading %s: %v", path, err))
+				return
 			}
-			if _, exists := targetMap[item.Coil][item.Frequency]; !exists {
-				targetMap[item.Coil][item.Frequency] = make(map[string]string)
+			bytesPerSample := 4
+			if dataType == "float64" {
+				bytesPerSample = 8
 			}
-
-			targetMap[item.Coil][item.Frequency]["tx"] = item.Tx
-			targetMap[item.Coil][item.Frequency]["rx"] = item.Rx
-		}
-
-		log.Printf("Running calibration with sine files: %+v and square files: %+v", sineFilePaths, squareFilePaths)
-
-		// Create progress callback
-		progressCallback := func(progress int) {
-			safeWriteJSON(conn, map[string]interface{}{
-				"type":     "calibrationProgress",
-				"progress": progress,
+			detected = append(detected, detectedFile{
+				Path:           path,
+				DataType:       dataType,
+				BytesPerSample: bytesPerSample,
+				NumSamples:     size / int64(bytesPerSample),
 			})
 		}
 
-		// Run calibration with RunCalibration instead of Calibrate
-		results, err := calibration.RunCalibration(sineFilePaths, squareFilePaths, progressCallback)
-		if err != nil {
-			log.Printf("Calibration error: %v", err)
-			safeWriteJSON(conn, Message{
-				Type:    "error",
-				Message: fmt.Sprintf("Calibration failed: %v", err),
-			})
-			return
+		if err := safeWriteJSON(conn, map[string]interface{}{
+			"type":  "dataTypes",
+			"files": detected,
+		}); err != nil {
+			logging.Errorf("Write error: %v", err)
 		}
-
-		log.Printf("Calibration completed, results: %+v", results)
-
-		// Send the actual results
-		safeWriteJSON(conn, map[string]interface{}{
-			"type":    "calibrationComplete",
-			"results": results,
-		})
-	case "checkConfig":
-		var configReq struct {
-			Type string `json:"type"`
-			Path string `json:"path"`
+	case "fileInfo":
+		var infoReq struct {
+			Type        string   `json:"type"`
+			Files       []string `json:"files"`
+			DataType    string   `json:"dataType"`    // "float32" or "float64", detected per file when empty
+			HeaderBytes int64    `json:"headerBytes"` // Excluded from the sample count
+			NumChannels int      `json:"numChannels"` // Interleaved channels, samples count frames
+			SampleRate  float64  `json:"sampleRate"`  // Adds the duration in seconds when set
 		}
-		if err := json.Unmarshal(message, &configReq); err != nil {
-			safeWriteJSON(conn, Message{
-				Type:    "error",
-				Message: "Invalid config check request",
-			})
+		if err := json.Unmarshal(message, &infoReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid file info request format")
 			return
 		}
-
-		// Check for config.csv in the directory
-		configPath := filepath.Join(configReq.Path, "config.csv")
-		config, err := readConfigFile(configPath)
-		if err != nil {
-			log.Printf("No config file found at %s or error reading it: %v", configPath, err)
-			safeWriteJSON(conn, map[string]interface{}{
-				"type":    "configData",
-				"station": filepath.Base(configReq.Path),
-				"config":  map[string]interface{}{},
-			})
+		if infoReq.DataType != "" && infoReq.DataType != "float32" && infoReq.DataType != "float64" {
+			sendError(conn, ErrInvalidRequest, fmt.Sprintf("Unknown data type: %s", infoReq.DataType))
 			return
 		}
+		// Resolved like the files of getTotalLength and detectDataType, but
+		// missing files are reported rather than dropped
+		paths := make([]string, len(infoReq.Files))
+		for i, file := range infoReq.Files {
+			path, err := resolveFilePath(file, base)
+			if err != nil {
+				sendError(conn, ErrAccessDenied, err.Error())
+				return
+			}
+			paths[i] = path
+		}
 
-		// Send config data back to client
-		safeWriteJSON(conn, map[string]interface{}{
-			"type":    "configData",
-			"station": filepath.Base(configReq.Path),
-			"config":  config,
-		})
-	case "calculateFIR":
-		var firReq struct {
-			Type string `json:"type"`
-			Data []struct {
-				Station       string  `json:"station"`
-				FullPath      string  `json:"fullPath"`
-				CoilName      string  `json:"coilName"`
-				BaseFrequency float64 `json:"baseFrequency"`
-				SampleRate    float64 `json:"sampleRate"`
-				CoilChannel   string  `json:"coilChannel"`
-			} `json:"data"`
+		type fileDetails struct {
+			Path       string    `json:"path"`
+			Exists     bool      `json:"exists"`
+			Readable   bool      `json:"readable"`
+			IsDir      bool      `json:"isDir"`
+			Size       int64     `json:"size"` // Bytes on disk
+			Compressed bool      `json:"compressed"`
+			Modified   time.Time `json:"modified"`
+			DataType   string    `json:"dataType,omitempty"`
+			Samples    int64     `json:"samples"`            // Per channel, after the header
+			Duration   float64   `json:"duration,omitempty"` // Seconds at sampleRate
+			Empty      bool      `json:"empty"`              // No samples after the header
+			Error      string    `json:"error,omitempty"`
+		}
+		details := make([]fileDetails, 0, len(paths))
+		for _, path := range paths {
+			d := fileDetails{Path: path}
+			info, err := os.Stat(path)
+			if err != nil {
+				d.Error = err.Error()
+				details = append(details, d)
+				continue
+			}
+			d.Exists, d.IsDir, d.Size, d.Modified = true, info.IsDir(), info.Size(), info.ModTime()
+			if d.IsDir {
+				details = append(details, d)
+				continue
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				d.Error = err.Error()
+				details = append(details, d)
+				continue
+			}
+			file.Close()
+			d.Readable = true
+			d.Compressed = timeseries.IsCompressed(path)
+
+			d.DataType = infoReq.DataType
+			if d.DataType == "" {
+				if d.DataType, err = timeseries.DetectDataType(path); err != nil {
+					d.Error = err.Error()
+					details = append(details, d)
+					continue
+				}
+			}
+			size, err := timeseries.DataSize(path)
+			if err != nil {
+				d.Error = err.Error()
+				details = append(details, d)
+				continue
+			}
+			frameBytes := int64(4 * max(infoReq.NumChannels, 1))
+			if d.DataType == "float64" {
+				frameBytes *= 2
+			}
+			if size > infoReq.HeaderBytes {
+				d.Samples = (size - infoReq.HeaderBytes) / frameBytes
+			}
+			d.Empty = d.Samples == 0
+			if infoReq.SampleRate > 0 {
+				d.Duration = float64(d.Samples) / infoReq.SampleRate
+			}
+			details = append(details, d)
 		}
 
-		if err := json.Unmarshal(message, &firReq); err != nil {
-			log.Printf("Error unmarshaling FIR request: %v", err)
-			safeWriteJSON(conn, Message{
-				Type:    "error",
-				Message: "Invalid FIR calculation request",
-			})
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":  "fileInfo",
+			"files": details,
+		})
+	case "validateJob":
+		var validateReq struct {
+			Type string          `json:"type"`
+			Job  string          `json:"job"`  // "calibrate" or "calculateFIR"
+			Data json.RawMessage `json:"data"` // Same payload as the job request
+		}
+		if err := json.Unmarshal(message, &validateReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid validate request format")
 			return
 		}
 
-		log.Printf("Processing FIR request with data: %+v", firReq.Data)
-
-		// Process each FIR request sequentially
-		for _, item := range firReq.Data {
-			// Create progress callback for this item
-			progressCallback := func(progress int) {
-				safeWriteJSON(conn, map[string]interface{}{
-					"type":     "firProgress",
-					"station":  item.Station,
-					"progress": progress,
-				})
+		var diagnostics []FileDiagnostics
+		switch validateReq.Job {
+		case "calibrate":
+			var items []struct {
+				Station    string   `json:"station"`
+				Frequency  float64  `json:"frequency"`
+				Tx         string   `json:"tx"`
+				Rx         string   `json:"rx"`
+				SampleRate *float64 `json:"sampleRate"`
 			}
-
-			// Create FIR configuration from request data
-			config := fir.FIRConfig{
-				FilePath:      filepath.Join(item.FullPath, item.CoilChannel),
-				CoilName:      item.CoilName,
-				SampleRate:    item.SampleRate,
-				BaseFrequency: item.BaseFrequency,
-				Stabilization: 0.01, // Default stabilization value
+			if err := json.Unmarshal(validateReq.Data, &items); err != nil {
+				sendError(conn, ErrInvalidRequest, "Invalid calibration data")
+				return
 			}
+			for _, item := range items {
+				rate := calibration.DefaultSampleRate
+				if item.SampleRate != nil {
+					rate = *item.SampleRate
+				}
+				// Calibration files are float32 without a header and need at least one cycle
+				for _, file := range []struct{ role, path string }{{"tx", item.Tx}, {"rx", item.Rx}} {
+					resolveRequestPaths(base, &file.path) // diagnoseFile reports paths outside the root
+					diag := diagnoseFile(file.path, 0, 4, rate, item.Frequency, 1)
+					diag.Station = item.Station
+					diag.Role = file.role
+					diagnostics = append(diagnostics, diag)
+				}
+			}
+		case "calculateFIR":
+			var items []struct {
+				Station        string  `json:"station"`
+				FullPath       string  `json:"fullPath"`
+				CoilChannel    string  `json:"coilChannel"`
+				BaseFrequency  float64 `json:"baseFrequency"`
+				SampleRate     float64 `json:"sampleRate"`
+				CyclesToRead   int     `json:"cyclesToRead"`
+				ReadFullFile   bool    `json:"readFullFile"`
+				SettlingCycles int     `json:"settlingCycles"`
+				DataType       string  `json:"dataType"`
+				HeaderBytes    int64   `json:"headerBytes"`
+			}
+			if err := json.Unmarshal(validateReq.Data, &items); err != nil {
+				sendError(conn, ErrInvalidRequest, "Invalid FIR data")
+				return
+			}
+			for _, item := range items {
+				resolveRequestPaths(base, &item.FullPath) // diagnoseFile reports paths outside the root
+				config := fir.FIRConfig{
+					FilePath:       filepath.Join(item.FullPath, item.CoilChannel),
+					CyclesToRead:   item.CyclesToRead,
+					ReadFullFile:   item.ReadFullFile,
+					SettlingCycles: item.SettlingCycles,
+					DataType:       item.DataType,
+				}
+				sampleSize, err := config.SampleSize()
+				if err != nil {
+					diagnostics = append(diagnostics, FileDiagnostics{
+						Station:  item.Station,
+						Role:     "coil",
+						Path:     config.FilePath,
+						Problems: []string{err.Error()},
+					})
+					continue
+				}
+				diag := diagnoseFile(config.FilePath, item.HeaderBytes, sampleSize, item.SampleRate,
+					item.BaseFrequency, config.CyclesRequired())
+				diag.Station = item.Station
+				diag.Role = "coil"
+				diagnostics = append(diagnostics, diag)
+			}
+		default:
+			sendError(conn, ErrInvalidRequest, fmt.Sprintf("Unknown job type: %s", validateReq.Job))
+			return
+		}
 
-			log.Printf("Processing FIR for station %s with config: %+v", item.Station, config)
+		allOK := true
+		for _, diag := range diagnostics {
+			allOK = allOK && diag.OK
+		}
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":  "jobValidation",
+			"job":   validateReq.Job,
+			"ok":    allOK,
+			"files": diagnostics,
+		})
+	case "listJobs":
+		safeWriteJSON(conn, map[string]interface{}{
+			"type": "jobList",
+			"jobs": jobs.list(),
+		})
+	case "pauseJob", "resumeJob":
+		var controlReq struct {
+			Type  string `json:"type"`
+			JobID string `json:"jobId"`
+		}
+		if err := json.Unmarshal(message, &controlReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid job control request format")
+			return
+		}
 
-			// Process FIR with configuration and callback
-			result, err := fir.ProcessFIR(config, progressCallback)
-			if err != nil {
-				log.Printf("Error processing FIR for %s: %v", item.Station, err)
-				safeWriteJSON(conn, Message{
-					Type:    "error",
-					Message: fmt.Sprintf("Error processing FIR for %s: %v", item.Station, err),
-				})
-				continue
-			}
+		var err error
+		if controlReq.Type == "pauseJob" {
+			err = jobs.pause(controlReq.JobID, wsConn)
+		} else {
+			err = jobs.resume(controlReq.JobID)
+		}
+		if err != nil {
+			sendError(conn, ErrInvalidRequest, err.Error())
+			return
+		}
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":   "jobControl",
+			"jobId":  controlReq.JobID,
+			"paused": controlReq.Type == "pauseJob",
+		})
+	case "calibrate":
+		handleCalibrate(conn, message)
+	case "checkConfig":
+		var configReq struct {
+			Type string `json:"type"`
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal(message, &configReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid config check request")
+			return
+		}
 
-			log.Printf("FIR processing completed for %s", item.Station)
+		if err := resolveRequestPaths(base, &configReq.Path); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
 
-			// Send completion message with results
+		// Check for config.csv in the directory
+		configPath := filepath.Join(configReq.Path, "config.csv")
+		config, err := readConfigFile(configPath)
+		if err != nil {
+			logging.Warnf("No config file found at %s or error reading it: %v", configPath, err)
 			safeWriteJSON(conn, map[string]interface{}{
-				"type":    "firComplete",
-				"station": item.Station,
-				"results": result,
-				"message": fmt.Sprintf("FIR coefficients saved to %s/fir_results/fir_coefficients_%s.csv",
-					item.FullPath, item.CoilName),
+				"type":    "configData",
+				"station": filepath.Base(configReq.Path),
+				"config":  map[string]interface{}{},
 			})
+			return
+		}
+
+		// Send config data back to client, keeping the single-row shape
+		// for configs that list one coil
+		var configData interface{} = config
+		if len(config) == 1 {
+			configData = config[0]
 		}
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":    "configData",
+			"station": filepath.Base(configReq.Path),
+			"config":  configData,
+			"rows":    config,
+		})
+	case "calculateFIR":
+		handleCalculateFIR(conn, message)
 	case "exportCalibration":
 		var exportReq struct {
 			Type string `json:"type"`
 			Data struct {
-				Results    map[string]interface{} `json:"results"`
-				CSVData    string                 `json:"csvData"`
-				ExportPath string                 `json:"exportPath"`
+				Results    map[string]calibration.CalResults `json:"results"`
+				CSVData    string                            `json:"csvData"`
+				ExportPath string                            `json:"exportPath"`
+				PhaseUnit  string                            `json:"phaseUnit"`       // Unit of the result phases, "rad" (default) or "deg"
+				Sidecar    bool                              `json:"checksumSidecar"` // Also write <file>.sha256
 			} `json:"data"`
 		}
 		if err := json.Unmarshal(message, &exportReq); err != nil {
-			log.Printf("Error unmarshaling export request: %v", err)
+			logging.Errorf("Error unmarshaling export request: %v", err)
+			sendError(conn, ErrInvalidRequest, "Invalid export request format")
+			return
+		}
+
+		if err := resolveRequestPaths(base, &exportReq.Data.ExportPath); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+		phaseUnit := exportReq.Data.PhaseUnit
+		if phaseUnit == "" {
+			phaseUnit = "rad"
+		}
+		if _, err := phaseScale("rad", phaseUnit); err != nil {
+			sendError(conn, ErrInvalidRequest, err.Error())
 			return
 		}
 
 		// Write CSV file
 		csvPath := filepath.Join(exportReq.Data.ExportPath, "calibration_results.csv")
 		if err := os.WriteFile(csvPath, []byte(exportReq.Data.CSVData), 0644); err != nil {
-			log.Printf("Error writing CSV file: %v", err)
+			logging.Errorf("Error writing CSV file: %v", err)
+			sendError(conn, ErrWriteError, fmt.Sprintf("Error writing CSV file: %v", err))
 			return
 		}
 
 		// Save plots as PNG
-		// TODO: Implement plot saving
+		plotPaths, err := calibration.SavePlots(exportReq.Data.ExportPath, exportReq.Data.Results, phaseUnit)
+		if err != nil {
+			logging.Errorf("Error saving calibration plots: %v", err)
+			sendError(conn, ErrWriteError, fmt.Sprintf("Error saving calibration plots: %v", err))
+			return
+		}
+
+		checksum, err := fileChecksum(csvPath, exportReq.Data.Sidecar)
+		if err != nil {
+			sendError(conn, ErrWriteError, fmt.Sprintf("Error verifying CSV file: %v", err))
+			return
+		}
 
 		safeWriteJSON(conn, map[string]interface{}{
-			"type": "exportComplete",
-			"path": exportReq.Data.ExportPath,
+			"type":   "exportComplete",
+			"path":   exportReq.Data.ExportPath,
+			"plots":  plotPaths,
+			"sha256": checksum,
 		})
 	case "computeFFT":
-		log.Printf("Received FFT request")
-		var fftReq struct {
-			Type  string   `json:"type"`
-			Files []string `json:"files"`
+		handleComputeFFT(conn, message)
+	case "batchFFT":
+		batchJob := jobs.start("batchFFT")
+		defer jobs.finish(batchJob)
+
+		var batchReq struct {
+			Type        string  `json:"type"`
+			Directory   string  `json:"directory"`
+			Extension   string  `json:"extension"` // Files to transform, ".bin" by default
+			OutputDir   string  `json:"outputDir"`
+			Window      string  `json:"window"`
+			SampleRate  float64 `json:"sampleRate"`
+			HeaderBytes int64   `json:"headerBytes"`
+			FloorDb     float64 `json:"floorDb"`
+			MaxPoints   int     `json:"maxPoints"` // 0 writes every bin
+			ScaleFactor float64 `json:"scaleFactor"`
+			Offset      float64 `json:"offset"`
+			Precision   int     `json:"precision"` // Significant digits written, 0 for 6, negative for full
+		}
+		if err := json.Unmarshal(message, &batchReq); err != nil || batchReq.Directory == "" || batchReq.OutputDir == "" {
+			sendError(conn, ErrInvalidRequest, "Invalid batch FFT request format")
+			return
+		}
+		if err := resolveRequestPaths(base, &batchReq.Directory, &batchReq.OutputDir); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+		if batchReq.Extension == "" {
+			batchReq.Extension = ".bin"
+		}
+		if batchReq.SampleRate == 0 {
+			batchReq.SampleRate = calibration.DefaultSampleRate
+		}
+
+		entries, err := os.ReadDir(batchReq.Directory)
+		if err != nil {
+			sendError(conn, fileErrorCode(err), fmt.Sprintf("Error reading directory: %v", err))
+			return
+		}
+		var files []string
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), batchReq.Extension) {
+				files = append(files, filepath.Join(batchReq.Directory, entry.Name()))
+			}
+		}
+		if len(files) == 0 {
+			sendError(conn, ErrFileNotFound, fmt.Sprintf("No %s files found in %s", batchReq.Extension, batchReq.Directory))
+			return
+		}
+		if err := os.MkdirAll(batchReq.OutputDir, 0755); err != nil {
+			sendError(conn, ErrWriteError, fmt.Sprintf("Error creating output directory: %v", err))
+			return
+		}
+
+		opts := fft.FFTOptions{
+			Window:  batchReq.Window,
+			FloorDb: batchReq.FloorDb,
+			Scale:   batchReq.ScaleFactor,
+			Offset:  batchReq.Offset,
 		}
-		if err := json.Unmarshal(message, &fftReq); err != nil {
-			log.Printf("Error unmarshaling FFT request: %v", err)
-			safeWriteJSON(conn, Message{
-				Type:    "error",
-				Message: "Invalid FFT request format",
+		var written []string
+		failures := make(map[string]string)
+		for i, file := range files {
+			if err := jobs.checkpoint(batchJob); err != nil {
+				sendError(conn, ErrTimeout, fmt.Sprintf("Batch FFT stopped after %d of %d files: %v", i, len(files), err))
+				return
+			}
+			name := filepath.Base(file)
+			outputPath := filepath.Join(batchReq.OutputDir, strings.TrimSuffix(name, filepath.Ext(name))+"_fft.csv")
+
+			data, err := timeseries.ReadChannelRangeLimit(file, 0, 0, 1, 0, batchReq.HeaderBytes, maxSamples)
+			if err == nil {
+				var result *fft.FFTResult
+				if result, err = fft.ComputeFFTWithOptions(data, batchReq.SampleRate, opts); err == nil {
+					fft.LimitPoints(result, batchReq.MaxPoints)
+					err = fft.ExportCSV(outputPath, result, batchReq.Precision)
+				}
+			}
+			if err != nil {
+				logging.Errorf("Batch FFT failed for %s: %v", file, err)
+				failures[name] = err.Error()
+			} else {
+				written = append(written, outputPath)
+			}
+
+			safeWriteJSON(conn, map[string]interface{}{
+				"type":     "batchFFTProgress",
+				"file":     name,
+				"progress": (i + 1) * 100 / len(files),
 			})
+		}
+
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":     "batchFFTComplete",
+			"outputs":  written,
+			"failures": failures,
+		})
+	case "findPeaks":
+		var peaksReq struct {
+			Type         string   `json:"type"`
+			Files        []string `json:"files"`
+			Window       string   `json:"window"`
+			MinFreq      float64  `json:"minFreq"`
+			MaxFreq      float64  `json:"maxFreq"`      // 0 searches up to Nyquist
+			ProminenceDb float64  `json:"prominenceDb"` // Minimum rise above the surrounding floor
+			MaxPeaks     int      `json:"maxPeaks"`     // 0 returns every peak
+			HeaderBytes  int64    `json:"headerBytes"`
+			FloorDb      float64  `json:"floorDb"` // dB floor, defaults to -120
+			ScaleFactor  float64  `json:"scaleFactor"`
+			Offset       float64  `json:"offset"`
+			Interpolate  bool     `json:"interpolate"` // Refine peaks between bins, raw bin peaks otherwise
+			SampleRate   float64  `json:"sampleRate"`  // Defaults to the calibration sample rate
+		}
+		if err := json.Unmarshal(message, &peaksReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid find peaks request format")
+			return
+		}
+		if err := resolveRequestFiles(base, peaksReq.Files); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
 			return
 		}
 
-		log.Printf("Computing FFT for files: %v", fftReq.Files)
+		if peaksReq.SampleRate == 0 {
+			peaksReq.SampleRate = calibration.DefaultSampleRate
+		}
+		if peaksReq.SampleRate < 0 {
+			sendError(conn, ErrInvalidRequest, fmt.Sprintf("Invalid sample rate %v", peaksReq.SampleRate))
+			return
+		}
 
-		// Process each file
-		results := make(map[string]*fft.FFTResult)
-		for _, file := range fftReq.Files {
-			data, err := timeseries.ReadBinaryFile(file)
+		peaks := make(map[string][][]float64)
+		for _, file := range peaksReq.Files {
+			data, err := timeseries.ReadChannelRangeLimit(file, 0, 0, 1, 0, peaksReq.HeaderBytes, maxSamples)
 			if err != nil {
-				log.Printf("Error reading file %s: %v", file, err)
-				continue
+				sendError(conn, fileErrorCode(err), fmt.Sprintf("Error reading %s: %v", filepath.Base(file), err))
+				return
 			}
 
-			log.Printf("Read %d samples from %s", len(data), file)
-			result, err := fft.ComputeFFT(data, 51200.0)
+			result, err := fft.ComputeFFTWithOptions(data, peaksReq.SampleRate, fft.FFTOptions{
+				Window:  peaksReq.Window,
+				FloorDb: peaksReq.FloorDb,
+				Scale:   peaksReq.ScaleFactor,
+				Offset:  peaksReq.Offset,
+			})
 			if err != nil {
-				log.Printf("Error computing FFT for file %s: %v", file, err)
-				continue
+				sendError(conn, ErrProcessingFailed, fmt.Sprintf("Error computing FFT for %s: %v", filepath.Base(file), err))
+				return
+			}
+			filePeaks := fft.FindPeaks(result, peaksReq.MinFreq, peaksReq.MaxFreq,
+				peaksReq.ProminenceDb, peaksReq.MaxPeaks)
+			if peaksReq.Interpolate {
+				filePeaks = fft.InterpolatePeaks(result, filePeaks)
 			}
+			peaks[filepath.Base(file)] = filePeaks
+		}
 
-			log.Printf("FFT computed successfully for %s", file)
-			log.Printf("FFT result contains %d frequencies and %d magnitudes",
-				len(result.Frequencies), len(result.Magnitudes))
-			results[filepath.Base(file)] = result
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":  "peaksResults",
+			"peaks": peaks,
+		})
+	case "compareFFT":
+		var compareReq struct {
+			Type        string  `json:"type"`
+			FileA       string  `json:"fileA"` // Reference, e.g. before a fix
+			FileB       string  `json:"fileB"`
+			Window      string  `json:"window"`
+			SampleRate  float64 `json:"sampleRate"`
+			SampleRateB float64 `json:"sampleRateB"` // Rate of fileB when it differs from sampleRate
+			HeaderBytes int64   `json:"headerBytes"`
+			MinFreq     float64 `json:"minFreq"`
+			MaxFreq     float64 `json:"maxFreq"`
+			FloorDb     float64 `json:"floorDb"`
+			ThresholdDb float64 `json:"thresholdDb"` // Bins differing by more are flagged, defaults to 3 dB
+			MaxPoints   int     `json:"maxPoints"`
+		}
+		if err := json.Unmarshal(message, &compareReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid FFT comparison request format")
+			return
+		}
+		if err := resolveRequestPaths(base, &compareReq.FileA, &compareReq.FileB); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+		if compareReq.SampleRate == 0 {
+			compareReq.SampleRate = calibration.DefaultSampleRate
+		}
+		if compareReq.SampleRateB == 0 {
+			compareReq.SampleRateB = compareReq.SampleRate
+		}
+		if compareReq.SampleRate < 0 || compareReq.SampleRateB < 0 {
+			sendError(conn, ErrInvalidRequest, "Sample rates must be positive")
+			return
+		}
+		if compareReq.ThresholdDb <= 0 {
+			compareReq.ThresholdDb = 3
+		}
+
+		var spectra [2]*fft.FFTResult
+		rates := [2]float64{compareReq.SampleRate, compareReq.SampleRateB}
+		for i, file := range []string{compareReq.FileA, compareReq.FileB} {
+			data, err := timeseries.ReadChannelRangeLimit(file, 0, 0, 1, 0, compareReq.HeaderBytes, maxSamples)
+			if err != nil {
+				sendError(conn, fileErrorCode(err), fmt.Sprintf("Error reading %s: %v", filepath.Base(file), err))
+				return
+			}
+			spectra[i], err = fft.ComputeFFTWithOptions(data, rates[i], fft.FFTOptions{
+				Window:  compareReq.Window,
+				MinFreq: compareReq.MinFreq,
+				MaxFreq: compareReq.MaxFreq,
+				FloorDb: compareReq.FloorDb,
+			})
+			if err != nil {
+				sendError(conn, ErrProcessingFailed, fmt.Sprintf("Error computing FFT for %s: %v", filepath.Base(file), err))
+				return
+			}
+		}
+
+		freqs, delta, err := fft.CompareFFT(spectra[0], spectra[1])
+		if err != nil {
+			sendError(conn, ErrProcessingFailed, fmt.Sprintf("Error comparing spectra: %v", err))
+			return
+		}
+
+		// Flag at full resolution, before the payload is reduced
+		var flagged []float64
+		maxDelta := 0.0
+		for i, d := range delta {
+			if math.Abs(d) > compareReq.ThresholdDb {
+				flagged = append(flagged, freqs[i])
+			}
+			maxDelta = math.Max(maxDelta, math.Abs(d))
+		}
+		freqs, delta = fft.LimitDelta(freqs, delta, pointLimit(compareReq.MaxPoints, maxFFTPoints))
+
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":         "fftComparison",
+			"frequencies":  freqs,
+			"deltaDb":      delta,
+			"flagged":      flagged, // Frequencies where |deltaDb| exceeds the threshold
+			"flaggedCount": len(flagged),
+			"maxDeltaDb":   maxDelta,
+			"thresholdDb":  compareReq.ThresholdDb,
+		})
+	case "generateFIR":
+		generateJob := jobs.start("generateFIR")
+		defer jobs.finish(generateJob)
+
+		var firReq struct {
+			Type      string `json:"type"`
+			PhaseUnit string `json:"phaseUnit"` // "rad" (default) or "deg"
+			Data      struct {
+				FilePath          string  `json:"filePath"`
+				CoilName          string  `json:"coilName"`
+				SampleRate        float64 `json:"sampleRate"`
+				BaseFrequency     float64 `json:"baseFrequency"`
+				Stabilization     float64 `json:"stabilization"`
+				CyclesToRead      int     `json:"cyclesToRead"`
+				ReadFullFile      bool    `json:"readFullFile"`
+				MaxCycles         int     `json:"maxCycles"`
+				SettlingCycles    int     `json:"settlingCycles"`
+				DataType          string  `json:"dataType"`
+				HeaderBytes       int64   `json:"headerBytes"`
+				RefinePeriod      string  `json:"refinePeriod"` // "zerocrossing" or "autocorrelation" to measure the cycle period
+				TargetWaveform    string  `json:"targetWaveform"`
+				Regularization    string  `json:"regularization"`
+				AutoStabilization bool    `json:"autoStabilization"`
+				SaveIntermediates bool    `json:"saveIntermediates"` // Also write stacked_<coil>.csv and perfect_<coil>.csv
+				Precision         int     `json:"precision"`         // Significant digits of those CSVs, 0 for 6, negative for full
+				OutputDir         string  `json:"outputDir"`         // Defaults to fir_results next to the input file
+			} `json:"data"`
+		}
+
+		if err := json.Unmarshal(message, &firReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid FIR request format")
+			return
+		}
+		if err := resolveRequestPaths(base, &firReq.Data.FilePath, &firReq.Data.OutputDir); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+
+		// Create progress callback
+		progressCallback := func(progress int) {
+			safeWriteJSON(conn, map[string]interface{}{
+				"type":     "firProgress",
+				"progress": progress,
+			})
+			jobs.checkpoint(generateJob)
+		}
+
+		// Create FIR configuration from request data
+		config := fir.FIRConfig{
+			FilePath:          firReq.Data.FilePath,
+			CoilName:          firReq.Data.CoilName,
+			SampleRate:        firReq.Data.SampleRate,
+			BaseFrequency:     firReq.Data.BaseFrequency,
+			Stabilization:     firReq.Data.Stabilization,
+			CyclesToRead:      firReq.Data.CyclesToRead,
+			ReadFullFile:      firReq.Data.ReadFullFile,
+			MaxCycles:         firReq.Data.MaxCycles,
+			SettlingCycles:    firReq.Data.SettlingCycles,
+			DataType:          firReq.Data.DataType,
+			HeaderBytes:       firReq.Data.HeaderBytes,
+			RefinePeriod:      firReq.Data.RefinePeriod,
+			TargetWaveform:    firReq.Data.TargetWaveform,
+			Regularization:    firReq.Data.Regularization,
+			AutoStabilization: firReq.Data.AutoStabilization,
+			SaveIntermediates: firReq.Data.SaveIntermediates,
+			Precision:         firReq.Data.Precision,
+			OutputDir:         firReq.Data.OutputDir,
+		}
+
+		if err := config.Validate(); err != nil {
+			sendError(conn, ErrInvalidRequest, fmt.Sprintf("Invalid FIR settings: %v", err))
+			return
+		}
+		if err := checkPaths(config.FilePath, config.ResultsDir()); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+
+		// Process FIR with configuration and callback
+		result, err := fir.ProcessFIRContext(generateJob.ctx, config, progressCallback)
+		if err != nil {
+			code := ErrFIRFailed
+			if generateJob.err() != nil {
+				code = ErrTimeout
+			}
+			sendError(conn, code, fmt.Sprintf("Error processing FIR: %v", err))
+			return
+		}
+		if err := convertPhases(result.ResponsePhase, "rad", firReq.PhaseUnit); err != nil {
+			sendError(conn, ErrInvalidRequest, err.Error())
+			return
+		}
+
+		// Send results back to client
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":    "firResults",
+			"results": result,
+		})
+
+	case "exportFIR":
+		var exportReq struct {
+			Type string `json:"type"`
+			Data struct {
+				CSVContent   string    `json:"csvContent"`
+				ExportPath   string    `json:"exportPath"`
+				FileName     string    `json:"fileName"`
+				Format       string    `json:"format"` // "csv" (default) or "bin"
+				Coefficients []float64 `json:"coefficients"`
+				SampleRate   float64   `json:"sampleRate"`
+				CoilName     string    `json:"coilName"`
+				Sidecar      bool      `json:"checksumSidecar"` // Also write <file>.sha256
+			} `json:"data"`
+		}
+
+		if err := json.Unmarshal(message, &exportReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid export request format")
+			return
+		}
+
+		if err := resolveRequestPaths(base, &exportReq.Data.ExportPath); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+		filePath := filepath.Join(exportReq.Data.ExportPath, exportReq.Data.FileName)
+		if err := checkPaths(filePath); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+		switch exportReq.Data.Format {
+		case "", "csv":
+			// Write CSV file with provided filename
+			if err := os.WriteFile(filePath, []byte(exportReq.Data.CSVContent), 0644); err != nil {
+				sendError(conn, ErrWriteError, fmt.Sprintf("Error writing CSV file: %v", err))
+				return
+			}
+		case "bin":
+			if len(exportReq.Data.Coefficients) == 0 {
+				sendError(conn, ErrInvalidRequest, "No FIR coefficients provided for binary export")
+				return
+			}
+			filePath = strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".bin"
+			if err := fir.ExportCoefficientsBinary(filePath, exportReq.Data.Coefficients,
+				exportReq.Data.SampleRate, exportReq.Data.CoilName); err != nil {
+				sendError(conn, ErrWriteError, fmt.Sprintf("Error writing binary file: %v", err))
+				return
+			}
+		default:
+			sendError(conn, ErrInvalidRequest, fmt.Sprintf("Unknown export format: %s", exportReq.Data.Format))
+			return
+		}
+
+		checksum, err := fileChecksum(filePath, exportReq.Data.Sidecar)
+		if err != nil {
+			sendError(conn, ErrWriteError, fmt.Sprintf("Error verifying exported file: %v", err))
+			return
+		}
+
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":   "exportComplete",
+			"path":   filePath,
+			"sha256": checksum,
+		})
+	case "settling":
+		var settlingReq struct {
+			Type        string   `json:"type"`
+			Files       []string `json:"files"`
+			StartIndex  int      `json:"startIndex"`
+			EndIndex    int      `json:"endIndex"`
+			Tolerance   float64  `json:"tolerance"`
+			SampleRate  float64  `json:"sampleRate"`
+			NumChannels int      `json:"numChannels"`
+			Channel     int      `json:"channel"`
+			HeaderBytes int64    `json:"headerBytes"`
+			ScaleFactor float64  `json:"scaleFactor"`
+			Offset      float64  `json:"offset"`
+		}
+		if err := json.Unmarshal(message, &settlingReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid settling request format")
+			return
+		}
+		if settlingReq.Tolerance == 0 {
+			settlingReq.Tolerance = 0.02 // Default 2% band
 		}
 
-		log.Printf("Sending FFT results back to client")
-		// Get map keys manually
-		keys := make([]string, 0, len(results))
-		for k := range results {
-			keys = append(keys, k)
+		if err := resolveRequestFiles(base, settlingReq.Files); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
 		}
-		log.Printf("Results map contains entries for: %v", strings.Join(keys, ", "))
 
-		// Send results back
-		if err := safeWriteJSON(conn, map[string]interface{}{
-			"type": "fftResults",
-			"data": results,
-		}); err != nil {
-			log.Printf("Error sending FFT results: %v", err)
-			return
-		}
-		// Log the structure being sent
-		if resultBytes, err := json.MarshalIndent(results, "", "  "); err == nil {
-			log.Printf("Sent FFT results structure: %s", string(resultBytes))
-		}
-	case "generateFIR":
-		var firReq struct {
-			Type string `json:"type"`
-			Data struct {
-				FilePath      string  `json:"filePath"`
-				CoilName      string  `json:"coilName"`
-				SampleRate    float64 `json:"sampleRate"`
-				BaseFrequency float64 `json:"baseFrequency"`
-				Stabilization float64 `json:"stabilization"`
-			} `json:"data"`
+		results := make(map[string]*timeseries.SettlingMetrics)
+		for _, file := range settlingReq.Files {
+			data, err := timeseries.ReadChannelRangeLimit(file, settlingReq.StartIndex, settlingReq.EndIndex,
+				settlingReq.NumChannels, settlingReq.Channel, settlingReq.HeaderBytes, maxSamples)
+			if err != nil {
+				sendError(conn, fileErrorCode(err), fmt.Sprintf("Error reading %s: %v", filepath.Base(file), err))
+				return
+			}
+
+			data = timeseries.Rescale(data, settlingReq.ScaleFactor, settlingReq.Offset)
+			metrics, err := timeseries.ComputeSettling(data, settlingReq.Tolerance, settlingReq.SampleRate)
+			if err != nil {
+				sendError(conn, ErrProcessingFailed, fmt.Sprintf("Error computing settling for %s: %v", filepath.Base(file), err))
+				return
+			}
+			results[filepath.Base(file)] = metrics
+		}
+
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":    "settlingResults",
+			"results": results,
+		})
+	case "crossCorrelate":
+		var correlateReq struct {
+			Type        string  `json:"type"`
+			FileA       string  `json:"fileA"`
+			FileB       string  `json:"fileB"`
+			StartIndex  int     `json:"startIndex"`
+			EndIndex    int     `json:"endIndex"`   // 0 reads to the end of the files
+			MaxLag      int     `json:"maxLag"`     // Samples, 0 for every lag
+			SampleRate  float64 `json:"sampleRate"` // Converts the best lag to seconds when set
+			NumChannels int     `json:"numChannels"`
+			Channel     int     `json:"channel"`
+			HeaderBytes int64   `json:"headerBytes"`
+			MaxPoints   int     `json:"maxPoints"`
+		}
+		if err := json.Unmarshal(message, &correlateReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid cross-correlation request format")
+			return
+		}
+		if err := resolveRequestPaths(base, &correlateReq.FileA, &correlateReq.FileB); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+
+		var signals [2][]float64
+		for i, file := range []string{correlateReq.FileA, correlateReq.FileB} {
+			data, err := timeseries.ReadChannelRangeLimit(file, correlateReq.StartIndex, correlateReq.EndIndex,
+				correlateReq.NumChannels, correlateReq.Channel, correlateReq.HeaderBytes, maxSamples)
+			if err != nil {
+				sendError(conn, fileErrorCode(err), fmt.Sprintf("Error reading %s: %v", filepath.Base(file), err))
+				return
+			}
+			signals[i] = data
+		}
+
+		// bestLag comes from every lag; only the returned curve is limited,
+		// with lags giving the lag of each value kept
+		correlation, bestLag := timeseries.CrossCorrelate(signals[0], signals[1], correlateReq.MaxLag)
+		maxLag := (len(correlation) - 1) / 2
+		lags := make([]float64, len(correlation))
+		for i := range lags {
+			lags[i] = float64(i - maxLag)
+		}
+		lags, correlation = timeseries.LimitPoints(lags, correlation, pointLimit(correlateReq.MaxPoints, maxPlotPoints))
+		response := map[string]interface{}{
+			"type":        "crossCorrelation",
+			"lags":        lags,
+			"correlation": correlation,
+			"maxLag":      maxLag,
+			"bestLag":     bestLag,
+		}
+		if correlateReq.SampleRate > 0 {
+			response["bestLagSeconds"] = float64(bestLag) / correlateReq.SampleRate
+		}
+		safeWriteJSON(conn, response)
+	case "watchFile":
+		var watchReq struct {
+			Type        string `json:"type"`
+			Path        string `json:"path"`
+			Interval    int    `json:"interval"` // Polling period in ms, 500 by default
+			HeaderBytes int64  `json:"headerBytes"`
+		}
+		if err := json.Unmarshal(message, &watchReq); err != nil || watchReq.Path == "" {
+			sendError(conn, ErrInvalidRequest, "Invalid watch request format")
+			return
+		}
+		if err := resolveRequestPaths(base, &watchReq.Path); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+		interval := defaultWatchInterval
+		if watchReq.Interval != 0 {
+			interval = time.Duration(watchReq.Interval) * time.Millisecond
+		}
+		if interval < minWatchInterval {
+			sendError(conn, ErrInvalidRequest, fmt.Sprintf("Watch interval must be at least %v", minWatchInterval))
+			return
+		}
+
+		// Updates keep the request id of the watch that produces them
+		err := watchers.start(wsConn, &fileWatch{
+			path:        watchReq.Path,
+			headerBytes: watchReq.HeaderBytes,
+			interval:    interval,
+			conn:        conn,
+			stop:        make(chan struct{}),
+		})
+		if err != nil {
+			sendError(conn, ErrInvalidRequest, err.Error())
+		}
+	case "unwatchFile":
+		var unwatchReq struct {
+			Type string `json:"type"`
+			Path string `json:"path"` // Empty stops every watch of this connection
+		}
+		if err := json.Unmarshal(message, &unwatchReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid unwatch request format")
+			return
+		}
+		resolveRequestPaths(base, &unwatchReq.Path) // A path outside the root was never watched
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":    "unwatchedFile",
+			"path":    unwatchReq.Path,
+			"stopped": watchers.stop(wsConn, unwatchReq.Path),
+		})
+	case "autoCorrelate":
+		var autoReq struct {
+			Type        string  `json:"type"`
+			File        string  `json:"file"`
+			StartIndex  int     `json:"startIndex"`
+			EndIndex    int     `json:"endIndex"`   // 0 reads to the end of the file
+			MaxLag      int     `json:"maxLag"`     // Samples, 0 for every lag
+			SampleRate  float64 `json:"sampleRate"` // Converts the period to seconds and Hz when set
+			NumChannels int     `json:"numChannels"`
+			Channel     int     `json:"channel"`
+			HeaderBytes int64   `json:"headerBytes"`
+			MaxPoints   int     `json:"maxPoints"`
+		}
+		if err := json.Unmarshal(message, &autoReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid autocorrelation request format")
+			return
+		}
+		if err := resolveRequestPaths(base, &autoReq.File); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+
+		data, err := timeseries.ReadChannelRangeLimit(autoReq.File, autoReq.StartIndex, autoReq.EndIndex,
+			autoReq.NumChannels, autoReq.Channel, autoReq.HeaderBytes, maxSamples)
+		if err != nil {
+			sendError(conn, fileErrorCode(err), fmt.Sprintf("Error reading %s: %v", filepath.Base(autoReq.File), err))
+			return
+		}
+
+		// The period comes from every lag; only the returned curve is limited,
+		// with lags giving the lag of each value kept
+		correlation, period := timeseries.AutoCorrelate(data, autoReq.MaxLag)
+		maxLag := len(correlation) - 1
+		lags := make([]float64, len(correlation))
+		for i := range lags {
+			lags[i] = float64(i)
+		}
+		lags, correlation = timeseries.LimitPoints(lags, correlation, pointLimit(autoReq.MaxPoints, maxPlotPoints))
+		response := map[string]interface{}{
+			"type":        "autoCorrelation",
+			"lags":        lags,
+			"correlation": correlation,
+			"maxLag":      maxLag,
+			"period":      period, // Samples, 0 when no period was found
+		}
+		if autoReq.SampleRate > 0 && period > 0 {
+			response["periodSeconds"] = float64(period) / autoReq.SampleRate
+			response["frequency"] = autoReq.SampleRate / float64(period)
+		}
+		safeWriteJSON(conn, response)
+	case "computeEnvelope":
+		var envelopeReq struct {
+			Type        string   `json:"type"`
+			Files       []string `json:"files"`
+			StartIndex  int      `json:"startIndex"`
+			EndIndex    int      `json:"endIndex"` // 0 reads to the end of each file
+			Method      string   `json:"method"`   // "rms" (default) or "hilbert" for the analytic envelope
+			Window      int      `json:"window"`   // Samples per RMS window
+			Hop         int      `json:"hop"`      // Samples between windows, 0 for the window length
+			SampleRate  float64  `json:"sampleRate"`
+			NumChannels int      `json:"numChannels"`
+			Channel     int      `json:"channel"`
+			HeaderBytes int64    `json:"headerBytes"`
+			MaxPoints   int      `json:"maxPoints"`
+		}
+		if err := json.Unmarshal(message, &envelopeReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid envelope request format")
+			return
+		}
+		switch envelopeReq.Method {
+		case "", "rms":
+			if envelopeReq.Window <= 0 {
+				sendError(conn, ErrInvalidRequest, fmt.Sprintf("Envelope window must be positive, got %d", envelopeReq.Window))
+				return
+			}
+		case "hilbert":
+		default:
+			sendError(conn, ErrInvalidRequest, fmt.Sprintf("Unknown envelope method: %s", envelopeReq.Method))
+			return
+		}
+		if err := resolveRequestFiles(base, envelopeReq.Files); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+
+		type envelope struct {
+			Times  []float64 `json:"times"` // Seconds when sampleRate is set, otherwise sample indices
+			Values []float64 `json:"values"`
+		}
+		envelopes := make(map[string]envelope, len(envelopeReq.Files))
+		for _, file := range envelopeReq.Files {
+			data, err := timeseries.ReadChannelRangeLimit(file, envelopeReq.StartIndex, envelopeReq.EndIndex,
+				envelopeReq.NumChannels, envelopeReq.Channel, envelopeReq.HeaderBytes, maxSamples)
+			if err != nil {
+				sendError(conn, fileErrorCode(err), fmt.Sprintf("Error reading %s: %v", filepath.Base(file), err))
+				return
+			}
+
+			var times, values []float64
+			if envelopeReq.Method == "hilbert" {
+				values = timeseries.HilbertEnvelope(data)
+				times = make([]float64, len(values))
+				for i := range times {
+					times[i] = float64(i)
+				}
+			} else {
+				times, values = timeseries.RMSEnvelope(data, envelopeReq.Window, envelopeReq.Hop)
+			}
+			offset := float64(max(envelopeReq.StartIndex, 0))
+			for i := range times {
+				times[i] += offset
+				if envelopeReq.SampleRate > 0 {
+					times[i] /= envelopeReq.SampleRate
+				}
+			}
+			times, values = timeseries.LimitPoints(times, values, pointLimit(envelopeReq.MaxPoints, maxPlotPoints))
+			envelopes[filepath.Base(file)] = envelope{Times: times, Values: values}
+		}
+
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":  "envelope",
+			"files": envelopes,
+		})
+	case "computeHistogram":
+		var histogramReq struct {
+			Type        string   `json:"type"`
+			Files       []string `json:"files"`
+			Bins        int      `json:"bins"` // Defaults to 100
+			Min         *float64 `json:"min"`  // Range to bin; both default to the data's extremes
+			Max         *float64 `json:"max"`
+			StartIndex  int      `json:"startIndex"`
+			EndIndex    int      `json:"endIndex"` // 0 reads to the end of each file
+			NumChannels int      `json:"numChannels"`
+			Channel     int      `json:"channel"`
+			HeaderBytes int64    `json:"headerBytes"`
+			// Leading samples, or seconds at sampleRate, left out after startIndex
+			SkipSamples int     `json:"skipSamples"`
+			SkipSeconds float64 `json:"skipSeconds"`
+			SampleRate  float64 `json:"sampleRate"`
+		}
+		if err := json.Unmarshal(message, &histogramReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid histogram request format")
+			return
+		}
+		if histogramReq.Bins == 0 {
+			histogramReq.Bins = 100
+		}
+		if histogramReq.Bins < 0 || histogramReq.Bins > maxPlotPoints {
+			sendError(conn, ErrInvalidRequest, fmt.Sprintf("Bin count must be between 1 and %d, got %d",
+				maxPlotPoints, histogramReq.Bins))
+			return
+		}
+		if (histogramReq.Min == nil) != (histogramReq.Max == nil) ||
+			(histogramReq.Min != nil && *histogramReq.Max < *histogramReq.Min) {
+			sendError(conn, ErrInvalidRequest, "Histogram range needs both min and max, with min no greater than max")
+			return
+		}
+		if err := resolveRequestFiles(base, histogramReq.Files); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+		if histogramReq.SampleRate == 0 {
+			histogramReq.SampleRate = calibration.DefaultSampleRate
+		}
+		// Histogram files hold float32 samples, one frame per channel
+		captures := make([]capture, len(histogramReq.Files))
+		for i, file := range histogramReq.Files {
+			captures[i] = capture{label: filepath.Base(file), path: file, sampleSize: 4 * max(histogramReq.NumChannels, 1)}
+		}
+		skip, err := leadingSkip(histogramReq.SkipSamples, histogramReq.SkipSeconds, histogramReq.SampleRate,
+			histogramReq.StartIndex, captures, histogramReq.HeaderBytes)
+		if err != nil {
+			sendError(conn, ErrInvalidRequest, err.Error())
+			return
+		}
+		histogramReq.StartIndex += skip
+		if histogramReq.EndIndex > 0 && histogramReq.StartIndex >= histogramReq.EndIndex {
+			sendError(conn, ErrInvalidRequest, fmt.Sprintf("Skipping %d samples leaves nothing before endIndex %d",
+				skip, histogramReq.EndIndex))
+			return
+		}
+
+		type histogram struct {
+			Edges  []float64 `json:"edges"` // bins+1 bin boundaries
+			Counts []float64 `json:"counts"`
+		}
+		histograms := make(map[string]histogram, len(histogramReq.Files))
+		for _, file := range histogramReq.Files {
+			data, err := timeseries.ReadChannelRangeLimit(file, histogramReq.StartIndex, histogramReq.EndIndex,
+				histogramReq.NumChannels, histogramReq.Channel, histogramReq.HeaderBytes, maxSamples)
+			if err != nil {
+				sendError(conn, fileErrorCode(err), fmt.Sprintf("Error reading %s: %v", filepath.Base(file), err))
+				return
+			}
+
+			var edges, counts []float64
+			if histogramReq.Min != nil {
+				edges, counts = timeseries.HistogramRange(data, histogramReq.Bins, *histogramReq.Min, *histogramReq.Max)
+			} else {
+				edges, counts = timeseries.Histogram(data, histogramReq.Bins)
+			}
+			histograms[filepath.Base(file)] = histogram{Edges: edges, Counts: counts}
+		}
+
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":  "histogram",
+			"files": histograms,
+		})
+	case "computeCoherence":
+		var coherenceReq struct {
+			Type        string  `json:"type"`
+			TxFile      string  `json:"txFile"`
+			RxFile      string  `json:"rxFile"`
+			StartIndex  int     `json:"startIndex"`
+			EndIndex    int     `json:"endIndex"`    // 0 reads to the end of the files
+			SampleRate  float64 `json:"sampleRate"`  // Defaults to the calibration sample rate
+			SegmentSize int     `json:"segmentSize"` // Welch segment length, 0 for the default
+			NumChannels int     `json:"numChannels"`
+			Channel     int     `json:"channel"`
+			HeaderBytes int64   `json:"headerBytes"`
+		}
+		if err := json.Unmarshal(message, &coherenceReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid coherence request format")
+			return
+		}
+		if err := resolveRequestPaths(base, &coherenceReq.TxFile, &coherenceReq.RxFile); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+		if coherenceReq.SampleRate == 0 {
+			coherenceReq.SampleRate = calibration.DefaultSampleRate
+		}
+
+		var signals [2][]float64
+		for i, file := range []string{coherenceReq.TxFile, coherenceReq.RxFile} {
+			data, err := timeseries.ReadChannelRangeLimit(file, coherenceReq.StartIndex, coherenceReq.EndIndex,
+				coherenceReq.NumChannels, coherenceReq.Channel, coherenceReq.HeaderBytes, maxSamples)
+			if err != nil {
+				sendError(conn, fileErrorCode(err), fmt.Sprintf("Error reading %s: %v", filepath.Base(file), err))
+				return
+			}
+			signals[i] = data
+		}
+
+		freqs, coherence, err := fft.Coherence(signals[0], signals[1], coherenceReq.SampleRate, coherenceReq.SegmentSize)
+		if err != nil {
+			sendError(conn, ErrProcessingFailed, fmt.Sprintf("Error computing coherence: %v", err))
+			return
+		}
+
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":        "coherenceResults",
+			"frequencies": freqs,
+			"coherence":   coherence,
+		})
+	case "transferFunction":
+		var transferReq struct {
+			Type        string  `json:"type"`
+			TxFile      string  `json:"txFile"`
+			RxFile      string  `json:"rxFile"`
+			StartIndex  int     `json:"startIndex"`
+			EndIndex    int     `json:"endIndex"`   // 0 reads to the end of the files
+			SampleRate  float64 `json:"sampleRate"` // Defaults to the calibration sample rate
+			PhaseUnit   string  `json:"phaseUnit"`  // "rad" (default) or "deg"
+			NumChannels int     `json:"numChannels"`
+			Channel     int     `json:"channel"`
+			HeaderBytes int64   `json:"headerBytes"`
+		}
+		if err := json.Unmarshal(message, &transferReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid transfer function request format")
+			return
+		}
+		if err := resolveRequestPaths(base, &transferReq.TxFile, &transferReq.RxFile); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+		if transferReq.SampleRate == 0 {
+			transferReq.SampleRate = calibration.DefaultSampleRate
+		}
+
+		var signals [2][]float64
+		for i, file := range []string{transferReq.TxFile, transferReq.RxFile} {
+			data, err := timeseries.ReadChannelRangeLimit(file, transferReq.StartIndex, transferReq.EndIndex,
+				transferReq.NumChannels, transferReq.Channel, transferReq.HeaderBytes, maxSamples)
+			if err != nil {
+				sendError(conn, fileErrorCode(err), fmt.Sprintf("Error reading %s: %v", filepath.Base(file), err))
+				return
+			}
+			signals[i] = data
+		}
+
+		freqs, magnitude, phase, err := fft.TransferFunction(signals[0], signals[1], transferReq.SampleRate)
+		if err != nil {
+			sendError(conn, ErrProcessingFailed, fmt.Sprintf("Error computing transfer function: %v", err))
+			return
+		}
+		if err := convertPhases(phase, "deg", transferReq.PhaseUnit); err != nil {
+			sendError(conn, ErrInvalidRequest, err.Error())
+			return
+		}
+
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":        "transferFunctionResults",
+			"frequencies": freqs,
+			"magnitude":   magnitude,
+			"phase":       phase,
+		})
+	case "filterSignal":
+		var filterReq struct {
+			Type        string    `json:"type"`
+			Files       []string  `json:"files"`
+			StartIndex  int       `json:"startIndex"`
+			EndIndex    int       `json:"endIndex"` // 0 reads to the end of each file
+			Kind        string    `json:"kind"`     // "lowpass", "highpass", "bandpass" or "bandstop"
+			Order       int       `json:"order"`
+			Cutoffs     []float64 `json:"cutoffs"` // Hz, two band edges for band filters
+			SampleRate  float64   `json:"sampleRate"`
+			MaxPoints   int       `json:"maxPoints"`
+			ZeroPhase   bool      `json:"zeroPhase"` // filter forward and backward
+			NumChannels int       `json:"numChannels"`
+			Channel     int       `json:"channel"`
+			HeaderBytes int64     `json:"headerBytes"`
+		}
+		if err := json.Unmarshal(message, &filterReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid filter request format")
+			return
+		}
+		if err := resolveRequestFiles(base, filterReq.Files); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+
+		b, a, err := filter.Butterworth(filterReq.Order, filterReq.Cutoffs, filterReq.Kind, filterReq.SampleRate)
+		if err != nil {
+			sendError(conn, ErrInvalidRequest, fmt.Sprintf("Invalid filter settings: %v", err))
+			return
+		}
+
+		fileData := make([]timeseries.FileData, len(filterReq.Files))
+		for i, file := range filterReq.Files {
+			data, err := timeseries.ReadChannelRangeLimit(file, filterReq.StartIndex, filterReq.EndIndex,
+				filterReq.NumChannels, filterReq.Channel, filterReq.HeaderBytes, maxSamples)
+			if err != nil {
+				sendError(conn, fileErrorCode(err), fmt.Sprintf("Error reading %s: %v", filepath.Base(file), err))
+				return
+			}
+
+			var filtered []float64
+			if filterReq.ZeroPhase {
+				filtered = filter.FiltFilt(b, a, data)
+			} else {
+				filtered = filter.Apply(b, a, data)
+			}
+			times := make([]float64, len(filtered))
+			offset := max(filterReq.StartIndex, 0)
+			for j := range times {
+				times[j] = float64(offset + j)
+			}
+			times, filtered = timeseries.LimitPoints(times, filtered, pointLimit(filterReq.MaxPoints, maxPlotPoints))
+			fileData[i] = timeseries.FileData{Times: times, Values: filtered}
+		}
+
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":  "filteredData",
+			"files": fileData,
+			"b":     b,
+			"a":     a,
+		})
+	case "generateSignal":
+		var signalReq struct {
+			Type       string                  `json:"type"`
+			OutputPath string                  `json:"outputPath"`
+			Signal     timeseries.SignalConfig `json:"signal"`
+		}
+		if err := json.Unmarshal(message, &signalReq); err != nil || signalReq.OutputPath == "" {
+			sendError(conn, ErrInvalidRequest, "Invalid generate signal request format")
+			return
+		}
+
+		if err := resolveRequestPaths(base, &signalReq.OutputPath); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+		if samples := signalReq.Signal.Duration * signalReq.Signal.SampleRate; samples > float64(maxSamples) {
+			sendError(conn, ErrInvalidRequest, fmt.Sprintf("%.0f samples exceed the limit of %d", samples, maxSamples))
+			return
+		}
+
+		data, err := timeseries.GenerateSignal(signalReq.Signal)
+		if err != nil {
+			sendError(conn, ErrProcessingFailed, fmt.Sprintf("Error generating signal: %v", err))
+			return
+		}
+
+		if err := timeseries.WriteBinaryFile(signalReq.OutputPath, data); err != nil {
+			sendError(conn, ErrWriteError, fmt.Sprintf("Error writing signal file: %v", err))
+			return
+		}
+
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":    "signalGenerated",
+			"path":    signalReq.OutputPath,
+			"samples": len(data),
+		})
+	case "exportWav":
+		var wavReq struct {
+			Type        string   `json:"type"`
+			Files       []string `json:"files"`
+			StartIndex  int      `json:"startIndex"`
+			EndIndex    int      `json:"endIndex"` // 0 exports to the end of each file
+			SampleRate  int      `json:"sampleRate"`
+			ExportPath  string   `json:"exportPath"`
+			HeaderBytes int64    `json:"headerBytes"`
+		}
+		if err := json.Unmarshal(message, &wavReq); err != nil || wavReq.ExportPath == "" {
+			sendError(conn, ErrInvalidRequest, "Invalid WAV export request format")
+			return
+		}
+		if wavReq.SampleRate <= 0 {
+			sendError(conn, ErrInvalidRequest, fmt.Sprintf("Invalid sample rate %d", wavReq.SampleRate))
+			return
+		}
+		if err := resolveRequestPaths(base, &wavReq.ExportPath); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+		if err := resolveRequestFiles(base, wavReq.Files); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+
+		// One WAV per selected file, named after the source file
+		var paths []string
+		for _, file := range wavReq.Files {
+			data, err := timeseries.ReadChannelRangeLimit(file, wavReq.StartIndex, wavReq.EndIndex, 1, 0, wavReq.HeaderBytes, maxSamples)
+			if err != nil {
+				sendError(conn, fileErrorCode(err), fmt.Sprintf("Error reading %s: %v", filepath.Base(file), err))
+				return
+			}
+
+			name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)) + ".wav"
+			wavPath := filepath.Join(wavReq.ExportPath, name)
+			if err := timeseries.WriteWAVFile(wavPath, data, wavReq.SampleRate); err != nil {
+				sendError(conn, ErrWriteError, fmt.Sprintf("Error writing %s: %v", name, err))
+				return
+			}
+			paths = append(paths, wavPath)
+		}
+
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":  "wavExportComplete",
+			"paths": paths,
+		})
+	case "exportDownsampled":
+		defer jobs.finish(jobs.start("exportDownsampled"))
+
+		var decimateReq struct {
+			Type       string `json:"type"`
+			InputPath  string `json:"inputPath"`
+			OutputPath string `json:"outputPath"`
+			Factor     int    `json:"factor"`
+			AntiAlias  bool   `json:"antiAlias"`
+			DataType   string `json:"dataType"` // "float32" (default) or "float64"
+		}
+		if err := json.Unmarshal(message, &decimateReq); err != nil || decimateReq.OutputPath == "" {
+			sendError(conn, ErrInvalidRequest, "Invalid downsampled export request format")
+			return
+		}
+		if err := resolveRequestPaths(base, &decimateReq.InputPath, &decimateReq.OutputPath); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+
+		progressCallback := func(progress int) {
+			safeWriteJSON(conn, map[string]interface{}{
+				"type":     "exportDownsampledProgress",
+				"progress": progress,
+			})
+		}
+
+		samples, err := timeseries.DecimateFile(decimateReq.InputPath, decimateReq.OutputPath, decimateReq.Factor,
+			timeseries.DecimateOptions{
+				AntiAlias:        decimateReq.AntiAlias,
+				DataType:         decimateReq.DataType,
+				ProgressCallback: progressCallback,
+			})
+		if err != nil {
+			sendError(conn, ErrProcessingFailed, fmt.Sprintf("Error exporting downsampled file: %v", err))
+			return
+		}
+
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":    "downsampledExportComplete",
+			"path":    decimateReq.OutputPath,
+			"samples": samples,
+		})
+	case "applyFIR":
+		applyJob := jobs.start("applyFIR")
+		defer jobs.finish(applyJob)
+
+		var applyReq struct {
+			Type string `json:"type"`
+			Data struct {
+				InputPath        string    `json:"inputPath"`
+				OutputPath       string    `json:"outputPath"`
+				Coefficients     []float64 `json:"coefficients"`
+				CoefficientsPath string    `json:"coefficientsPath"` // Previously exported CSV or binary file
+				Boundary         string    `json:"boundary"`
+				DataType         string    `json:"dataType"`
+				HeaderBytes      int64     `json:"headerBytes"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(message, &applyReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid apply FIR request format")
+			return
+		}
+
+		if err := resolveRequestPaths(base, &applyReq.Data.InputPath, &applyReq.Data.OutputPath, &applyReq.Data.CoefficientsPath); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+
+		coeffs := applyReq.Data.Coefficients
+		if len(coeffs) == 0 && applyReq.Data.CoefficientsPath != "" {
+			loaded, err := fir.LoadCoefficients(applyReq.Data.CoefficientsPath)
+			if err != nil {
+				sendError(conn, fileErrorCode(err), fmt.Sprintf("Error loading FIR coefficients: %v", err))
+				return
+			}
+			coeffs = loaded
+		}
+		if len(coeffs) > maxFIRTaps {
+			sendError(conn, ErrInvalidRequest, fmt.Sprintf("%d FIR coefficients exceed the limit of %d", len(coeffs), maxFIRTaps))
+			return
+		}
+
+		progressCallback := func(progress int) {
+			safeWriteJSON(conn, map[string]interface{}{
+				"type":     "applyFIRProgress",
+				"progress": progress,
+			})
+		}
+
+		err := fir.ApplyFIRToFileWithOptions(applyReq.Data.InputPath, applyReq.Data.OutputPath, coeffs, fir.ApplyOptions{
+			Boundary:         applyReq.Data.Boundary,
+			DataType:         applyReq.Data.DataType,
+			HeaderBytes:      applyReq.Data.HeaderBytes,
+			ProgressCallback: progressCallback,
+			Checkpoint:       func() error { return jobs.checkpoint(applyJob) },
+		})
+		if err != nil {
+			code := ErrFIRFailed
+			if applyJob.err() != nil {
+				code = ErrTimeout
+			}
+			sendError(conn, code, fmt.Sprintf("Error applying FIR filter: %v", err))
+			return
+		}
+
+		safeWriteJSON(conn, map[string]interface{}{
+			"type": "applyFIRComplete",
+			"path": applyReq.Data.OutputPath,
+		})
+	case "suggestDecimation":
+		var decimationReq struct {
+			Type         string   `json:"type"`
+			Files        []string `json:"files"`      // Used when fileLength is not given
+			FileLength   int64    `json:"fileLength"` // Samples
+			HeaderBytes  int64    `json:"headerBytes"`
+			TargetPoints int      `json:"targetPoints"`
+		}
+		if err := json.Unmarshal(message, &decimationReq); err != nil {
+			sendError(conn, ErrInvalidRequest, "Invalid decimation request format")
+			return
+		}
+
+		if err := resolveRequestFiles(base, decimationReq.Files); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+
+		// Size against the longest selected file
+		fileLength := decimationReq.FileLength
+		for _, file := range decimationReq.Files {
+			if decimationReq.FileLength > 0 {
+				break
+			}
+			length, err := timeseries.GetTotalFileLength([]string{file}, decimationReq.HeaderBytes)
+			if err != nil {
+				sendError(conn, fileErrorCode(err), fmt.Sprintf("Error getting file length: %v", err))
+				return
+			}
+			if length > fileLength {
+				fileLength = length
+			}
+		}
+
+		factor, points, err := timeseries.SuggestDecimation(fileLength, decimationReq.TargetPoints)
+		if err != nil {
+			sendError(conn, ErrProcessingFailed, fmt.Sprintf("Error suggesting decimation: %v", err))
+			return
+		}
+
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":             "decimationSuggestion",
+			"fileLength":       fileLength,
+			"decimationFactor": factor,
+			"pointCount":       points,
+		})
+	case "serverStats":
+		var memStats runtime.MemStats
+		runtime.ReadMemStats(&memStats)
+
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":              "serverStats",
+			"goroutines":        runtime.NumGoroutine(),
+			"heapAlloc":         memStats.HeapAlloc,
+			"heapSys":           memStats.HeapSys,
+			"activeConnections": connectionCount(),
+			"activeJobs":        jobs.count(),
+		})
+	default:
+		logging.Debugf("Received message: %+v", msg)
+		response := Message{
+			Type:    "response",
+			Message: "Received " + msg.Type + " command",
+		}
+		if err := safeWriteJSON(conn, response); err != nil {
+			logging.Errorf("Write error: %v", err)
+		}
+	}
+}
+
+// handlePlot answers a plot request with the downsampled data of each file
+func handlePlot(conn jsonWriter, message []byte) {
+	var plotReq PlotRequest
+	if err := json.Unmarshal(message, &plotReq); err != nil {
+		sendError(conn, ErrInvalidRequest, "Invalid plot request format")
+		return
+	}
+
+	if len(plotReq.Files) == 0 {
+		sendError(conn, ErrInvalidRequest, "No files selected for plotting")
+		return
+	}
+
+	// Filter for .bin files
+	var binFiles []string
+	for _, file := range plotReq.Files {
+		if filepath.Ext(file) == ".bin" {
+			binFiles = append(binFiles, file)
+		}
+	}
+
+	if len(binFiles) == 0 {
+		sendError(conn, ErrInvalidRequest, "No .bin files selected")
+		return
+	}
+	if err := resolveRequestFiles(fileBase(plotReq.BaseDir, browsedDir(conn)), binFiles); err != nil {
+		sendError(conn, ErrAccessDenied, err.Error())
+		return
+	}
+
+	// The longest file sets the scroll range reported back to the client
+	var totalLength int64
+	fileLengths := make([]int64, len(binFiles))
+	for i, file := range binFiles {
+		fileLength, err := timeseries.GetTotalFileLength([]string{file}, plotReq.HeaderBytes)
+		if err != nil {
+			sendError(conn, fileErrorCode(err), fmt.Sprintf("Error getting file length: %v", err))
+			return
+		}
+		if plotReq.NumChannels > 1 {
+			fileLength /= int64(plotReq.NumChannels)
+		}
+		if fileLength > totalLength {
+			totalLength = fileLength
+		}
+		fileLengths[i] = fileLength
+	}
+
+	// Shorter files end early on the shared time axis, which usually means
+	// mismatched channel files were selected
+	lengthMismatch := false
+	for _, length := range fileLengths {
+		if length != totalLength {
+			lengthMismatch = true
+		}
+	}
+	if lengthMismatch && plotReq.RequireEqualLength {
+		var details []string
+		for i, file := range binFiles {
+			details = append(details, fmt.Sprintf("%s: %d", filepath.Base(file), fileLengths[i]))
+		}
+		sendError(conn, ErrInvalidRequest, fmt.Sprintf("Selected files have different lengths (%s)", strings.Join(details, ", ")))
+		return
+	}
+
+	// If this is the initial plot request (startIndex and endIndex are 0),
+	// plot up to the end of the longest file
+	if plotReq.StartIndex == 0 && plotReq.EndIndex == 0 {
+		plotReq.EndIndex = int(totalLength)
+	}
+
+	if plotReq.DownsampleMode != "" {
+		if plotReq.DownsampleMethod != "" && plotReq.DownsampleMethod != plotReq.DownsampleMode {
+			sendError(conn, ErrInvalidRequest, fmt.Sprintf("downsampleMode %q conflicts with downsampleMethod %q",
+				plotReq.DownsampleMode, plotReq.DownsampleMethod))
+			return
+		}
+		plotReq.DownsampleMethod = plotReq.DownsampleMode
+	}
+	if plotReq.NotchFilter != nil {
+		if err := plotReq.NotchFilter.Validate(); err != nil {
+			sendError(conn, ErrInvalidRequest, err.Error())
+			return
+		}
+	}
+
+	// Read and downsample the data
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout("plot"))
+	defer cancel()
+	fileData, err := timeseries.ReadAndDownsampleContext(
+		ctx,
+		binFiles,
+		plotReq.StartIndex,
+		plotReq.EndIndex,
+		plotReq.DecimationFactor,
+		timeseries.DownsampleOptions{
+			MaxPoints:       pointLimit(plotReq.MaxPoints, maxPlotPoints),
+			MaxSamples:      maxSamples,
+			RawThreshold:    min(plotReq.RawThreshold, maxPlotPoints),
+			Method:          plotReq.DownsampleMethod,
+			Strict:          plotReq.StrictIndices,
+			NumChannels:     plotReq.NumChannels,
+			Channel:         plotReq.Channel,
+			SmoothWindow:    plotReq.Smooth,
+			SmoothMethod:    plotReq.SmoothMethod,
+			Transform:       plotReq.Transform,
+			SampleRate:      plotReq.SampleRate,
+			IntegralInitial: plotReq.IntegralInitial,
+			HeaderBytes:     plotReq.HeaderBytes,
+			Notch:           plotReq.NotchFilter,
+			Scale:           plotReq.ScaleFactor,
+			Offset:          plotReq.Offset,
+			Progress: func(progress int) {
+				safeWriteJSON(conn, map[string]interface{}{
+					"type":     "plotProgress",
+					"progress": progress,
+				})
+			},
+		},
+	)
+	if err != nil {
+		code := fileErrorCode(err)
+		if ctx.Err() != nil {
+			code = ErrTimeout
+		}
+		sendError(conn, code, fmt.Sprintf("Error reading files: %v", err))
+		return
+	}
+
+	// Send the plot data back to the client
+	plotData := struct {
+		Type           string                `json:"type"`
+		Files          []timeseries.FileData `json:"files"`
+		TotalLength    int64                 `json:"totalLength"`
+		FileLengths    []int64               `json:"fileLengths"` // In the order of files
+		LengthMismatch bool                  `json:"lengthMismatch"`
+	}{
+		Type:           "plotData",
+		Files:          fileData,
+		TotalLength:    totalLength,
+		FileLengths:    fileLengths,
+		LengthMismatch: lengthMismatch,
+	}
+
+	if err := safeWriteJSON(conn, plotData); err != nil {
+		logging.Errorf("Error sending plot data: %v", err)
+	}
+}
+
+// handleCalibrate runs a calibration request and sends its results
+func handleCalibrate(conn jsonWriter, message []byte) {
+	calibrateJob := jobs.start("calibrate")
+	defer jobs.finish(calibrateJob)
+
+	var calibrationReq struct {
+		Type      string `json:"type"`
+		BaseDir   string `json:"baseDir"`   // Resolves relative paths, see fileBase
+		PhaseUnit string `json:"phaseUnit"` // "rad" (default) or "deg"
+		// Transfer functions are averaged over segments of segmentSize
+		// samples overlapping by overlap; 0 takes one FFT per recording
+		SegmentSize int     `json:"segmentSize"`
+		Overlap     float64 `json:"overlap"`
+		Goertzel    bool    `json:"goertzel"`   // Measure only the configured tones, see calibration.SpectralOptions
+		NHarmonics  int     `json:"nHarmonics"` // Odd harmonics measured per square drive with goertzel, 0 for the default
+		// Frequency at which each coil's amplitude is normalized to 0 dB, 0 for none
+		NormalizeFrequency float64 `json:"normalizeFrequency"`
+		Data               []struct {
+			Station   string  `json:"station"`
+			FullPath  string  `json:"fullPath"`
+			Waveform  string  `json:"waveform"`
+			Frequency float64 `json:"frequency"`
+			Tx        string  `json:"tx"`
+			Rx        string  `json:"rx"`
+			Coil      string  `json:"coil"`
+			// Omitted for legacy clients, which recorded at the default rate
+			SampleRate *float64 `json:"sampleRate"`
+		} `json:"data"`
+	}
+
+	logging.Infof("Received calibration request")
+
+	if err := json.Unmarshal(message, &calibrationReq); err != nil {
+		logging.Errorf("Error unmarshaling calibration request: %v", err)
+		sendError(conn, ErrInvalidRequest, "Invalid calibration request format")
+		return
+	}
+	scale, err := phaseScale("deg", calibrationReq.PhaseUnit)
+	if err != nil {
+		sendError(conn, ErrInvalidRequest, err.Error())
+		return
+	}
+	if calibrationReq.NHarmonics < 0 {
+		sendError(conn, ErrInvalidRequest, fmt.Sprintf("Invalid harmonic count %d", calibrationReq.NHarmonics))
+		return
+	}
+
+	logging.Debugf("Calibration data: %+v", calibrationReq.Data)
+	base := fileBase(calibrationReq.BaseDir, browsedDir(conn))
+
+	// Organize data for calibration
+	sineFilePaths := make(map[string]map[float64]map[string]string)
+	squareFilePaths := make(map[string]map[float64]map[string]string)
+	sineRates := make(map[string]map[float64]float64)
+	squareRates := make(map[string]map[float64]float64)
+
+	var captures []capture
+	for _, item := range calibrationReq.Data {
+		itemRate := calibration.DefaultSampleRate
+		if item.SampleRate != nil {
+			itemRate = *item.SampleRate
+		}
+		if itemRate <= 0 {
+			sendError(conn, ErrInvalidRequest, fmt.Sprintf("Invalid sample rate %v for station %s", itemRate, item.Station))
+			return
+		}
+
+		if err := resolveRequestPaths(base, &item.Tx, &item.Rx); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			return
+		}
+
+		targetMap, rates := squareFilePaths, squareRates
+		if item.Waveform == "Sine" {
+			targetMap, rates = sineFilePaths, sineRates
+		}
+
+		if _, exists := targetMap[item.Coil]; !exists {
+			targetMap[item.Coil] = make(map[float64]map[string]string)
+			rates[item.Coil] = make(map[float64]float64)
+		}
+		if _, exists := targetMap[item.Coil][item.Frequency]; !exists {
+			targetMap[item.Coil][item.Frequency] = make(map[string]string)
+		}
+
+		targetMap[item.Coil][item.Frequency]["tx"] = item.Tx
+		targetMap[item.Coil][item.Frequency]["rx"] = item.Rx
+		rates[item.Coil][item.Frequency] = itemRate
+
+		for _, file := range []struct{ role, path string }{{"tx", item.Tx}, {"rx", item.Rx}} {
+			captures = append(captures, capture{
+				label:      fmt.Sprintf("%s %s of station %s", filepath.Base(file.path), file.role, item.Station),
+				path:       file.path,
+				sampleSize: 4,
+				frequency:  item.Frequency,
+				sampleRate: itemRate,
+			})
+		}
+	}
+	warnings := durationMismatches(captures, 0, calibration.DefaultSampleRate)
+	for _, warning := range warnings {
+		logging.Warnf("%s", warning)
+	}
+
+	logging.Debugf("Running calibration with sine files: %+v and square files: %+v", sineFilePaths, squareFilePaths)
+
+	// Create progress callback
+	progressCallback := func(progress int) {
+		safeWriteJSON(conn, map[string]interface{}{
+			"type":     "calibrationProgress",
+			"progress": progress,
+		})
+	}
+	checkpoint := func() error { return jobs.checkpoint(calibrateJob) }
+
+	// Run calibration with RunCalibration instead of Calibrate
+	spectralOpts := calibration.SpectralOptions{
+		SegmentSize:        calibrationReq.SegmentSize,
+		Overlap:            calibrationReq.Overlap,
+		Goertzel:           calibrationReq.Goertzel,
+		Harmonics:          calibrationReq.NHarmonics,
+		NormalizeFrequency: calibrationReq.NormalizeFrequency,
+		SineRates:          sineRates,
+		SquareRates:        squareRates,
+	}
+	results, err := calibration.RunCalibrationWithOptions(sineFilePaths, squareFilePaths, calibration.DefaultSampleRate,
+		spectralOpts, progressCallback, checkpoint)
+	if err != nil {
+		logging.Errorf("Calibration error: %v", err)
+		code := ErrCalibrationFailed
+		if calibrateJob.err() != nil {
+			code = ErrTimeout
+		}
+		sendError(conn, code, fmt.Sprintf("Calibration failed: %v", err))
+		return
+	}
+
+	var skipped []string
+	for coil, result := range results {
+		if result.NormalizationWarning != "" {
+			skipped = append(skipped, fmt.Sprintf("Coil %s: %s", coil, result.NormalizationWarning))
+		}
+	}
+	sort.Strings(skipped)
+	for _, warning := range skipped {
+		logging.Warnf("%s", warning)
+	}
+	warnings = append(warnings, skipped...)
+	for _, result := range results {
+		convertPhases(result.Phases, "deg", calibrationReq.PhaseUnit)
+		for i := range result.Harmonics {
+			result.Harmonics[i].Phase *= scale
+		}
+	}
+
+	logging.Debugf("Calibration completed, results: %+v", results)
+
+	// Send the actual results
+	response := map[string]interface{}{
+		"type":    "calibrationComplete",
+		"results": results,
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	safeWriteJSON(conn, response)
+}
+
+// handleCalculateFIR designs the FIR filters of a calculateFIR request
+func handleCalculateFIR(conn jsonWriter, message []byte) {
+	firJob := jobs.start("calculateFIR")
+	defer jobs.finish(firJob)
+
+	var firReq struct {
+		Type      string   `json:"type"`
+		BaseDir   string   `json:"baseDir"`   // Resolves relative paths, see fileBase
+		PhaseUnit string   `json:"phaseUnit"` // "rad" (default) or "deg"
+		Stations  []string `json:"stations"`  // Only process these stations, e.g. to retry failures
+		Data      []struct {
+			Station           string  `json:"station"`
+			FullPath          string  `json:"fullPath"`
+			CoilName          string  `json:"coilName"`
+			BaseFrequency     float64 `json:"baseFrequency"`
+			SampleRate        float64 `json:"sampleRate"`
+			CoilChannel       string  `json:"coilChannel"`
+			CyclesToRead      int     `json:"cyclesToRead"`
+			ReadFullFile      bool    `json:"readFullFile"`
+			MaxCycles         int     `json:"maxCycles"`
+			SettlingCycles    int     `json:"settlingCycles"`
+			DataType          string  `json:"dataType"`
+			HeaderBytes       int64   `json:"headerBytes"`
+			RefinePeriod      string  `json:"refinePeriod"` // "zerocrossing" or "autocorrelation" to measure the cycle period
+			TargetWaveform    string  `json:"targetWaveform"`
+			Regularization    string  `json:"regularization"`
+			AutoStabilization bool    `json:"autoStabilization"`
+			SaveIntermediates bool    `json:"saveIntermediates"` // Also write stacked_<coil>.csv and perfect_<coil>.csv
+			Precision         int     `json:"precision"`         // Significant digits of those CSVs, 0 for 6, negative for full
+			OutputDir         string  `json:"outputDir"`         // Defaults to fir_results next to the input file
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal(message, &firReq); err != nil {
+		logging.Errorf("Error unmarshaling FIR request: %v", err)
+		sendError(conn, ErrInvalidRequest, "Invalid FIR calculation request")
+		return
+	}
+
+	if _, err := phaseScale("rad", firReq.PhaseUnit); err != nil {
+		sendError(conn, ErrInvalidRequest, err.Error())
+		return
+	}
+
+	logging.Debugf("Processing FIR request with data: %+v", firReq.Data)
+	base := fileBase(firReq.BaseDir, browsedDir(conn))
+
+	selected := make(map[string]bool, len(firReq.Stations))
+	for _, station := range firReq.Stations {
+		selected[station] = true
+	}
+
+	// Outcome of each station, reported once all have been processed so
+	// the client can resend just the failed ones
+	type stationStatus struct {
+		Station string `json:"station"`
+		Status  string `json:"status"` // "succeeded", "failed" or "skipped"
+		Error   string `json:"error,omitempty"`
+	}
+	statuses := make([]stationStatus, 0, len(firReq.Data))
+	var failed []string
+	fail := func(station, reason string) {
+		statuses = append(statuses, stationStatus{Station: station, Status: "failed", Error: reason})
+		failed = append(failed, station)
+	}
+
+	// Process each FIR request sequentially
+	for _, item := range firReq.Data {
+		if len(selected) > 0 && !selected[item.Station] {
+			statuses = append(statuses, stationStatus{Station: item.Station, Status: "skipped"})
+			continue
 		}
-
-		if err := json.Unmarshal(message, &firReq); err != nil {
-			safeWriteJSON(conn, Message{
-				Type:    "error",
-				Message: "Invalid FIR request format",
-			})
-			return
+		// Stations left when the time limit runs out fail so they can be resent
+		if err := firJob.err(); err != nil {
+			fail(item.Station, err.Error())
+			continue
 		}
 
-		// Create progress callback
+		// Create progress callback for this item. Progress updates fall
+		// between processing stages, so they double as pause points.
 		progressCallback := func(progress int) {
 			safeWriteJSON(conn, map[string]interface{}{
 				"type":     "firProgress",
+				"station":  item.Station,
 				"progress": progress,
 			})
+			jobs.checkpoint(firJob)
+		}
+
+		if err := resolveRequestPaths(base, &item.FullPath, &item.OutputDir); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			fail(item.Station, err.Error())
+			continue
 		}
 
 		// Create FIR configuration from request data
 		config := fir.FIRConfig{
-			FilePath:      firReq.Data.FilePath,
-			CoilName:      firReq.Data.CoilName,
-			SampleRate:    firReq.Data.SampleRate,
-			BaseFrequency: firReq.Data.BaseFrequency,
-			Stabilization: firReq.Data.Stabilization,
+			FilePath:          filepath.Join(item.FullPath, item.CoilChannel),
+			CoilName:          item.CoilName,
+			SampleRate:        item.SampleRate,
+			BaseFrequency:     item.BaseFrequency,
+			Stabilization:     0.01, // Default stabilization value
+			CyclesToRead:      item.CyclesToRead,
+			ReadFullFile:      item.ReadFullFile,
+			MaxCycles:         item.MaxCycles,
+			SettlingCycles:    item.SettlingCycles,
+			DataType:          item.DataType,
+			HeaderBytes:       item.HeaderBytes,
+			RefinePeriod:      item.RefinePeriod,
+			TargetWaveform:    item.TargetWaveform,
+			Regularization:    item.Regularization,
+			AutoStabilization: item.AutoStabilization,
+			SaveIntermediates: item.SaveIntermediates,
+			Precision:         item.Precision,
+			OutputDir:         item.OutputDir,
+		}
+
+		logging.Debugf("Processing FIR for station %s with config: %+v", item.Station, config)
+
+		if err := config.Validate(); err != nil {
+			sendError(conn, ErrInvalidRequest, fmt.Sprintf("Invalid FIR settings for %s: %v", item.Station, err))
+			fail(item.Station, err.Error())
+			continue
+		}
+		if err := checkPaths(config.FilePath, config.ResultsDir()); err != nil {
+			sendError(conn, ErrAccessDenied, err.Error())
+			fail(item.Station, err.Error())
+			continue
 		}
 
 		// Process FIR with configuration and callback
-		result, err := fir.ProcessFIR(config, progressCallback)
+		result, err := fir.ProcessFIRContext(firJob.ctx, config, progressCallback)
 		if err != nil {
-			safeWriteJSON(conn, Message{
-				Type:    "error",
-				Message: fmt.Sprintf("Error processing FIR: %v", err),
-			})
-			return
+			logging.Errorf("Error processing FIR for %s: %v", item.Station, err)
+			code := ErrFIRFailed
+			if firJob.err() != nil {
+				code = ErrTimeout
+			}
+			sendError(conn, code, fmt.Sprintf("Error processing FIR for %s: %v", item.Station, err))
+			fail(item.Station, err.Error())
+			continue
 		}
+		convertPhases(result.ResponsePhase, "rad", firReq.PhaseUnit)
+		statuses = append(statuses, stationStatus{Station: item.Station, Status: "succeeded"})
 
-		// Send results back to client
+		logging.Infof("FIR processing completed for %s", item.Station)
+
+		// Send completion message with results
 		safeWriteJSON(conn, map[string]interface{}{
-			"type":    "firResults",
+			"type":    "firComplete",
+			"station": item.Station,
 			"results": result,
+			"message": fmt.Sprintf("FIR coefficients saved to %s",
+				filepath.Join(config.ResultsDir(), fmt.Sprintf("fir_coefficients_%s.csv", item.CoilName))),
 		})
+	}
 
-	case "exportFIR":
-		var exportReq struct {
-			Type string `json:"type"`
-			Data struct {
-				CSVContent string `json:"csvContent"`
-				ExportPath string `json:"exportPath"`
-				FileName   string `json:"fileName"`
-			} `json:"data"`
+	safeWriteJSON(conn, map[string]interface{}{
+		"type":     "firSummary",
+		"stations": statuses,
+		"failed":   failed,
+	})
+}
+
+// handleComputeFFT sends the spectrum of each file in a computeFFT request
+func handleComputeFFT(conn jsonWriter, message []byte) {
+	fftJob := jobs.start("computeFFT")
+	defer jobs.finish(fftJob)
+
+	logging.Infof("Received FFT request")
+	var fftReq struct {
+		Type         string                   `json:"type"`
+		Files        []string                 `json:"files"`
+		BaseDir      string                   `json:"baseDir"` // Resolves relative paths, see fileBase
+		MaxPoints    int                      `json:"maxPoints"`
+		Window       string                   `json:"window"`
+		CustomWindow []float64                `json:"customWindow"`
+		PhaseUnit    string                   `json:"phaseUnit"`   // "rad" (default) or "deg"
+		NumChannels  int                      `json:"numChannels"` // Interleaved channels per file, 0 or 1 for plain files
+		Channel      int                      `json:"channel"`     // Channel to transform in interleaved files
+		MinFreq      float64                  `json:"minFreq"`     // Returned band in Hz, full spectrum by default
+		MaxFreq      float64                  `json:"maxFreq"`
+		HeaderBytes  int64                    `json:"headerBytes"`
+		FloorDb      float64                  `json:"floorDb"`      // dB floor, defaults to -120
+		Average      bool                     `json:"average"`      // Average FFT blocks across the whole file
+		AverageFiles bool                     `json:"averageFiles"` // Return one spectrum averaged across the files
+		Overlap      float64                  `json:"overlap"`      // Block overlap fraction when averaging
+		Complex      bool                     `json:"complex"`      // Include raw real/imag coefficients, large payload
+		Parseval     bool                     `json:"parseval"`     // Include the Parseval energy ratio as a scaling check
+		NotchFilter  *timeseries.NotchOptions `json:"notchFilter"`  // Hum removal before the transform
+		// Fractional-octave bands per octave for log-spaced output, 0 keeps linear bins
+		BandsPerOctave int `json:"bandsPerOctave"`
+		// Sample range to transform, e.g. to skip start-up transients. An
+		// endIndex of 0 reads to the end; interleaved files count frames.
+		StartIndex int `json:"startIndex"`
+		EndIndex   int `json:"endIndex"`
+		// Leading samples, or seconds at sampleRate, discarded after
+		// startIndex to drop a switch-on transient
+		SkipSamples int     `json:"skipSamples"`
+		SkipSeconds float64 `json:"skipSeconds"`
+		// Raw samples are converted to value*scaleFactor + offset before the transform
+		ScaleFactor float64 `json:"scaleFactor"`
+		Offset      float64 `json:"offset"`
+		SampleRate  float64 `json:"sampleRate"` // Defaults to the calibration sample rate
+		// Harmonics to search for, 0 for none, within harmonicTolerance
+		// percent of each multiple of fundamental (0 for the strongest bin)
+		NHarmonics        int     `json:"nHarmonics"`
+		HarmonicTolerance float64 `json:"harmonicTolerance"`
+		Fundamental       float64 `json:"fundamental"`
+	}
+	if err := json.Unmarshal(message, &fftReq); err != nil {
+		logging.Errorf("Error unmarshaling FFT request: %v", err)
+		sendError(conn, ErrInvalidRequest, "Invalid FFT request format")
+		return
+	}
+
+	if err := resolveRequestFiles(fileBase(fftReq.BaseDir, browsedDir(conn)), fftReq.Files); err != nil {
+		sendError(conn, ErrAccessDenied, err.Error())
+		return
+	}
+
+	logging.Infof("Computing FFT for files: %v", fftReq.Files)
+
+	if fftReq.SampleRate == 0 {
+		fftReq.SampleRate = calibration.DefaultSampleRate
+	}
+	if fftReq.SampleRate < 0 {
+		sendError(conn, ErrInvalidRequest, fmt.Sprintf("Invalid sample rate %v", fftReq.SampleRate))
+		return
+	}
+
+	if _, err := phaseScale("rad", fftReq.PhaseUnit); err != nil {
+		sendError(conn, ErrInvalidRequest, err.Error())
+		return
+	}
+	if fftReq.NHarmonics < 0 || fftReq.HarmonicTolerance < 0 || fftReq.Fundamental < 0 {
+		sendError(conn, ErrInvalidRequest, "Harmonic count, tolerance and fundamental must not be negative")
+		return
+	}
+	if fftReq.Average && fftReq.NumChannels > 1 {
+		sendError(conn, ErrInvalidRequest, "Averaged FFTs of interleaved files are not supported")
+		return
+	}
+	if fftReq.Channel < 0 || fftReq.Channel >= max(fftReq.NumChannels, 1) {
+		sendError(conn, ErrInvalidRequest, fmt.Sprintf("Channel %d out of range for %d channels",
+			fftReq.Channel, max(fftReq.NumChannels, 1)))
+		return
+	}
+	if fftReq.Average && fftReq.NotchFilter != nil {
+		sendError(conn, ErrInvalidRequest, "Notch filtering is not supported for averaged FFTs")
+		return
+	}
+	if fftReq.NotchFilter != nil {
+		if err := fftReq.NotchFilter.Validate(); err != nil {
+			sendError(conn, ErrInvalidRequest, err.Error())
+			return
 		}
+	}
+	fftOpts := fft.FFTOptions{
+		Window:       fftReq.Window,
+		CustomWindow: fftReq.CustomWindow,
+		MinFreq:      fftReq.MinFreq,
+		MaxFreq:      fftReq.MaxFreq,
+		FloorDb:      fftReq.FloorDb,
+		Overlap:      fftReq.Overlap,
+		Complex:      fftReq.Complex,
+		Parseval:     fftReq.Parseval,
+		Scale:        fftReq.ScaleFactor,
+		Offset:       fftReq.Offset,
+	}
 
-		if err := json.Unmarshal(message, &exportReq); err != nil {
-			safeWriteJSON(conn, Message{
-				Type:    "error",
-				Message: "Invalid export request format",
-			})
+	// FFT files hold float32 samples like every other view, one frame per channel
+	captures := make([]capture, len(fftReq.Files))
+	for i, file := range fftReq.Files {
+		captures[i] = capture{label: filepath.Base(file), path: file, sampleSize: 4 * max(fftReq.NumChannels, 1)}
+	}
+	warnings := durationMismatches(captures, fftReq.HeaderBytes, fftReq.SampleRate)
+	skip, err := leadingSkip(fftReq.SkipSamples, fftReq.SkipSeconds, fftReq.SampleRate,
+		fftReq.StartIndex, captures, fftReq.HeaderBytes)
+	if err != nil {
+		sendError(conn, ErrInvalidRequest, err.Error())
+		return
+	}
+	fftReq.StartIndex += skip
+	if fftReq.EndIndex > 0 && fftReq.StartIndex >= fftReq.EndIndex {
+		sendError(conn, ErrInvalidRequest, fmt.Sprintf("Skipping %d samples leaves nothing before endIndex %d",
+			skip, fftReq.EndIndex))
+		return
+	}
+
+	// Process the files on a bounded pool of workers
+	var (
+		resultsMu sync.Mutex
+		results   = make(map[string]*fft.FFTResult)
+		failures  = make(map[string]string) // Error for each file that produced no result
+		// Notch filter warnings, added to the response's warnings
+		notchWarnings []string
+		wg            sync.WaitGroup
+	)
+	fail := func(file, message string, err error) {
+		logging.Errorf("%s for file %s: %v", message, file, err)
+		resultsMu.Lock()
+		failures[filepath.Base(file)] = fmt.Sprintf("%s: %v", message, err)
+		resultsMu.Unlock()
+	}
+	files := make(chan string)
+	workers := runtime.NumCPU()
+	if workers > len(fftReq.Files) {
+		workers = len(fftReq.Files)
+	}
+	// finishResult converts and shrinks a spectrum before it is returned.
+	// Spectra to be averaged keep their full bins until the average is taken.
+	finishResult := func(result *fft.FFTResult) {
+		if fftReq.NHarmonics > 0 {
+			if err := fft.FindHarmonics(result, fftReq.Fundamental, fftReq.NHarmonics, fftReq.HarmonicTolerance); err != nil {
+				logging.Warnf("Harmonic search failed: %v", err)
+			}
+		}
+		convertPhases(result.Phases, "rad", fftReq.PhaseUnit)
+		fft.LogBin(result, fftReq.BandsPerOctave)
+		fft.LimitPoints(result, pointLimit(fftReq.MaxPoints, maxFFTPoints))
+	}
+
+	// computeFile transforms one file and stores its result
+	computeFile := func(file string) {
+		if fftReq.Average {
+			result, err := fft.ComputeAveragedFFTFromFile(file, fftReq.SampleRate, fftReq.HeaderBytes,
+				fftReq.StartIndex, fftReq.EndIndex, fftOpts)
+			if err != nil {
+				fail(file, "Error computing averaged FFT", err)
+				return
+			}
+			if !fftReq.AverageFiles {
+				finishResult(result)
+			}
+			resultsMu.Lock()
+			results[filepath.Base(file)] = result
+			resultsMu.Unlock()
 			return
 		}
 
-		// Write CSV file with provided filename
-		filePath := filepath.Join(exportReq.Data.ExportPath, exportReq.Data.FileName)
-		if err := os.WriteFile(filePath, []byte(exportReq.Data.CSVContent), 0644); err != nil {
-			safeWriteJSON(conn, Message{
-				Type:    "error",
-				Message: fmt.Sprintf("Error writing CSV file: %v", err),
-			})
+		data, err := timeseries.ReadChannelRangeLimit(file, fftReq.StartIndex, fftReq.EndIndex,
+			fftReq.NumChannels, fftReq.Channel, fftReq.HeaderBytes, maxSamples)
+		if err != nil {
+			fail(file, "Error reading file", err)
 			return
 		}
 
-		safeWriteJSON(conn, map[string]interface{}{
-			"type": "exportComplete",
-			"path": filePath,
-		})
-	default:
-		log.Printf("Received message: %+v\n", msg)
-		response := Message{
-			Type:    "response",
-			Message: "Received " + msg.Type + " command",
+		logging.Debugf("Read %d samples from %s", len(data), file)
+		if fftReq.NotchFilter != nil {
+			var fileWarnings []string
+			data, fileWarnings = timeseries.ApplyNotchFilters(data, fftReq.SampleRate, *fftReq.NotchFilter)
+			resultsMu.Lock()
+			for _, warning := range fileWarnings {
+				logging.Warnf("Warning for %s: %s", filepath.Base(file), warning)
+				notchWarnings = append(notchWarnings, fmt.Sprintf("%s: %s", filepath.Base(file), warning))
+			}
+			resultsMu.Unlock()
 		}
-		if err := safeWriteJSON(conn, response); err != nil {
-			log.Println("Write error:", err)
+		result, err := fft.ComputeFFTWithOptions(data, fftReq.SampleRate, fftOpts)
+		if err != nil {
+			fail(file, "Error computing FFT", err)
+			return
+		}
+
+		if !fftReq.AverageFiles {
+			finishResult(result)
+		}
+
+		logging.Debugf("FFT computed successfully for %s", file)
+		logging.Debugf("FFT result contains %d frequencies and %d magnitudes",
+			len(result.Frequencies), len(result.Magnitudes))
+		resultsMu.Lock()
+		results[filepath.Base(file)] = result
+		resultsMu.Unlock()
+	}
+
+	completed := 0
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range files {
+				// Drain the queue without working once out of time
+				if fftJob.err() != nil {
+					continue
+				}
+				computeFile(file)
+
+				resultsMu.Lock()
+				completed++
+				progress := completed * 100 / len(fftReq.Files)
+				resultsMu.Unlock()
+				safeWriteJSON(conn, map[string]interface{}{
+					"type":     "fftProgress",
+					"file":     filepath.Base(file),
+					"progress": progress,
+				})
+			}
+		}()
+	}
+	for _, file := range fftReq.Files {
+		files <- file
+	}
+	close(files)
+	wg.Wait()
+
+	if err := fftJob.err(); err != nil {
+		sendError(conn, ErrTimeout, fmt.Sprintf("FFT stopped after %d of %d files: %v", completed, len(fftReq.Files), err))
+		return
+	}
+
+	// Average in request order so the first file's bins are the reference,
+	// returning the average in place of the per-file spectra
+	var average *fft.FFTResult
+	var averaged []string
+	if fftReq.AverageFiles && len(results) > 0 {
+		var spectra []*fft.FFTResult
+		for _, file := range fftReq.Files {
+			if result, ok := results[filepath.Base(file)]; ok {
+				spectra = append(spectra, result)
+				averaged = append(averaged, filepath.Base(file))
+			}
+		}
+		var err error
+		if average, err = fft.AverageSpectra(spectra); err != nil {
+			sendError(conn, ErrProcessingFailed, fmt.Sprintf("Error averaging spectra: %v", err))
+			return
+		}
+		finishResult(average)
+		results = make(map[string]*fft.FFTResult)
+	}
+
+	logging.Debugf("Sending FFT results back to client")
+	// Get map keys manually
+	keys := make([]string, 0, len(results))
+	for k := range results {
+		keys = append(keys, k)
+	}
+	logging.Debugf("Results map contains entries for: %v", strings.Join(keys, ", "))
+
+	// Send results back
+	response := map[string]interface{}{
+		"type":     "fftResults",
+		"data":     results,
+		"failures": failures,
+	}
+	sort.Strings(notchWarnings)
+	warnings = append(warnings, notchWarnings...)
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	if average != nil {
+		response["average"] = average
+		response["averagedFiles"] = averaged
+	}
+	if err := safeWriteJSON(conn, response); err != nil {
+		logging.Errorf("Error sending FFT results: %v", err)
+		return
+	}
+	// Dumping the results is expensive, so only build it when it is logged
+	if logging.Enabled(logging.LevelDebug) {
+		if resultBytes, err := json.MarshalIndent(results, "", "  "); err == nil {
+			logging.Debugf("Sent FFT results structure: %s", string(resultBytes))
 		}
 	}
 }
 
-func listDirectory(path string) ([]FileInfo, error) {
+// listDirectory lists the entries of req.Path that match the request filters.
+// Extension filters only apply to files, directories are kept for navigation.
+func listDirectory(req DirectoryRequest) ([]FileInfo, error) {
+	path, err := resolvePath(req.Path)
+	if err != nil {
+		return nil, err
+	}
 	entries, err := os.ReadDir(path)
 	if err != nil {
 		return nil, err
 	}
 
+	extensions := make(map[string]bool)
+	for _, ext := range req.Extensions {
+		extensions[strings.ToLower(ext)] = true
+	}
+
 	var files []FileInfo
 	for _, entry := range entries {
+		if entry.IsDir() && req.FilesOnly {
+			continue
+		}
+		if !entry.IsDir() {
+			if req.DirsOnly {
+				continue
+			}
+			if len(extensions) > 0 && !extensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+				continue
+			}
+		}
+
 		fullPath := filepath.Join(path, entry.Name())
 		files = append(files, FileInfo{
 			Name:  entry.Name(),
@@ -650,77 +3159,355 @@ func listDirectory(path string) ([]FileInfo, error) {
 	return files, nil
 }
 
-// Add this helper function
-func validateFilePaths(paths []string) ([]string, error) {
+// fileChecksum returns the hex SHA-256 of the file as read back from disk, so
+// it reflects the bytes that actually landed. With sidecar set it also writes
+// the digest to path + ".sha256" in sha256sum format.
+func fileChecksum(path string, sidecar bool) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	if sidecar {
+		line := fmt.Sprintf("%s  %s\n", checksum, filepath.Base(path))
+		if err := os.WriteFile(path+".sha256", []byte(line), 0644); err != nil {
+			return "", err
+		}
+	}
+	return checksum, nil
+}
+
+// fileBase returns the directory relative file paths are resolved against,
+// since the client's working directory generally differs from the server's.
+// In order that is baseDir when given, the directory the connection browsed
+// last, the root directory when one is set, and otherwise "" for the server's
+// working directory.
+func fileBase(baseDir, browsed string) string {
+	switch {
+	case baseDir != "":
+		return baseDir
+	case browsed != "":
+		return browsed
+	default:
+		return rootDir
+	}
+}
+
+// resolveFilePath joins a relative path to base, see fileBase, and returns
+// its absolute form, rejecting paths outside the allowed root
+func resolveFilePath(path, base string) (string, error) {
+	if !filepath.IsAbs(path) && base != "" {
+		path = filepath.Join(base, path)
+	}
+	return resolvePath(path)
+}
+
+// resolveRequestPaths replaces each non-empty path with its absolute form,
+// see resolveFilePath, so every handler finds the file getTotalLength and
+// fileInfo find for the same relative path. It fails on the first path
+// outside the allowed root, leaving that path as given.
+func resolveRequestPaths(base string, paths ...*string) error {
+	for _, path := range paths {
+		if *path == "" {
+			continue
+		}
+		resolved, err := resolveFilePath(*path, base)
+		if err != nil {
+			return err
+		}
+		*path = resolved
+	}
+	return nil
+}
+
+// resolveRequestFiles resolves a list of request paths in place, see
+// resolveRequestPaths
+func resolveRequestFiles(base string, files []string) error {
+	for i := range files {
+		if err := resolveRequestPaths(base, &files[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// browsedDir returns the directory the WebSocket client behind conn listed
+// last, or "" for REST requests and clients that listed none
+func browsedDir(conn jsonWriter) string {
+	if rc, ok := conn.(*requestConn); ok {
+		return lastBrowsed.get(rc.Conn)
+	}
+	return ""
+}
+
+// validateFilePaths returns the absolute forms of the paths that exist and
+// stay inside the allowed root, resolving relative paths against base
+func validateFilePaths(paths []string, base string) ([]string, error) {
 	var validPaths []string
 	for _, path := range paths {
-		// Check if the path is absolute, if not make it absolute
-		if !filepath.IsAbs(path) {
-			absPath, err := filepath.Abs(path)
-			if err != nil {
-				continue
-			}
-			path = absPath
+		path, err := resolveFilePath(path, base)
+		if err != nil {
+			logging.Warnf("Rejected file path: %v", err)
+			continue
 		}
 
 		// Verify file exists and is readable
 		if _, err := os.Stat(path); err == nil {
 			validPaths = append(validPaths, path)
 		} else {
-			log.Printf("Invalid file path: %s, error: %v", path, err)
+			logging.Warnf("Invalid file path: %s, error: %v", path, err)
 		}
 	}
 	if len(validPaths) == 0 {
+		if base != "" {
+			return nil, fmt.Errorf("no valid files found in the provided paths (relative paths resolved against %s)", base)
+		}
 		return nil, fmt.Errorf("no valid files found in the provided paths")
 	}
 	return validPaths, nil
 }
 
-// Update the readConfigFile function
-func readConfigFile(path string) (map[string]interface{}, error) {
+// FileDiagnostics describes one input file of a job checked by validateJob
+type FileDiagnostics struct {
+	Station         string   `json:"station"`
+	Role            string   `json:"role"` // "tx", "rx" or "coil"
+	Path            string   `json:"path"`
+	Exists          bool     `json:"exists"`
+	Samples         int64    `json:"samples"`
+	CyclesAvailable float64  `json:"cyclesAvailable"`
+	CyclesRequired  int      `json:"cyclesRequired"`
+	OK              bool     `json:"ok"`
+	Problems        []string `json:"problems,omitempty"`
+}
+
+// Factor by which a file's implied duration may differ from the median of
+// the files selected with it before a warning is raised
+const durationMismatchRatio = 2.0
+
+// capture describes one selected file for durationMismatches; frequency is
+// the drive frequency, or 0 when there is none
+type capture struct {
+	label      string
+	path       string
+	sampleSize int
+	frequency  float64
+	sampleRate float64 // Overrides the rate passed to durationMismatches when set
+}
+
+// leadingSkip converts a leading region given as samples or as seconds at
+// sampleRate to a sample count, and checks that skipping it after start still
+// leaves data in every capture. Captures that cannot be sized are left for
+// the read to report.
+func leadingSkip(samples int, seconds, sampleRate float64, start int, captures []capture, headerBytes int64) (int, error) {
+	if samples < 0 || seconds < 0 {
+		return 0, fmt.Errorf("skipSamples and skipSeconds must not be negative")
+	}
+	if samples > 0 && seconds > 0 {
+		return 0, fmt.Errorf("give either skipSamples or skipSeconds, not both")
+	}
+	if seconds > 0 {
+		if sampleRate <= 0 {
+			return 0, fmt.Errorf("skipSeconds needs a positive sample rate")
+		}
+		samples = int(math.Round(seconds * sampleRate))
+	}
+	if samples == 0 {
+		return 0, nil
+	}
+
+	for _, c := range captures {
+		size, err := timeseries.DataSize(c.path)
+		if err != nil || size < headerBytes {
+			continue
+		}
+		length := (size - headerBytes) / int64(c.sampleSize)
+		if int64(start)+int64(samples) >= length {
+			return 0, fmt.Errorf("skipping %d samples from sample %d leaves nothing of %s, which has %d",
+				samples, start, c.label, length)
+		}
+	}
+	return samples, nil
+}
+
+// durationMismatches warns about captures whose duration at sampleRate, or
+// at their own rate when known, implied by their length since the rate is
+// not stored in the files, is far from that of their peers. An outlier
+// usually means a short and a long capture were mixed up.
+func durationMismatches(captures []capture, headerBytes int64, sampleRate float64) []string {
+	if len(captures) < 2 || sampleRate <= 0 {
+		return nil
+	}
+	durations := make([]float64, len(captures))
+	rates := make([]float64, len(captures))
+	for i, c := range captures {
+		rates[i] = sampleRate
+		if c.sampleRate > 0 {
+			rates[i] = c.sampleRate
+		}
+		size, err := timeseries.DataSize(c.path)
+		if err != nil || size < headerBytes {
+			durations[i] = -1
+			continue
+		}
+		durations[i] = float64((size-headerBytes)/int64(c.sampleSize)) / rates[i]
+	}
+
+	valid := make([]float64, 0, len(durations))
+	for _, d := range durations {
+		if d >= 0 {
+			valid = append(valid, d)
+		}
+	}
+	if len(valid) < 2 {
+		return nil
+	}
+	sort.Float64s(valid)
+	median := valid[len(valid)/2]
+	if len(valid)%2 == 0 {
+		median = (valid[len(valid)/2-1] + valid[len(valid)/2]) / 2
+	}
+	if median == 0 {
+		return nil
+	}
+
+	var warnings []string
+	for i, c := range captures {
+		d := durations[i]
+		if d < 0 || (d <= median*durationMismatchRatio && d*durationMismatchRatio >= median) {
+			continue
+		}
+		warning := fmt.Sprintf("%s implies %.3g s at %g Hz, against a median of %.3g s for the selected files",
+			c.label, d, rates[i], median)
+		if c.frequency > 0 {
+			warning += fmt.Sprintf(" (%.1f cycles at %g Hz, median %.1f)", d*c.frequency, c.frequency, median*c.frequency)
+		}
+		warnings = append(warnings, warning+"; check that it shares the sample rate")
+	}
+	return warnings
+}
+
+// diagnoseFile checks that path can be read as sampleSize-byte samples after
+// headerBytes and holds at least cyclesRequired cycles of frequency
+func diagnoseFile(path string, headerBytes int64, sampleSize int, sampleRate, frequency float64, cyclesRequired int) FileDiagnostics {
+	diag := FileDiagnostics{Path: path, CyclesRequired: cyclesRequired}
+	if err := checkPaths(path); err != nil {
+		diag.Problems = append(diag.Problems, err.Error())
+		return diag
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		diag.Problems = append(diag.Problems, err.Error())
+		return diag
+	}
+	diag.Exists = true
+	if info.IsDir() {
+		diag.Problems = append(diag.Problems, "path is a directory")
+		return diag
+	}
+
+	size, err := timeseries.DataSize(path)
+	if err != nil {
+		diag.Problems = append(diag.Problems, err.Error())
+		return diag
+	}
+	dataBytes := size - headerBytes
+	if headerBytes < 0 || dataBytes < 0 {
+		diag.Problems = append(diag.Problems, fmt.Sprintf("header size %d is outside the %d-byte file", headerBytes, size))
+		return diag
+	}
+	if dataBytes%int64(sampleSize) != 0 {
+		diag.Problems = append(diag.Problems, fmt.Sprintf("data size %d is not a multiple of %d bytes, check the data type", dataBytes, sampleSize))
+	}
+	diag.Samples = dataBytes / int64(sampleSize)
+
+	if sampleRate > 0 && frequency > 0 {
+		diag.CyclesAvailable = float64(diag.Samples) * frequency / sampleRate
+		if diag.CyclesAvailable < float64(cyclesRequired) {
+			diag.Problems = append(diag.Problems, fmt.Sprintf("file holds %.1f cycles but %d are required",
+				diag.CyclesAvailable, cyclesRequired))
+		}
+	} else {
+		diag.Problems = append(diag.Problems, "sample rate and frequency must be positive")
+	}
+	diag.OK = len(diag.Problems) == 0
+	return diag
+}
+
+// readConfigFile parses config.csv, returning one map per data row
+func readConfigFile(path string) ([]map[string]interface{}, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
+	// Files saved by Excel on Windows start with a UTF-8 BOM, which would
+	// otherwise stick to the first header, and may end lines with \r alone
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+
 	// Parse CSV
-	lines := strings.Split(string(data), "\n")
-	if len(lines) < 2 {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file format: %v", err)
+	}
+	if len(records) < 2 {
 		return nil, fmt.Errorf("invalid config file format")
 	}
 
 	// Parse headers and values
-	headers := strings.Split(strings.TrimSpace(lines[0]), ",")
-	values := strings.Split(strings.TrimSpace(lines[1]), ",")
+	headers := records[0]
+	var configs []map[string]interface{}
 
-	config := make(map[string]interface{})
+	for _, values := range records[1:] {
+		config := make(map[string]interface{})
 
-	for i, header := range headers {
-		if i >= len(values) {
-			break
+		for i, header := range headers {
+			if i >= len(values) {
+				break
+			}
+			value := strings.TrimSpace(values[i])
+
+			switch strings.ToLower(strings.TrimSpace(header)) {
+			case "name":
+				config["name"] = value
+			case "waveform":
+				config["waveform"] = value
+			case "freq":
+				if f, err := strconv.ParseFloat(value, 64); err == nil {
+					config["freq"] = f
+				}
+			case "tx":
+				config["tx"] = value
+			case "rx":
+				config["rx"] = value
+			case "coil":
+				config["coil"] = value
+			}
 		}
-		value := strings.TrimSpace(values[i])
 
-		switch strings.ToLower(header) {
-		case "name":
-			config["name"] = value
-		case "waveform":
-			config["waveform"] = value
-		case "freq":
-			if f, err := strconv.ParseFloat(value, 64); err == nil {
-				config["freq"] = f
-			}
-		case "tx":
-			config["tx"] = value
-		case "rx":
-			config["rx"] = value
-		case "coil":
-			config["coil"] = value
+		// Skip blank rows
+		if len(config) > 0 {
+			configs = append(configs, config)
 		}
 	}
 
-	log.Printf("Parsed config: %+v", config)
-	return config, nil
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("config file has no data rows")
+	}
+
+	logging.Debugf("Parsed config: %+v", configs)
+	return configs, nil
 }
 
 // In the calibration processing code
@@ -730,7 +3517,7 @@ func processCalibrationData(files map[string]map[float64]map[string]string) (map
 	// Use a buffer pool for file reading
 	bufferPool := sync.Pool{
 		New: func() interface{} {
-			buffer := make([]byte, bufferSize)
+			buffer := make([]byte, 2*chunkSamples*4) // Halves for tx and rx
 			return &buffer
 		},
 	}
@@ -745,7 +3532,7 @@ func processCalibrationData(files map[string]map[float64]map[string]string) (map
 			buffer := bufferPool.Get().(*[]byte)
 
 			// Process files in chunks
-			err := processFilesInChunks(fileMap["tx"], fileMap["rx"], *buffer, maxSamples, func(chunk []float64) error {
+			err := processFilesInChunks(fileMap["tx"], fileMap["rx"], *buffer, func(tx, rx []float64) error {
 				// Process chunk here
 				// ...
 				return nil
@@ -772,7 +3559,10 @@ func processCalibrationData(files map[string]map[float64]map[string]string) (map
 	return results, nil
 }
 
-func processFilesInChunks(txPath, rxPath string, buffer []byte, maxSamples int, processChunk func([]float64) error) error {
+// processFilesInChunks passes aligned chunks of tx and rx samples to
+// processChunk, splitting buffer between the two files. When the files differ
+// in length only the samples both hold are processed.
+func processFilesInChunks(txPath, rxPath string, buffer []byte, processChunk func(tx, rx []float64) error) error {
 	txFile, err := os.Open(txPath)
 	if err != nil {
 		return fmt.Errorf("error opening tx file: %v", err)
@@ -785,30 +3575,49 @@ func processFilesInChunks(txPath, rxPath string, buffer []byte, maxSamples int,
 	}
 	defer rxFile.Close()
 
-	chunkSize := len(buffer) / 8 // 8 bytes per float64
-	data := make([]float64, chunkSize)
+	// Calibration files hold float32 samples, like the plot path reads them
+	txInfo, err := txFile.Stat()
+	if err != nil {
+		return fmt.Errorf("error getting tx file info: %v", err)
+	}
+	rxInfo, err := rxFile.Stat()
+	if err != nil {
+		return fmt.Errorf("error getting rx file info: %v", err)
+	}
+	remaining := min(txInfo.Size(), rxInfo.Size()) / 4
+	if txInfo.Size()/4 != rxInfo.Size()/4 {
+		logging.Warnf("tx file %s holds %d samples but rx file %s holds %d; processing the first %d",
+			txPath, txInfo.Size()/4, rxPath, rxInfo.Size()/4, remaining)
+	}
 
-	for {
-		n, err := txFile.Read(buffer)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
+	chunkSize := len(buffer) / 8
+	if chunkSize == 0 {
+		return fmt.Errorf("buffer of %d bytes cannot hold a tx and rx sample", len(buffer))
+	}
+	txBuffer, rxBuffer := buffer[:chunkSize*4], buffer[chunkSize*4:chunkSize*8]
+	tx := make([]float64, chunkSize)
+	rx := make([]float64, chunkSize)
+
+	for remaining > 0 {
+		count := int(min(int64(chunkSize), remaining))
+		if _, err := io.ReadFull(txFile, txBuffer[:count*4]); err != nil {
 			return fmt.Errorf("error reading tx file: %v", err)
 		}
+		if _, err := io.ReadFull(rxFile, rxBuffer[:count*4]); err != nil {
+			return fmt.Errorf("error reading rx file: %v", err)
+		}
 
 		// Convert bytes to float64
-		reader := bytes.NewReader(buffer[:n])
-		err = binary.Read(reader, binary.LittleEndian, &data)
-		if err != nil {
-			return fmt.Errorf("error converting data: %v", err)
+		for i := 0; i < count; i++ {
+			tx[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(txBuffer[i*4:])))
+			rx[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(rxBuffer[i*4:])))
 		}
 
 		// Process chunk
-		err = processChunk(data)
-		if err != nil {
+		if err := processChunk(tx[:count], rx[:count]); err != nil {
 			return fmt.Errorf("error processing chunk: %v", err)
 		}
+		remaining -= int64(count)
 	}
 
 	return nil
@@ -818,7 +3627,7 @@ func processFilesInChunks(txPath, rxPath string, buffer []byte, maxSamples int,
 func GetExecutablePath() string {
 	ex, err := os.Executable()
 	if err != nil {
-		log.Printf("Error getting executable path: %v", err)
+		logging.Errorf("Error getting executable path: %v", err)
 		return ""
 	}
 	return filepath.Dir(ex)
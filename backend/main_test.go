@@ -0,0 +1,950 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"novacal/calibration"
+	"novacal/timeseries"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// recorder is a jsonWriter that keeps every message a handler sends
+type recorder struct {
+	mu       sync.Mutex
+	messages []map[string]interface{}
+}
+
+func (r *recorder) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var message map[string]interface{}
+	if err := json.Unmarshal(data, &message); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.messages = append(r.messages, message)
+	r.mu.Unlock()
+	return nil
+}
+
+// response returns the last message of type want, failing if the handler
+// sent an error or no such message
+func (r *recorder) response(t *testing.T, want string) map[string]interface{} {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.messages) - 1; i >= 0; i-- {
+		switch r.messages[i]["type"] {
+		case want:
+			return r.messages[i]
+		case "error":
+			t.Fatalf("handler failed: %v", r.messages[i]["message"])
+		}
+	}
+	t.Fatalf("no %s message in %d messages", want, len(r.messages))
+	return nil
+}
+
+// call runs a handler on request, encoded as JSON, and records its messages
+func call(t *testing.T, handler func(jsonWriter, []byte), request map[string]interface{}) *recorder {
+	t.Helper()
+	message, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &recorder{}
+	handler(r, message)
+	return r
+}
+
+// writeSamples writes data as a float32 .bin file in a temporary directory
+func writeSamples(t *testing.T, name string, data []float64) string {
+	t.Helper()
+	samples := make([]float32, len(data))
+	for i, v := range data {
+		samples[i] = float32(v)
+	}
+	return writeFile(t, name, samples)
+}
+
+func writeFile(t *testing.T, name string, data interface{}) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := binary.Write(file, binary.LittleEndian, data); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// sine returns n samples of amplitude*sin(2*pi*freq*t) at rate
+func sine(n int, amplitude, freq, rate float64) []float64 {
+	data := make([]float64, n)
+	for i := range data {
+		data[i] = amplitude * math.Sin(2*math.Pi*freq*float64(i)/rate)
+	}
+	return data
+}
+
+// dialBackend starts the WebSocket handler on a test server and connects a
+// client to it
+func dialBackend(t *testing.T) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// exchange sends request and returns the first response of type want,
+// failing on an error response
+func exchange(t *testing.T, conn *websocket.Conn, request map[string]interface{}, want string) map[string]interface{} {
+	t.Helper()
+	if err := conn.WriteJSON(request); err != nil {
+		t.Fatalf("write %v: %v", request["type"], err)
+	}
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		var response map[string]interface{}
+		if err := conn.ReadJSON(&response); err != nil {
+			t.Fatalf("read %s: %v", want, err)
+		}
+		switch response["type"] {
+		case want:
+			return response
+		case "error":
+			t.Fatalf("%v failed: %v", request["type"], response["message"])
+		}
+	}
+}
+
+// decode converts a generic JSON value into v
+func decode(t *testing.T, value interface{}, v interface{}) {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenerateSignalWritesFloat32Samples(t *testing.T) {
+	conn := dialBackend(t)
+	path := filepath.Join(t.TempDir(), "sine.bin")
+
+	const rate, freq, amplitude = 1000.0, 10.0, 2.0
+	response := exchange(t, conn, map[string]interface{}{
+		"type":       "generateSignal",
+		"outputPath": path,
+		"signal": map[string]interface{}{
+			"waveform":   "sine",
+			"amplitude":  amplitude,
+			"frequency":  freq,
+			"sampleRate": rate,
+			"duration":   1,
+		},
+	}, "signalGenerated")
+	if samples, _ := response["samples"].(float64); samples != rate {
+		t.Fatalf("generated %v samples, want %v", response["samples"], rate)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) != int(rate)*4 {
+		t.Fatalf("file holds %d bytes, want %d float32 samples", len(raw), int(rate))
+	}
+	// A quarter period in, the sine is at its peak
+	quarter := int(rate / freq / 4)
+	if got := math.Float32frombits(binary.LittleEndian.Uint32(raw[quarter*4:])); math.Abs(float64(got)-amplitude) > 1e-6 {
+		t.Errorf("sample %d is %v, want %v", quarter, got, amplitude)
+	}
+}
+
+func TestGeneratedSinePeaksAtItsFrequency(t *testing.T) {
+	conn := dialBackend(t)
+	path := filepath.Join(t.TempDir(), "sine.bin")
+
+	const rate, freq, amplitude = 51200.0, 1000.0, 2.0
+	exchange(t, conn, map[string]interface{}{
+		"type":       "generateSignal",
+		"outputPath": path,
+		"signal": map[string]interface{}{
+			"waveform":   "sine",
+			"amplitude":  amplitude,
+			"frequency":  freq,
+			"sampleRate": rate,
+			"duration":   2,
+		},
+	}, "signalGenerated")
+
+	response := exchange(t, conn, map[string]interface{}{
+		"type":  "computeFFT",
+		"files": []string{path},
+	}, "fftResults")
+
+	var results map[string]struct {
+		Frequencies []float64 `json:"frequencies"`
+		Magnitudes  []float64 `json:"magnitudes"`
+	}
+	decode(t, response["data"], &results)
+	result, ok := results["sine.bin"]
+	if !ok || len(result.Magnitudes) == 0 {
+		t.Fatalf("no spectrum for sine.bin in %v", response)
+	}
+
+	peak := 0
+	for i, m := range result.Magnitudes {
+		if m > result.Magnitudes[peak] {
+			peak = i
+		}
+	}
+	binWidth := rate / 65536
+	if got := result.Frequencies[peak]; math.Abs(got-freq) > binWidth {
+		t.Errorf("peak at %v Hz, want %v Hz", got, freq)
+	}
+	if got, want := result.Magnitudes[peak], 20*math.Log10(amplitude); math.Abs(got-want) > 0.1 {
+		t.Errorf("peak of %.2f dB, want %.2f dB", got, want)
+	}
+	if top := result.Frequencies[len(result.Frequencies)-1]; math.Abs(top-rate/2) > binWidth {
+		t.Errorf("spectrum ends at %v Hz, want Nyquist %v Hz", top, rate/2)
+	}
+}
+
+func TestGenerateSignalRejectsInvalidSignals(t *testing.T) {
+	defer func(limit int) { maxSamples = limit }(maxSamples)
+	maxSamples = 1000
+
+	conn := dialBackend(t)
+	path := filepath.Join(t.TempDir(), "signal.bin")
+	for name, signal := range map[string]map[string]interface{}{
+		"over the sample limit": {"waveform": "sine", "frequency": 10, "sampleRate": 1000, "duration": 2},
+		"chirp without an end":  {"waveform": "chirp", "frequency": 10, "sampleRate": 1000, "duration": 1},
+	} {
+		exchange(t, conn, map[string]interface{}{
+			"type":       "generateSignal",
+			"outputPath": path,
+			"signal":     signal,
+		}, "error")
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("signal %s was written", name)
+		}
+	}
+}
+
+func TestOversizedRequestsAreCapped(t *testing.T) {
+	defer func(plot, fft int) { maxPlotPoints, maxFFTPoints = plot, fft }(maxPlotPoints, maxFFTPoints)
+	maxPlotPoints, maxFFTPoints = 1000, 500
+
+	conn := dialBackend(t)
+	data := sine(200000, 1, 1000, 51200)
+
+	plot := exchange(t, conn, map[string]interface{}{
+		"type":             "plot",
+		"files":            []string{writeSamples(t, "long.bin", data)},
+		"decimationFactor": 1,
+		"maxPoints":        1 << 30,
+	}, "plotData")
+	var plotData struct {
+		Files []timeseries.FileData `json:"files"`
+	}
+	decode(t, plot, &plotData)
+	if len(plotData.Files) != 1 {
+		t.Fatalf("got %d plotted files, want 1", len(plotData.Files))
+	}
+	if n := len(plotData.Files[0].Values); n == 0 || n > maxPlotPoints {
+		t.Errorf("plot returned %d points, want at most %d", n, maxPlotPoints)
+	}
+
+	spectrum := exchange(t, conn, map[string]interface{}{
+		"type":      "computeFFT",
+		"files":     []string{writeSamples(t, "long.bin", data)},
+		"maxPoints": 1 << 30,
+	}, "fftResults")
+	var results map[string]struct {
+		Frequencies []float64 `json:"frequencies"`
+	}
+	decode(t, spectrum["data"], &results)
+	if n := len(results["long.bin"].Frequencies); n == 0 || n > maxFFTPoints {
+		t.Errorf("FFT returned %d bins, want at most %d", n, maxFFTPoints)
+	}
+}
+
+// peakFrequency returns the frequency of the strongest bin of a spectrum
+func peakFrequency(frequencies, magnitudes []float64) float64 {
+	peak := 0
+	for i, m := range magnitudes {
+		if m > magnitudes[peak] {
+			peak = i
+		}
+	}
+	return frequencies[peak]
+}
+
+func TestInterleavedChannelsShowTheirOwnTone(t *testing.T) {
+	conn := dialBackend(t)
+
+	const rate = 51200.0
+	tones := []float64{1000, 3000}
+	first, second := sine(65536, 1, tones[0], rate), sine(65536, 1, tones[1], rate)
+	interleaved := make([]float64, 0, 2*len(first))
+	for i := range first {
+		interleaved = append(interleaved, first[i], second[i])
+	}
+	path := writeSamples(t, "stereo.bin", interleaved)
+
+	for channel, tone := range tones {
+		response := exchange(t, conn, map[string]interface{}{
+			"type":        "computeFFT",
+			"files":       []string{path},
+			"numChannels": 2,
+			"channel":     channel,
+		}, "fftResults")
+		var results map[string]struct {
+			Frequencies []float64 `json:"frequencies"`
+			Magnitudes  []float64 `json:"magnitudes"`
+		}
+		decode(t, response["data"], &results)
+		result := results["stereo.bin"]
+		if len(result.Magnitudes) == 0 {
+			t.Fatalf("channel %d: no spectrum in %v", channel, response)
+		}
+		if got := peakFrequency(result.Frequencies, result.Magnitudes); math.Abs(got-tone) > 1 {
+			t.Errorf("channel %d peaks at %v Hz, want %v Hz", channel, got, tone)
+		}
+	}
+
+	exchange(t, conn, map[string]interface{}{
+		"type":        "computeFFT",
+		"files":       []string{path},
+		"numChannels": 2,
+		"channel":     2,
+	}, "error")
+}
+
+func TestServerStatsCountOpenConnection(t *testing.T) {
+	conn := dialBackend(t)
+	stats := exchange(t, conn, map[string]interface{}{"type": "serverStats"}, "serverStats")
+
+	for _, field := range []string{"goroutines", "activeConnections", "heapAlloc"} {
+		if count, _ := stats[field].(float64); count <= 0 {
+			t.Errorf("%s is %v with a client connected, want a positive count", field, stats[field])
+		}
+	}
+	if _, ok := stats["activeJobs"].(float64); !ok {
+		t.Errorf("activeJobs missing from %v", stats)
+	}
+}
+
+func TestCheckOriginRefusesNullOrigin(t *testing.T) {
+	for origin, want := range map[string]bool{
+		"":                      true,
+		"file://":               true,
+		"http://localhost:5173": true,
+		"null":                  false,
+		"https://example.com":   false,
+	} {
+		r := httptest.NewRequest("GET", "/ws", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if got := checkOrigin(r); got != want {
+			t.Errorf("origin %q accepted = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestPhaseUnitsDefaultToRadians(t *testing.T) {
+	const rate = 51200.0
+	path := writeSamples(t, "tone.bin", sine(65536, 1, 1234.5, rate))
+
+	phases := func(unit string) []float64 {
+		request := map[string]interface{}{
+			"type":       "computeFFT",
+			"files":      []string{path},
+			"sampleRate": rate,
+		}
+		if unit != "" {
+			request["phaseUnit"] = unit
+		}
+		response := call(t, handleComputeFFT, request).response(t, "fftResults")
+		var results map[string]struct {
+			Phases []float64 `json:"phases"`
+		}
+		decode(t, response["data"], &results)
+		if len(results["tone.bin"].Phases) == 0 {
+			t.Fatalf("phaseUnit %q: no phases in %v", unit, response)
+		}
+		return results["tone.bin"].Phases
+	}
+
+	rad, deg, unset := phases("rad"), phases("deg"), phases("")
+	if len(deg) != len(rad) || len(unset) != len(rad) {
+		t.Fatalf("got %d, %d and %d phases", len(rad), len(deg), len(unset))
+	}
+	for i := range rad {
+		if math.Abs(deg[i]-rad[i]*180/math.Pi) > 1e-9 {
+			t.Fatalf("bin %d: %v deg, want %v rad * 180/pi", i, deg[i], rad[i])
+		}
+		if unset[i] != rad[i] {
+			t.Fatalf("bin %d: default phase %v, want %v rad", i, unset[i], rad[i])
+		}
+	}
+
+	if scale, err := phaseScale("deg", ""); err != nil || math.Abs(scale-math.Pi/180) > 1e-15 {
+		t.Errorf("degree results convert by %v (%v) without a unit, want pi/180", scale, err)
+	}
+}
+
+func TestCalibrateRejectsUnknownPhaseUnitBeforeRunning(t *testing.T) {
+	r := call(t, handleCalibrate, map[string]interface{}{
+		"type":      "calibrate",
+		"phaseUnit": "grad",
+	})
+	if len(r.messages) != 1 || r.messages[0]["type"] != "error" {
+		t.Errorf("phaseUnit grad gave %v, want a single error", r.messages)
+	}
+}
+
+func TestFullRequestQueueRefusesRequests(t *testing.T) {
+	defer func(size int) { requestQueueSize = size }(requestQueueSize)
+	requestQueueSize = 1
+
+	path := writeSamples(t, "long.bin", sine(1<<21, 1, 1000, 51200))
+	conn := dialBackend(t)
+
+	// A slow spectrum keeps the worker busy while the rest arrive
+	requests := []map[string]interface{}{{"type": "computeFFT", "files": []string{path}, "average": true}}
+	for i := 0; i < 20; i++ {
+		requests = append(requests, map[string]interface{}{"type": "serverStats", "requestId": fmt.Sprint(i)})
+	}
+	for _, request := range requests {
+		if err := conn.WriteJSON(request); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	answered := 0
+	busy := 0
+	for answered < len(requests) {
+		var response map[string]interface{}
+		if err := conn.ReadJSON(&response); err != nil {
+			t.Fatalf("after %d responses: %v", answered, err)
+		}
+		switch response["type"] {
+		case "fftResults", "serverStats":
+			answered++
+		case "error":
+			answered++
+			if response["errorCode"] != ErrBusy {
+				t.Fatalf("unexpected error %v", response["message"])
+			}
+			if response["requestId"] == nil {
+				t.Errorf("busy error %v lacks the request id", response)
+			}
+			busy++
+		}
+	}
+	if busy == 0 {
+		t.Error("no request was refused with a queue of 1")
+	}
+}
+
+func TestCalibrationStationsAtDifferentRates(t *testing.T) {
+	// A 100 Hz square station at half the rate of a 1 kHz sine station
+	const gain = 0.5
+	square := func(n int, freq, rate float64) []float64 {
+		data := sine(n, 1, freq, rate)
+		for i := range data {
+			data[i] = math.Copysign(1, data[i]+1e-9)
+		}
+		return data
+	}
+	var data []map[string]interface{}
+	for _, station := range []struct {
+		waveform   string
+		rate, freq float64
+		tx         []float64
+	}{
+		{"Sine", 51200, 1000, sine(51200, 1, 1000, 51200)},
+		{"Square", 25600, 100, square(25600, 100, 25600)},
+	} {
+		rx := make([]float64, len(station.tx))
+		for i := range rx {
+			rx[i] = gain * station.tx[i]
+		}
+		data = append(data, map[string]interface{}{
+			"station":    station.waveform,
+			"waveform":   station.waveform,
+			"frequency":  station.freq,
+			"coil":       "coil",
+			"sampleRate": station.rate,
+			"tx":         writeSamples(t, "tx.bin", station.tx),
+			"rx":         writeSamples(t, "rx.bin", rx),
+		})
+	}
+
+	response := call(t, handleCalibrate, map[string]interface{}{"type": "calibrate", "data": data}).
+		response(t, "calibrationComplete")
+	var results map[string]calibration.CalibrationResult
+	decode(t, response["results"], &results)
+	result := results["coil"]
+
+	// Harmonic frequencies come from the spectrum axis, which scales with the rate
+	orders := make(map[int]bool)
+	for _, h := range result.Harmonics {
+		orders[h.Order] = true
+		if want := float64(h.Order) * 100; math.Abs(h.Frequency-want) > 1 {
+			t.Errorf("harmonic %d at %v Hz, want %v Hz", h.Order, h.Frequency, want)
+		}
+	}
+	if !orders[1] || !orders[3] {
+		t.Errorf("harmonics %v lack orders 1 and 3", result.Harmonics)
+	}
+	found := false
+	for i, freq := range result.Frequencies {
+		if math.Abs(freq-1000) <= 1 {
+			found = true
+			if want := 20 * math.Log10(gain); math.Abs(result.Amplitudes[i]-want) > 0.1 {
+				t.Errorf("1 kHz amplitude %.2f dB, want %.2f dB", result.Amplitudes[i], want)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("sine station missing from %v", result.Frequencies)
+	}
+
+	data[1]["sampleRate"] = 0
+	invalid := call(t, handleCalibrate, map[string]interface{}{"type": "calibrate", "data": data})
+	if len(invalid.messages) != 1 || invalid.messages[0]["errorCode"] != ErrInvalidRequest {
+		t.Errorf("a zero sample rate gave %v, want an invalid request error", invalid.messages)
+	}
+}
+
+func TestAnalysesRejectRangesOverSampleLimit(t *testing.T) {
+	defer func(limit int) { maxSamples = limit }(maxSamples)
+	maxSamples = 1000
+
+	conn := dialBackend(t)
+	path := writeSamples(t, "long.bin", sine(2000, 1, 10, 1000))
+
+	for _, kind := range []string{"computeHistogram", "findPeaks"} {
+		if err := conn.WriteJSON(map[string]interface{}{"type": kind, "files": []string{path}}); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		var response map[string]interface{}
+		if err := conn.ReadJSON(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response["type"] != "error" || response["errorCode"] != ErrInvalidRequest {
+			t.Errorf("%s of 2000 samples over a limit of 1000 gave %v, want an invalid request error", kind, response)
+		}
+	}
+
+	exchange(t, conn, map[string]interface{}{
+		"type":     "computeHistogram",
+		"files":    []string{path},
+		"endIndex": 1000,
+	}, "histogram")
+}
+
+func TestSkippedNotchesAreReportedWithResults(t *testing.T) {
+	const rate = 51200.0
+	path := writeSamples(t, "hum.bin", sine(65536, 1, 50, rate))
+
+	// Harmonics above Nyquist cannot be notched, and are reported once
+	response := call(t, handleComputeFFT, map[string]interface{}{
+		"type":        "computeFFT",
+		"files":       []string{path},
+		"sampleRate":  rate,
+		"notchFilter": map[string]interface{}{"frequency": 20000, "q": 30, "harmonics": 3},
+	}).response(t, "fftResults")
+
+	warnings, _ := response["warnings"].([]interface{})
+	if len(warnings) != 1 || !strings.Contains(fmt.Sprint(warnings[0]), "40000") {
+		t.Errorf("warnings %v, want one for the notches from 40 kHz up", response["warnings"])
+	}
+
+	negative := call(t, handleComputeFFT, map[string]interface{}{
+		"type":        "computeFFT",
+		"files":       []string{path},
+		"notchFilter": map[string]interface{}{"frequency": 50, "q": 30, "harmonics": -1},
+	})
+	if len(negative.messages) != 1 || negative.messages[0]["type"] != "error" {
+		t.Errorf("harmonics -1 gave %v, want an error", negative.messages)
+	}
+}
+
+func TestCrossCorrelateReadsTheRequestedChannel(t *testing.T) {
+	conn := dialBackend(t)
+
+	// Channel 1 of B is channel 1 of A delayed by 5 samples; channel 0 and
+	// the 8-byte headers are unrelated noise
+	rng := rand.New(rand.NewSource(1))
+	signal := make([]float64, 1005)
+	for i := range signal {
+		signal[i] = rng.NormFloat64()
+	}
+	stereo := func(name string, delay int) string {
+		data := []float64{1e6, -1e6}
+		for i := 0; i < 1000; i++ {
+			data = append(data, rng.NormFloat64(), signal[i+5-delay])
+		}
+		return writeSamples(t, name, data)
+	}
+
+	response := exchange(t, conn, map[string]interface{}{
+		"type":        "crossCorrelate",
+		"fileA":       stereo("a.bin", 0),
+		"fileB":       stereo("b.bin", 5),
+		"maxLag":      10,
+		"numChannels": 2,
+		"channel":     1,
+		"headerBytes": 8,
+	}, "crossCorrelation")
+	if lag, _ := response["bestLag"].(float64); math.Abs(lag) != 5 {
+		t.Errorf("best lag %v, want 5 samples either way", response["bestLag"])
+	}
+}
+
+func TestFilteredTimesStartAtTheClampedIndex(t *testing.T) {
+	conn := dialBackend(t)
+	path := writeSamples(t, "tone.bin", sine(1000, 1, 10, 1000))
+
+	response := exchange(t, conn, map[string]interface{}{
+		"type":       "filterSignal",
+		"files":      []string{path},
+		"startIndex": -5,
+		"kind":       "lowpass",
+		"order":      2,
+		"cutoffs":    []float64{100},
+		"sampleRate": 1000,
+	}, "filteredData")
+	var filtered struct {
+		Files []timeseries.FileData `json:"files"`
+	}
+	decode(t, response, &filtered)
+	if len(filtered.Files) != 1 || len(filtered.Files[0].Times) == 0 {
+		t.Fatalf("no filtered data in %v", response)
+	}
+	if first := filtered.Files[0].Times[0]; first != 0 {
+		t.Errorf("first time %v, want 0 for a range clamped to the file start", first)
+	}
+}
+
+func TestAsyncRESTJobsAreCapped(t *testing.T) {
+	defer func(limit int) { maxRunningRESTJobs = limit }(maxRunningRESTJobs)
+	maxRunningRESTJobs = 1
+
+	release := make(chan struct{})
+	defer close(release)
+	serve := restHandler(func(jsonWriter, []byte) { <-release })
+
+	post := func() int {
+		w := httptest.NewRecorder()
+		serve(w, httptest.NewRequest(http.MethodPost, "/fft?async=1", strings.NewReader("{}")))
+		return w.Code
+	}
+	if code := post(); code != http.StatusAccepted {
+		t.Fatalf("first job got status %d, want %d", code, http.StatusAccepted)
+	}
+	if code := post(); code != http.StatusServiceUnavailable {
+		t.Errorf("job over the cap got status %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestRelativePathsResolveAgainstBaseThenBrowsedThenRoot(t *testing.T) {
+	defer func(root string) { rootDir = root }(rootDir)
+	rootDir = t.TempDir()
+	base, browsed := filepath.Join(rootDir, "base"), filepath.Join(rootDir, "browsed")
+	for _, dir := range []string{base, browsed, rootDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "data.bin"), make([]byte, 8), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct{ baseDir, browsed, want string }{
+		{base, browsed, base},
+		{"", browsed, browsed},
+		{"", "", rootDir},
+	} {
+		paths, err := validateFilePaths([]string{"data.bin"}, fileBase(tt.baseDir, tt.browsed))
+		if want := filepath.Join(tt.want, "data.bin"); err != nil || len(paths) != 1 || paths[0] != want {
+			t.Errorf("baseDir %q, browsed %q: resolved to %v (%v), want %s", tt.baseDir, tt.browsed, paths, err, want)
+		}
+	}
+}
+
+func TestLastBrowsedDirectoryIsPerConnection(t *testing.T) {
+	dirs := map[string]int{t.TempDir(): 10, t.TempDir(): 20}
+	for dir, samples := range dirs {
+		if err := timeseries.WriteBinaryFile(filepath.Join(dir, "data.bin"), make([]float64, samples)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each client browses its own directory before the other asks for a length
+	conns := make(map[string]*websocket.Conn)
+	for dir := range dirs {
+		conns[dir] = dialBackend(t)
+		exchange(t, conns[dir], map[string]interface{}{"type": "listDirectory", "path": dir}, "directoryContents")
+	}
+	for dir, samples := range dirs {
+		response := exchange(t, conns[dir], map[string]interface{}{
+			"type":  "getTotalLength",
+			"files": []string{"data.bin"},
+		}, "totalLength")
+		if got, _ := response["totalLength"].(float64); int(got) != samples {
+			t.Errorf("data.bin from the client browsing %s has %v samples, want %d", dir, response["totalLength"], samples)
+		}
+	}
+}
+
+func TestFileInfoResolvesRelativePaths(t *testing.T) {
+	conn := dialBackend(t)
+	dir := filepath.Dir(writeSamples(t, "data.bin", make([]float64, 10)))
+
+	response := exchange(t, conn, map[string]interface{}{
+		"type":    "fileInfo",
+		"files":   []string{"data.bin", "missing.bin"},
+		"baseDir": dir,
+	}, "fileInfo")
+	var info struct {
+		Files []struct {
+			Path    string `json:"path"`
+			Exists  bool   `json:"exists"`
+			Samples int64  `json:"samples"`
+		} `json:"files"`
+	}
+	decode(t, response, &info)
+	if len(info.Files) != 2 {
+		t.Fatalf("got %d files, want 2", len(info.Files))
+	}
+	if got := info.Files[0]; got.Path != filepath.Join(dir, "data.bin") || !got.Exists || got.Samples != 10 {
+		t.Errorf("data.bin reported as %+v, want 10 samples at %s", got, filepath.Join(dir, "data.bin"))
+	}
+	if info.Files[1].Exists {
+		t.Errorf("missing.bin reported as existing")
+	}
+}
+
+func TestAnalysisHandlersResolveRelativePaths(t *testing.T) {
+	conn := dialBackend(t)
+	dir := filepath.Dir(writeSamples(t, "data.bin", sine(4096, 1, 1000, calibration.DefaultSampleRate)))
+	exchange(t, conn, map[string]interface{}{"type": "listDirectory", "path": dir}, "directoryContents")
+
+	plot := exchange(t, conn, map[string]interface{}{
+		"type":     "plot",
+		"files":    []string{"data.bin"},
+		"endIndex": 4096,
+	}, "plotData")
+	if got, _ := plot["totalLength"].(float64); got != 4096 {
+		t.Errorf("plot of data.bin has %v samples, want 4096", plot["totalLength"])
+	}
+
+	spectrum := exchange(t, conn, map[string]interface{}{
+		"type":  "computeFFT",
+		"files": []string{"data.bin"},
+	}, "fftResults")
+	var results map[string]interface{}
+	decode(t, spectrum["data"], &results)
+	if _, ok := results["data.bin"]; !ok {
+		t.Errorf("no spectrum for data.bin in %v", spectrum)
+	}
+}
+
+func TestWatchReportsAppendedSamples(t *testing.T) {
+	conn := dialBackend(t)
+	path := writeSamples(t, "live.bin", []float64{1, 2, 3})
+
+	watching := exchange(t, conn, map[string]interface{}{
+		"type":     "watchFile",
+		"path":     path,
+		"interval": 50,
+	}, "watchingFile")
+	if watching["length"] != 3.0 {
+		t.Fatalf("watch started at length %v, want 3", watching["length"])
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = binary.Write(file, binary.LittleEndian, []float32{4, 5})
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var appended map[string]interface{}
+	if err := conn.ReadJSON(&appended); err != nil {
+		t.Fatalf("no notification after appending: %v", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+	if appended["type"] != "fileAppended" || appended["length"] != 5.0 || appended["previousLength"] != 3.0 {
+		t.Errorf("got %v, want fileAppended from 3 to 5 samples", appended)
+	}
+
+	stopped := exchange(t, conn, map[string]interface{}{"type": "unwatchFile", "path": path}, "unwatchedFile")
+	if stopped["stopped"] != 1.0 {
+		t.Errorf("unwatch stopped %v watches, want 1", stopped["stopped"])
+	}
+}
+
+func TestSymlinksOutOfRootAreDenied(t *testing.T) {
+	defer func(root string) { rootDir = root }(rootDir)
+	dir := t.TempDir()
+	rootDir = filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{filepath.Join(rootDir, "data"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(rootDir, "escape")); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+	links := map[string]string{
+		"inside":  filepath.Join(rootDir, "data"),
+		"dangles": filepath.Join(outside, "missing.bin"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(rootDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		path    string
+		allowed bool
+	}{
+		{"data/new/out.bin", true},
+		{"inside/out.bin", true},
+		{"escape", false},
+		{"escape/secret.bin", false},
+		{"escape/new/out.bin", false},
+		{"dangles", false},
+	} {
+		_, err := resolvePath(filepath.Join(rootDir, tt.path))
+		if allowed := err == nil; allowed != tt.allowed {
+			t.Errorf("%s: allowed %v (%v), want %v", tt.path, allowed, err, tt.allowed)
+		}
+	}
+}
+
+func TestCorrelationCurvesAreLimitedToMaxPoints(t *testing.T) {
+	conn := dialBackend(t)
+	rng := rand.New(rand.NewSource(1))
+	signal := make([]float64, 2005)
+	for i := range signal {
+		signal[i] = rng.NormFloat64()
+	}
+	a := writeSamples(t, "a.bin", signal[5:])
+	b := writeSamples(t, "b.bin", signal[:2000])
+
+	response := exchange(t, conn, map[string]interface{}{
+		"type":      "crossCorrelate",
+		"fileA":     a,
+		"fileB":     b,
+		"maxPoints": 100,
+	}, "crossCorrelation")
+	var cross struct {
+		Lags        []float64 `json:"lags"`
+		Correlation []float64 `json:"correlation"`
+		MaxLag      int       `json:"maxLag"`
+		BestLag     int       `json:"bestLag"`
+	}
+	decode(t, response, &cross)
+	if len(cross.Correlation) == 0 || len(cross.Correlation) > 100 || len(cross.Lags) != len(cross.Correlation) {
+		t.Errorf("got %d lags and %d values, want matching counts of at most 100", len(cross.Lags), len(cross.Correlation))
+	}
+	if cross.MaxLag != 1999 || cross.BestLag != 5 {
+		t.Errorf("max lag %d and best lag %d, want 1999 and 5", cross.MaxLag, cross.BestLag)
+	}
+}
+
+func TestAutoCorrelationIsLimitedToMaxPoints(t *testing.T) {
+	conn := dialBackend(t)
+	path := writeSamples(t, "tone.bin", sine(5000, 1, 50, 1000))
+
+	response := exchange(t, conn, map[string]interface{}{
+		"type":      "autoCorrelate",
+		"file":      path,
+		"maxPoints": 100,
+	}, "autoCorrelation")
+	var auto struct {
+		Lags        []float64 `json:"lags"`
+		Correlation []float64 `json:"correlation"`
+		MaxLag      int       `json:"maxLag"`
+		Period      int       `json:"period"`
+	}
+	decode(t, response, &auto)
+	if len(auto.Correlation) == 0 || len(auto.Correlation) > 100 || len(auto.Lags) != len(auto.Correlation) {
+		t.Errorf("got %d lags and %d values, want matching counts of at most 100", len(auto.Lags), len(auto.Correlation))
+	}
+	if auto.MaxLag != 4999 || auto.Period != 20 {
+		t.Errorf("max lag %d and period %d, want 4999 and 20", auto.MaxLag, auto.Period)
+	}
+}
+
+func TestChunksPairTxAndRxUpToTheShorterFile(t *testing.T) {
+	tx := sine(1000, 1, 3, 1000)
+	rx := sine(997, 0.5, 7, 1000)
+	txPath, rxPath := writeSamples(t, "tx.bin", tx), writeSamples(t, "rx.bin", rx)
+
+	// 64 samples per chunk leaves a partial last chunk
+	var gotTx, gotRx []float64
+	err := processFilesInChunks(txPath, rxPath, make([]byte, 64*8), func(txChunk, rxChunk []float64) error {
+		if len(txChunk) != len(rxChunk) || len(txChunk) > 64 {
+			t.Fatalf("chunk of %d tx and %d rx samples", len(txChunk), len(rxChunk))
+		}
+		gotTx = append(gotTx, txChunk...)
+		gotRx = append(gotRx, rxChunk...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gotTx) != len(rx) {
+		t.Fatalf("processed %d samples, want the %d of the shorter file", len(gotTx), len(rx))
+	}
+	for i := range gotTx {
+		if gotTx[i] != float64(float32(tx[i])) || gotRx[i] != float64(float32(rx[i])) {
+			t.Fatalf("sample %d is (%v, %v), want (%v, %v)", i, gotTx[i], gotRx[i], float32(tx[i]), float32(rx[i]))
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"novacal/logging"
+)
+
+// Name of the file written next to the executable with browsed directories
+const recentDirsFileName = "novacal_dirs.json"
+
+// Number of recently browsed directories kept
+const maxRecentDirs = 20
+
+// directoryHistory persists recently browsed and pinned directories so they
+// survive restarts
+type directoryHistory struct {
+	mu     sync.Mutex
+	loaded bool
+	Recent []string `json:"recent"` // Most recent first
+	Pinned []string `json:"pinned"`
+}
+
+var dirHistory = &directoryHistory{}
+
+func recentDirsPath() string {
+	dir := GetExecutablePath()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, recentDirsFileName)
+}
+
+// load reads the history file once; the caller holds h.mu
+func (h *directoryHistory) load() {
+	if h.loaded {
+		return
+	}
+	h.loaded = true
+	path := recentDirsPath()
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logging.Warnf("Error reading %s: %v", path, err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		logging.Warnf("Ignoring malformed %s: %v", path, err)
+		h.Recent, h.Pinned = nil, nil
+	}
+}
+
+// save writes the history through a temporary file so a crash cannot leave
+// it truncated; the caller holds h.mu
+func (h *directoryHistory) save() {
+	path := recentDirsPath()
+	if path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		logging.Errorf("Error encoding directory history: %v", err)
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		logging.Errorf("Error writing directory history: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		logging.Errorf("Error writing directory history: %v", err)
+	}
+}
+
+// visit moves dir to the front of the recent list
+func (h *directoryHistory) visit(dir string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+	if len(h.Recent) > 0 && h.Recent[0] == dir {
+		return
+	}
+	recent := append([]string{dir}, without(h.Recent, dir)...)
+	if len(recent) > maxRecentDirs {
+		recent = recent[:maxRecentDirs]
+	}
+	h.Recent = recent
+	h.save()
+}
+
+// pin adds dir to or removes it from the favourites
+func (h *directoryHistory) pin(dir string, pinned bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+	h.Pinned = without(h.Pinned, dir)
+	if pinned {
+		h.Pinned = append(h.Pinned, dir)
+	}
+	h.save()
+}
+
+// list returns the recent and pinned directories that are still inside the
+// allowed root
+func (h *directoryHistory) list() ([]string, []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+	allowed := func(dirs []string) []string {
+		kept := make([]string, 0, len(dirs))
+		for _, dir := range dirs {
+			if checkPaths(dir) == nil {
+				kept = append(kept, dir)
+			}
+		}
+		return kept
+	}
+	return allowed(h.Recent), allowed(h.Pinned)
+}
+
+func without(dirs []string, dir string) []string {
+	kept := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		if d != dir {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+// browsedDirs keeps the directory each connection listed last, so relative
+// paths resolve against where that client is browsing rather than wherever
+// another client, or an earlier session in the history, went last
+type browsedDirs struct {
+	mu   sync.Mutex
+	dirs map[*websocket.Conn]string
+}
+
+var lastBrowsed = &browsedDirs{dirs: make(map[*websocket.Conn]string)}
+
+// set records dir as the last directory listed by conn
+func (b *browsedDirs) set(conn *websocket.Conn, dir string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dirs[conn] = dir
+}
+
+// get returns the last directory listed by conn, or "" when it listed none
+func (b *browsedDirs) get(conn *websocket.Conn) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dirs[conn]
+}
+
+// forget drops the directory of a closed connection
+func (b *browsedDirs) forget(conn *websocket.Conn) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.dirs, conn)
+}
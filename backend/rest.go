@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"novacal/logging"
+	"strings"
+	"sync"
+	"time"
+)
+
+// restEndpoints mirrors the core WebSocket operations as POST endpoints that
+// take the same JSON bodies
+var restEndpoints = map[string]func(jsonWriter, []byte){
+	"/fft":       handleComputeFFT,
+	"/plot":      handlePlot,
+	"/calibrate": handleCalibrate,
+	"/fir":       handleCalculateFIR,
+}
+
+// Number of finished asynchronous REST jobs kept for /status
+const maxFinishedRESTJobs = 100
+
+// Asynchronous REST jobs that may run at once, overridable through
+// NOVACAL_MAX_REST_JOBS; further async requests are refused with ErrBusy
+var maxRunningRESTJobs = envInt("NOVACAL_MAX_REST_JOBS", 8)
+
+// registerREST adds the REST endpoints to mux
+func registerREST(mux *http.ServeMux) {
+	for path, handler := range restEndpoints {
+		mux.HandleFunc("POST "+path, restHandler(handler))
+	}
+	mux.HandleFunc("GET /status/{id}", handleRESTStatus)
+}
+
+// messageCollector is a jsonWriter that keeps the messages a handler writes
+// so they can be returned over HTTP. Progress messages only update the
+// latest progress.
+type messageCollector struct {
+	mu        sync.Mutex
+	messages  []json.RawMessage
+	progress  int
+	errorCode string
+}
+
+func (c *messageCollector) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var header struct {
+		Type      string `json:"type"`
+		Progress  *int   `json:"progress"`
+		ErrorCode string `json:"errorCode"`
+	}
+	json.Unmarshal(data, &header)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if strings.HasSuffix(header.Type, "Progress") {
+		if header.Progress != nil {
+			c.progress = *header.Progress
+		}
+		return nil
+	}
+	if header.Type == "error" && c.errorCode == "" {
+		c.errorCode = header.ErrorCode
+	}
+	c.messages = append(c.messages, data)
+	return nil
+}
+
+// result returns the HTTP status and body for the collected messages
+func (c *messageCollector) result() (int, map[string]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := http.StatusOK
+	switch c.errorCode {
+	case "":
+	case ErrInvalidRequest:
+		status = http.StatusBadRequest
+	case ErrAccessDenied:
+		status = http.StatusForbidden
+	case ErrFileNotFound:
+		status = http.StatusNotFound
+	case ErrTimeout:
+		status = http.StatusGatewayTimeout
+	case ErrBusy:
+		status = http.StatusServiceUnavailable
+	default:
+		status = http.StatusInternalServerError
+	}
+	return status, map[string]interface{}{
+		"messages": append([]json.RawMessage{}, c.messages...),
+	}
+}
+
+// restJob is an asynchronous REST request, polled through /status/{id}
+type restJob struct {
+	collector *messageCollector
+	started   time.Time
+	done      chan struct{}
+}
+
+var (
+	restJobsMu  sync.Mutex
+	restJobs    = make(map[string]*restJob)
+	restJobIDs  []string // Oldest first, for evicting finished jobs
+	restJobNext int
+)
+
+// startRESTJob runs handler on body in the background and returns its id.
+// It fails without starting anything when maxRunningRESTJobs are running.
+func startRESTJob(path string, handler func(jsonWriter, []byte), body []byte) (string, error) {
+	j := &restJob{collector: &messageCollector{}, started: time.Now(), done: make(chan struct{})}
+
+	restJobsMu.Lock()
+	running := 0
+	for _, id := range restJobIDs {
+		if !restJobs[id].finished() {
+			running++
+		}
+	}
+	if running >= maxRunningRESTJobs {
+		restJobsMu.Unlock()
+		return "", fmt.Errorf("%d REST jobs are already running, retry later", running)
+	}
+	restJobNext++
+	id := fmt.Sprintf("%s-%d", strings.TrimPrefix(path, "/"), restJobNext)
+	restJobs[id] = j
+	restJobIDs = append(restJobIDs, id)
+	pruneRESTJobs()
+	restJobsMu.Unlock()
+
+	go func() {
+		defer close(j.done)
+		handler(j.collector, body)
+	}()
+	return id, nil
+}
+
+// pruneRESTJobs forgets the oldest finished jobs beyond maxFinishedRESTJobs;
+// the caller holds restJobsMu
+func pruneRESTJobs() {
+	finished := 0
+	for _, id := range restJobIDs {
+		if restJobs[id].finished() {
+			finished++
+		}
+	}
+	kept := restJobIDs[:0]
+	for _, id := range restJobIDs {
+		if finished > maxFinishedRESTJobs && restJobs[id].finished() {
+			delete(restJobs, id)
+			finished--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	restJobIDs = kept
+}
+
+func (j *restJob) finished() bool {
+	select {
+	case <-j.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// restHandler serves one mirrored operation, synchronously by default or as
+// a background job when the query has async=true
+func restHandler(handler func(jsonWriter, []byte)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkOrigin(r) {
+			writeRESTJSON(w, http.StatusForbidden, Message{Type: "error", Message: "Origin not allowed", ErrorCode: ErrAccessDenied})
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageBytes))
+		if err != nil || !json.Valid(body) {
+			writeRESTJSON(w, http.StatusBadRequest, Message{Type: "error", Message: "Request body must be a JSON object", ErrorCode: ErrInvalidRequest})
+			return
+		}
+
+		if async := r.URL.Query().Get("async"); async == "1" || async == "true" {
+			id, err := startRESTJob(r.URL.Path, handler, body)
+			if err != nil {
+				writeRESTJSON(w, http.StatusServiceUnavailable, Message{Type: "error", Message: err.Error(), ErrorCode: ErrBusy})
+				return
+			}
+			logging.Infof("Started REST job %s", id)
+			writeRESTJSON(w, http.StatusAccepted, map[string]interface{}{
+				"jobId":  id,
+				"status": "/status/" + id,
+			})
+			return
+		}
+
+		collector := &messageCollector{}
+		handler(collector, body)
+		status, result := collector.result()
+		writeRESTJSON(w, status, result)
+	}
+}
+
+// handleRESTStatus reports the progress of an asynchronous REST job and, once
+// it has finished, its messages
+func handleRESTStatus(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	restJobsMu.Lock()
+	j, ok := restJobs[id]
+	restJobsMu.Unlock()
+	if !ok {
+		writeRESTJSON(w, http.StatusNotFound, Message{Type: "error", Message: "Unknown job " + id, ErrorCode: ErrInvalidRequest})
+		return
+	}
+
+	response := map[string]interface{}{
+		"jobId":   id,
+		"started": j.started,
+	}
+	if !j.finished() {
+		j.collector.mu.Lock()
+		response["status"] = "running"
+		response["progress"] = j.collector.progress
+		j.collector.mu.Unlock()
+		writeRESTJSON(w, http.StatusOK, response)
+		return
+	}
+
+	status, result := j.collector.result()
+	response["status"] = "done"
+	response["httpStatus"] = status
+	response["messages"] = result["messages"]
+	writeRESTJSON(w, http.StatusOK, response)
+}
+
+func writeRESTJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Errorf("Error writing REST response: %v", err)
+	}
+}
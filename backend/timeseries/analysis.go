@@ -0,0 +1,354 @@
+package timeseries
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+)
+
+// SettlingMetrics describes how a step response settles to its final value
+type SettlingMetrics struct {
+	InitialValue    float64 `json:"initialValue"`
+	FinalValue      float64 `json:"finalValue"`
+	SettlingIndex   int     `json:"settlingIndex"`   // First sample after which the signal stays in the band
+	SettlingTime    float64 `json:"settlingTime"`    // Seconds, or samples when no sample rate is given
+	OvershootPct    float64 `json:"overshootPct"`    // Peak excursion beyond the final value, % of the step
+	Tolerance       float64 `json:"tolerance"`       // Band half-width as a fraction of the step
+	SteadyStateFrom int     `json:"steadyStateFrom"` // Start of the region used for the final value
+}
+
+// steadyStateFraction is the trailing portion of the signal assumed to be
+// settled when estimating the final value
+const steadyStateFraction = 0.1
+
+// DetectSteadyState returns the start index of the trailing steady-state
+// region and the mean value over it
+func DetectSteadyState(data []float64) (int, float64) {
+	n := len(data)
+	if n == 0 {
+		return 0, 0
+	}
+
+	start := n - int(math.Ceil(float64(n)*steadyStateFraction))
+	sum := 0.0
+	for _, v := range data[start:] {
+		sum += v
+	}
+	return start, sum / float64(n-start)
+}
+
+// ComputeSettling measures the settling time and overshoot of a step
+// response. tolerance is the band half-width as a fraction of the step size;
+// sampleRate converts the settling index to seconds when positive.
+func ComputeSettling(data []float64, tolerance, sampleRate float64) (*SettlingMetrics, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("not enough samples to compute settling: %d", len(data))
+	}
+	if tolerance <= 0 || tolerance >= 1 {
+		return nil, fmt.Errorf("tolerance must be between 0 and 1, got %v", tolerance)
+	}
+
+	steadyFrom, final := DetectSteadyState(data)
+	initial := data[0]
+	step := final - initial
+	if step == 0 {
+		return nil, fmt.Errorf("signal has no step between initial and final value")
+	}
+
+	// Last sample outside the tolerance band
+	band := tolerance * math.Abs(step)
+	settlingIndex := 0
+	for i := len(data) - 1; i >= 0; i-- {
+		if math.Abs(data[i]-final) > band {
+			settlingIndex = i + 1
+			break
+		}
+	}
+
+	// Largest excursion past the final value in the direction of the step
+	overshoot := 0.0
+	for _, v := range data {
+		if excursion := (v - final) * math.Copysign(1, step); excursion > overshoot {
+			overshoot = excursion
+		}
+	}
+
+	settlingTime := float64(settlingIndex)
+	if sampleRate > 0 {
+		settlingTime /= sampleRate
+	}
+
+	return &SettlingMetrics{
+		InitialValue:    initial,
+		FinalValue:      final,
+		SettlingIndex:   settlingIndex,
+		SettlingTime:    settlingTime,
+		OvershootPct:    overshoot / math.Abs(step) * 100,
+		Tolerance:       tolerance,
+		SteadyStateFrom: steadyFrom,
+	}, nil
+}
+
+// CrossCorrelate returns the normalised cross-correlation of a and b for lags
+// -maxLag..maxLag, where element i holds lag i-maxLag and a positive lag means
+// b is delayed relative to a, along with the lag of the correlation peak.
+// Both signals are truncated to the shorter length. A maxLag of 0 or less, or
+// beyond the signal length, covers every possible lag.
+func CrossCorrelate(a, b []float64, maxLag int) ([]float64, int) {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	if n == 0 {
+		return []float64{}, 0
+	}
+	if maxLag <= 0 || maxLag > n-1 {
+		maxLag = n - 1
+	}
+
+	// Zero-pad so the circular correlation computed by the FFT is linear
+	size := nextPowerOfTwo(2 * n)
+	fft := fourier.NewFFT(size)
+	padded := make([]float64, size)
+	copy(padded, a[:n])
+	specA := fft.Coefficients(nil, padded)
+	for i := range padded {
+		padded[i] = 0
+	}
+	copy(padded, b[:n])
+	specB := fft.Coefficients(nil, padded)
+	for i := range specA {
+		specA[i] = complex(real(specA[i]), -imag(specA[i])) * specB[i]
+	}
+	circular := fft.Sequence(nil, specA)
+
+	energyA, energyB := 0.0, 0.0
+	for i := 0; i < n; i++ {
+		energyA += a[i] * a[i]
+		energyB += b[i] * b[i]
+	}
+	norm := math.Sqrt(energyA*energyB) * float64(size) // Sequence is unnormalised
+	if norm == 0 {
+		norm = 1
+	}
+
+	correlation := make([]float64, 2*maxLag+1)
+	bestLag, best := 0, math.Inf(-1)
+	for lag := -maxLag; lag <= maxLag; lag++ {
+		value := circular[(lag+size)%size] / norm
+		correlation[lag+maxLag] = value
+		if value > best {
+			bestLag, best = lag, value
+		}
+	}
+	return correlation, bestLag
+}
+
+// Fraction of the highest autocorrelation peak that an earlier peak must
+// reach to be taken as the period, so a strong first cycle wins over its
+// multiples
+const periodPeakFraction = 0.9
+
+// Weakest autocorrelation peak accepted as a period; noise stays well below
+const minPeriodCorrelation = 0.3
+
+// AutoCorrelate returns the normalised autocorrelation of data with its mean
+// removed for lags 0..maxLag, where element i holds lag i, along with the
+// fundamental period in samples. A maxLag of 0 or less, or beyond the signal
+// length, covers every lag.
+//
+// The period is searched among lags up to half the signal, after the
+// correlation first turns negative, with each lag rescaled by n/(n-lag) so
+// the shrinking overlap does not pull peaks towards shorter lags. It is the
+// top of the first lobe to come within periodPeakFraction of the highest
+// local maximum, or 0 when no maximum reaches minPeriodCorrelation.
+func AutoCorrelate(data []float64, maxLag int) ([]float64, int) {
+	n := len(data)
+	if n == 0 {
+		return []float64{}, 0
+	}
+	mean := 0.0
+	for _, v := range data {
+		mean += v
+	}
+	mean /= float64(n)
+	centered := make([]float64, n)
+	for i, v := range data {
+		centered[i] = v - mean
+	}
+
+	full, _ := CrossCorrelate(centered, centered, maxLag)
+	correlation := full[(len(full)-1)/2:]
+
+	searchEnd := min(len(correlation), n/2+1)
+	unbiased := make([]float64, searchEnd)
+	for lag := range unbiased {
+		unbiased[lag] = correlation[lag] * float64(n) / float64(n-lag)
+	}
+
+	// Skip the central lobe, which falls away from 1 at lag 0
+	start := 1
+	for start < searchEnd && unbiased[start] >= 0 {
+		start++
+	}
+	best := 0.0
+	var peaks []int
+	for lag := start + 1; lag < searchEnd-1; lag++ {
+		if unbiased[lag] >= unbiased[lag-1] && unbiased[lag] > unbiased[lag+1] {
+			peaks = append(peaks, lag)
+			best = math.Max(best, unbiased[lag])
+		}
+	}
+	if best < minPeriodCorrelation {
+		return correlation, 0
+	}
+	threshold := periodPeakFraction * best
+	for _, lag := range peaks {
+		if unbiased[lag] < threshold {
+			continue
+		}
+		// Noise breaks a flat peak into several maxima; take the highest
+		// while the lobe stays above the threshold
+		period := lag
+		for j := lag + 1; j < searchEnd && unbiased[j] >= threshold; j++ {
+			if unbiased[j] > unbiased[period] {
+				period = j
+			}
+		}
+		return correlation, period
+	}
+	return correlation, 0
+}
+
+// RMSEnvelope returns the root-mean-square of data over windows of window
+// samples starting every hop samples, with each time being the centre sample
+// index of its window. Squaring before averaging tracks signal power, so the
+// envelope rises and falls with a drive turning on and off regardless of its
+// waveform. A hop of 0 or less uses non-overlapping windows and data shorter
+// than one window yields a single value over all of it.
+func RMSEnvelope(data []float64, window, hop int) ([]float64, []float64) {
+	if window <= 0 || len(data) == 0 {
+		return []float64{}, []float64{}
+	}
+	if hop <= 0 {
+		hop = window
+	}
+	if window > len(data) {
+		window = len(data)
+	}
+
+	// Prefix sums of squares give each window in constant time
+	sumSquares := make([]float64, len(data)+1)
+	for i, v := range data {
+		sumSquares[i+1] = sumSquares[i] + v*v
+	}
+
+	count := (len(data)-window)/hop + 1
+	times := make([]float64, 0, count)
+	rms := make([]float64, 0, count)
+	for start := 0; start+window <= len(data); start += hop {
+		power := (sumSquares[start+window] - sumSquares[start]) / float64(window)
+		times = append(times, float64(start)+float64(window-1)/2)
+		rms = append(rms, math.Sqrt(math.Max(power, 0)))
+	}
+	return times, rms
+}
+
+// HilbertEnvelope returns the magnitude of the analytic signal of data,
+// the instantaneous amplitude of an amplitude-modulated carrier. The analytic
+// signal is formed by keeping the DC bin (and the Nyquist bin of even-length
+// input), doubling the positive frequencies and zeroing the negative ones
+// before the inverse transform.
+//
+// The input is zero-padded to a power of two, as the FFT slows to O(n*p) for
+// lengths with a large prime factor p, and the envelope truncated back to n.
+// The mean is removed before padding and added back afterwards so that a DC
+// offset does not become a step at the end of the data.
+func HilbertEnvelope(data []float64) []float64 {
+	n := len(data)
+	if n == 0 {
+		return []float64{}
+	}
+	mean := 0.0
+	for _, v := range data {
+		mean += v
+	}
+	mean /= float64(n)
+
+	size := nextPowerOfTwo(n)
+	fft := fourier.NewCmplxFFT(size)
+	spectrum := make([]complex128, size)
+	for i, v := range data {
+		spectrum[i] = complex(v-mean, 0)
+	}
+	spectrum = fft.Coefficients(spectrum, spectrum)
+
+	// Bins 1..size/2-1 are the positive frequencies and bin size/2 is the
+	// lone Nyquist bin
+	for k := 1; k < size; k++ {
+		switch {
+		case k < size/2:
+			spectrum[k] *= 2
+		case k == size/2:
+		default:
+			spectrum[k] = 0
+		}
+	}
+
+	analytic := fft.Sequence(spectrum, spectrum)
+	envelope := make([]float64, n)
+	for i := range envelope {
+		// Sequence is unnormalised
+		envelope[i] = cmplx.Abs(analytic[i]/complex(float64(size), 0) + complex(mean, 0))
+	}
+	return envelope
+}
+
+// Histogram counts data into bins equal-width bins spanning its minimum to
+// maximum, returning the bins+1 bin edges and the count in each bin.
+// Non-finite samples are skipped.
+func Histogram(data []float64, bins int) ([]float64, []float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range data {
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			lo = math.Min(lo, v)
+			hi = math.Max(hi, v)
+		}
+	}
+	if lo > hi {
+		lo, hi = 0, 0
+	}
+	return HistogramRange(data, bins, lo, hi)
+}
+
+// HistogramRange counts data into bins equal-width bins spanning [lo, hi],
+// with hi counted in the last bin and samples outside the range skipped. An
+// empty range is widened by 0.5 either side so constant data still fills a
+// bin.
+func HistogramRange(data []float64, bins int, lo, hi float64) ([]float64, []float64) {
+	if bins <= 0 || hi < lo {
+		return []float64{}, []float64{}
+	}
+	if lo == hi {
+		lo, hi = lo-0.5, hi+0.5
+	}
+
+	width := (hi - lo) / float64(bins)
+	edges := make([]float64, bins+1)
+	for i := range edges {
+		edges[i] = lo + float64(i)*width
+	}
+	edges[bins] = hi
+
+	counts := make([]float64, bins)
+	for _, v := range data {
+		if !(v >= lo && v <= hi) {
+			continue
+		}
+		bin := min(int((v-lo)/width), bins-1)
+		counts[bin]++
+	}
+	return edges, counts
+}
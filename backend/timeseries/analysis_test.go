@@ -0,0 +1,117 @@
+package timeseries
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSettlingOfDecayingOscillation(t *testing.T) {
+	// Unit step response of an underdamped second-order system
+	const rate, zeta, tolerance = 1000.0, 0.3, 0.02
+	wn := 2 * math.Pi * 10
+	wd := wn * math.Sqrt(1-zeta*zeta)
+	data := make([]float64, 5*int(rate))
+	for i := range data {
+		tt := float64(i) / rate
+		data[i] = 1 - math.Exp(-zeta*wn*tt)*(math.Cos(wd*tt)+zeta/math.Sqrt(1-zeta*zeta)*math.Sin(wd*tt))
+	}
+
+	metrics, err := ComputeSettling(data, tolerance, rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(metrics.FinalValue-1) > 1e-6 {
+		t.Errorf("final value %v, want 1", metrics.FinalValue)
+	}
+
+	wantOvershoot := 100 * math.Exp(-math.Pi*zeta/math.Sqrt(1-zeta*zeta))
+	if math.Abs(metrics.OvershootPct-wantOvershoot) > 0.5 {
+		t.Errorf("overshoot %.2f%%, want %.2f%%", metrics.OvershootPct, wantOvershoot)
+	}
+
+	// The response stays in the band once its decay envelope does, and
+	// leaves it for the last time within the final half period before that
+	envelope := math.Log(1/(tolerance*math.Sqrt(1-zeta*zeta))) / (zeta * wn)
+	if metrics.SettlingTime > envelope || metrics.SettlingTime < envelope-math.Pi/wd {
+		t.Errorf("settling time %.3f s, want within half a period before %.3f s", metrics.SettlingTime, envelope)
+	}
+}
+
+func TestSettlingRejectsFlatSignal(t *testing.T) {
+	if _, err := ComputeSettling(make([]float64, 100), 0.02, 1000); err == nil {
+		t.Error("a signal without a step was accepted")
+	}
+}
+
+func TestCrossCorrelatePeakOfNegativeCorrelation(t *testing.T) {
+	// Every lag correlates negatively; the peak is the least negative one
+	correlation, bestLag := CrossCorrelate([]float64{1, 1}, []float64{-1, -2}, 1)
+	peak := 0
+	for i, v := range correlation {
+		if v > correlation[peak] {
+			peak = i
+		}
+	}
+	if correlation[peak] >= 0 {
+		t.Fatalf("correlation %v is not negative throughout", correlation)
+	}
+	if bestLag != peak-1 || bestLag != -1 {
+		t.Errorf("best lag %d, want -1 where the correlation %v peaks", bestLag, correlation)
+	}
+}
+
+// checkEnvelope compares envelope with want away from the first and last
+// tenth, where truncating the signal disturbs the analytic signal
+func checkEnvelope(t *testing.T, name string, envelope []float64, want func(i int) float64, tolerance float64) {
+	t.Helper()
+	n := len(envelope)
+	for i := n / 10; i < n-n/10; i++ {
+		if math.Abs(envelope[i]-want(i)) > tolerance {
+			t.Fatalf("%s: envelope %v at %d, want %v", name, envelope[i], i, want(i))
+		}
+	}
+}
+
+func TestHilbertEnvelopeOfCarriers(t *testing.T) {
+	for _, n := range []int{1000, 1001, 4099} {
+		carrier := make([]float64, n)
+		modulated := make([]float64, n)
+		modulation := func(i int) float64 { return 1 + 0.5*math.Cos(2*math.Pi*0.002*float64(i)) }
+		for i := range carrier {
+			carrier[i] = 2 * math.Sin(2*math.Pi*0.1*float64(i))
+			modulated[i] = modulation(i) * math.Sin(2*math.Pi*0.1*float64(i))
+		}
+
+		envelope := HilbertEnvelope(carrier)
+		if len(envelope) != n {
+			t.Fatalf("n=%d: %d envelope samples", n, len(envelope))
+		}
+		checkEnvelope(t, "carrier", envelope, func(int) float64 { return 2 }, 0.04)
+		checkEnvelope(t, "AM tone", HilbertEnvelope(modulated), modulation, 0.03)
+	}
+}
+
+func TestHilbertEnvelopeKeepsDCAndNyquist(t *testing.T) {
+	for _, n := range []int{1000, 1001} {
+		constant := make([]float64, n)
+		for i := range constant {
+			constant[i] = 3
+		}
+		for i, v := range HilbertEnvelope(constant) {
+			if math.Abs(v-3) > 1e-9 {
+				t.Fatalf("n=%d: envelope of a constant 3 is %v at %d", n, v, i)
+			}
+		}
+	}
+
+	// Neither doubled nor dropped, the Nyquist tone keeps its amplitude
+	alternating := make([]float64, 1024)
+	for i := range alternating {
+		alternating[i] = 1 - 2*float64(i%2)
+	}
+	for i, v := range HilbertEnvelope(alternating) {
+		if math.Abs(v-1) > 1e-9 {
+			t.Fatalf("envelope of a Nyquist tone is %v at %d, want 1", v, i)
+		}
+	}
+}
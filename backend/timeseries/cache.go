@@ -0,0 +1,130 @@
+package timeseries
+
+import (
+	"container/list"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultCacheBytes is the default bound on decoded samples kept in memory
+const DefaultCacheBytes = 256 << 20
+
+// cachedFile holds the decoded samples of one float32 file together with the
+// modification time, size and header length they were decoded with
+type cachedFile struct {
+	path        string
+	modTime     time.Time
+	size        int64
+	headerBytes int64
+	samples     []float32
+}
+
+// fileCache is an LRU cache of decoded files bounded by total sample bytes
+type fileCache struct {
+	mu      sync.Mutex
+	limit   int64
+	used    int64
+	order   *list.List // Most recently used at the front
+	entries map[string]*list.Element
+}
+
+var samplesCache = &fileCache{
+	limit:   DefaultCacheBytes,
+	order:   list.New(),
+	entries: make(map[string]*list.Element),
+}
+
+// SetCacheLimit bounds the memory used for decoded file data. A limit of 0
+// disables caching.
+func SetCacheLimit(bytes int64) {
+	samplesCache.mu.Lock()
+	defer samplesCache.mu.Unlock()
+	samplesCache.limit = bytes
+	samplesCache.evict()
+}
+
+// get returns the cached samples for path if they were decoded from the file
+// described by info with the same header, dropping stale entries
+func (c *fileCache) get(path string, info os.FileInfo, headerBytes int64) []float32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[path]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*cachedFile)
+	if !entry.modTime.Equal(info.ModTime()) || entry.size != info.Size() || entry.headerBytes != headerBytes {
+		c.remove(elem)
+		return nil
+	}
+	c.order.MoveToFront(elem)
+	return entry.samples
+}
+
+func (c *fileCache) put(path string, info os.FileInfo, headerBytes int64, samples []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[path]; ok {
+		c.remove(elem)
+	}
+	entry := &cachedFile{
+		path:        path,
+		modTime:     info.ModTime(),
+		size:        info.Size(),
+		headerBytes: headerBytes,
+		samples:     samples,
+	}
+	c.entries[path] = c.order.PushFront(entry)
+	c.used += int64(len(samples)) * 4
+	c.evict()
+}
+
+// evict drops least recently used entries until the cache fits its limit
+func (c *fileCache) evict() {
+	for c.used > c.limit && c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *fileCache) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*cachedFile)
+	delete(c.entries, entry.path)
+	c.used -= int64(len(entry.samples)) * 4
+}
+
+// cachedSamples returns every sample after the header of the open float32
+// file, decoding and caching it on a miss. It returns nil when the file is
+// too large to cache.
+func cachedSamples(path string, file *os.File, info os.FileInfo, headerBytes int64) ([]float32, error) {
+	if samples := samplesCache.get(path, info, headerBytes); samples != nil {
+		return samples, nil
+	}
+
+	samplesCache.mu.Lock()
+	limit := samplesCache.limit
+	samplesCache.mu.Unlock()
+	if info.Size() > limit {
+		return nil, nil
+	}
+
+	data := make([]byte, (info.Size()-headerBytes)/4*4)
+	if _, err := file.Seek(headerBytes, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(file, data); err != nil {
+		return nil, err
+	}
+
+	samples := make([]float32, len(data)/4)
+	for i := range samples {
+		samples[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	samplesCache.put(path, info, headerBytes, samples)
+	return samples, nil
+}
@@ -0,0 +1,181 @@
+package timeseries
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"novacal/logging"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// Note attached to reads of compressed files, which cannot seek
+const compressedNote = "file is gzip-compressed, so it was decompressed in full rather than read by range"
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Most bytes a compressed file may decompress to, 0 for no limit
+var decompressLimit atomic.Int64
+
+// SetDecompressLimit bounds the decompressed size of gzip files, so a small
+// file cannot expand without bound in memory. Larger files fail with
+// ErrRangeTooLong. A limit of 0 decompresses any file.
+func SetDecompressLimit(bytes int64) {
+	decompressLimit.Store(bytes)
+}
+
+// limitDecompressed caps reader at the decompress limit, returning the
+// reader and the limit; it reads one byte past the limit so overflow shows
+func limitDecompressed(reader io.Reader) (io.Reader, int64) {
+	limit := decompressLimit.Load()
+	if limit <= 0 {
+		return reader, 0
+	}
+	return io.LimitReader(reader, limit+1), limit
+}
+
+// errTooLarge reports a compressed file decompressing past limit bytes
+func errTooLarge(path string, limit int64) error {
+	return fmt.Errorf("%s decompresses to more than %d bytes: %w", filepath.Base(path), limit, ErrRangeTooLong)
+}
+
+// IsCompressed reports whether path is a gzip file, judged by a .gz
+// extension or the gzip magic bytes
+func IsCompressed(path string) bool {
+	if strings.EqualFold(filepath.Ext(path), ".gz") {
+		return true
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, len(gzipMagic))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, gzipMagic)
+}
+
+// ReadDecompressed returns the full decompressed contents of a gzip file.
+// Streams cannot seek, so every read of a compressed file decodes all of it.
+func ReadDecompressed(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("error opening gzip stream: %w", err)
+	}
+	defer reader.Close()
+
+	logging.Infof("Decompressing %s in full", path)
+	limited, limit := limitDecompressed(reader)
+	data, err := io.ReadAll(limited)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing %s: %w", filepath.Base(path), err)
+	}
+	if limit > 0 && int64(len(data)) > limit {
+		return nil, errTooLarge(path, limit)
+	}
+	return data, nil
+}
+
+// OpenData opens path for reading along with the size of its sample data in
+// bytes. Compressed files are decompressed in full first so the result can
+// still seek.
+func OpenData(path string) (io.ReadSeekCloser, int64, error) {
+	if IsCompressed(path) {
+		data, err := ReadDecompressed(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		return nopCloser{bytes.NewReader(data)}, int64(len(data)), nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+// DataSize returns the size in bytes of the sample data in path, which for
+// compressed files is the decompressed size
+func DataSize(path string) (int64, error) {
+	if !IsCompressed(path) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return 0, fmt.Errorf("error opening gzip stream: %w", err)
+	}
+	defer reader.Close()
+	limited, limit := limitDecompressed(reader)
+	size, err := io.Copy(io.Discard, limited)
+	if err != nil {
+		return 0, err
+	}
+	if limit > 0 && size > limit {
+		return 0, errTooLarge(path, limit)
+	}
+	return size, nil
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+// decompressedSamples returns every float32 sample after the header of a
+// compressed file, keeping them in the samples cache like plain files
+func decompressedSamples(path string, info os.FileInfo, headerBytes int64) ([]float32, error) {
+	if samples := samplesCache.get(path, info, headerBytes); samples != nil {
+		return samples, nil
+	}
+
+	data, err := ReadDecompressed(path)
+	if err != nil {
+		return nil, err
+	}
+	if headerBytes < 0 || headerBytes > int64(len(data)) {
+		return nil, fmt.Errorf("header size %d is outside the %d decompressed bytes", headerBytes, len(data))
+	}
+	data = data[headerBytes:]
+
+	samples := make([]float32, len(data)/4)
+	for i := range samples {
+		samples[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+
+	samplesCache.mu.Lock()
+	fits := int64(len(samples))*4 <= samplesCache.limit
+	samplesCache.mu.Unlock()
+	if fits {
+		samplesCache.put(path, info, headerBytes, samples)
+	}
+	return samples, nil
+}
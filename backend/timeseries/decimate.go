@@ -0,0 +1,188 @@
+package timeseries
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// DecimateOptions holds optional settings for DecimateFile
+type DecimateOptions struct {
+	AntiAlias        bool      // Low-pass filter below the new Nyquist frequency before decimating
+	DataType         string    // Sample encoding of input and output, "float32" (default) or "float64"
+	ProgressCallback func(int) // Optional progress updates from 0 to 100
+}
+
+// Number of samples read from the input per iteration
+const decimateChunkSize = 65536
+
+// DecimateFile writes every factor-th sample of inputPath to outputPath,
+// optionally low-pass filtered first, so the output stays uniformly sampled
+// at the original rate divided by factor. The file is streamed, keeping memory
+// bounded by the chunk and filter sizes. It returns the number of samples written.
+func DecimateFile(inputPath, outputPath string, factor int, opts DecimateOptions) (int64, error) {
+	if factor < 1 {
+		return 0, fmt.Errorf("decimation factor must be at least 1, got %d", factor)
+	}
+	var size int
+	switch opts.DataType {
+	case "", "float32":
+		size = 4
+	case "float64":
+		size = 8
+	default:
+		return 0, fmt.Errorf("unknown data type: %s", opts.DataType)
+	}
+	progress := opts.ProgressCallback
+	if progress == nil {
+		progress = func(int) {}
+	}
+
+	taps := []float64{1}
+	if opts.AntiAlias && factor > 1 {
+		taps = lowpassTaps(factor)
+	}
+	half := int64(len(taps) / 2)
+
+	in, err := os.Open(inputPath)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size()%int64(size) != 0 {
+		return 0, fmt.Errorf("file size %d is not a multiple of %d bytes, check the data type", info.Size(), size)
+	}
+	totalSamples := info.Size() / int64(size)
+
+	// Truncating the output must not destroy the input still being read
+	if outInfo, err := os.Stat(outputPath); err == nil && os.SameFile(info, outInfo) {
+		return 0, fmt.Errorf("output %s is the input file", outputPath)
+	}
+
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	reader := bufio.NewReader(in)
+	writer := bufio.NewWriter(out)
+	buffer := make([]byte, decimateChunkSize*size)
+	var (
+		pending      []float64 // Input samples from pendingStart onwards
+		pendingStart int64
+		next         int64 // Input index of the next output sample
+		written      int64
+	)
+
+	for {
+		n, readErr := io.ReadFull(reader, buffer)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return written, readErr
+		}
+		pending = append(pending, decodeFloats(buffer[:n-n%size], size)...)
+		atEnd := readErr != nil
+		available := pendingStart + int64(len(pending))
+
+		// Each output is centred on its input sample; taps past the file
+		// edges are dropped and the remaining ones renormalised
+		for next < totalSamples && (next+half < available || atEnd) {
+			sum, weight := 0.0, 0.0
+			for k, tap := range taps {
+				idx := next - half + int64(k)
+				if idx < 0 || idx >= totalSamples {
+					continue
+				}
+				sum += tap * pending[idx-pendingStart]
+				weight += tap
+			}
+			if weight != 0 {
+				sum /= weight
+			}
+			if err := writeFloat(writer, sum, size); err != nil {
+				return written, err
+			}
+			written++
+			next += int64(factor)
+		}
+
+		// Drop samples no later output depends on
+		if drop := next - half - pendingStart; drop > 0 {
+			if drop > int64(len(pending)) {
+				drop = int64(len(pending))
+			}
+			pending = append(pending[:0], pending[drop:]...)
+			pendingStart += drop
+		}
+		if totalSamples > 0 {
+			progress(int(available * 100 / totalSamples))
+		}
+
+		if atEnd {
+			break
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return written, err
+	}
+	progress(100)
+	return written, nil
+}
+
+// lowpassTaps returns a Blackman-windowed sinc low-pass filter with its cutoff
+// at 90% of the Nyquist frequency after decimation by factor
+func lowpassTaps(factor int) []float64 {
+	n := 16*factor + 1
+	cutoff := 0.45 / float64(factor) // Cycles per input sample
+	center := float64(n-1) / 2
+
+	taps := make([]float64, n)
+	sum := 0.0
+	for i := range taps {
+		x := float64(i) - center
+		sinc := 2 * cutoff
+		if x != 0 {
+			sinc = math.Sin(2*math.Pi*cutoff*x) / (math.Pi * x)
+		}
+		t := float64(i) / float64(n-1)
+		window := 0.42 - 0.5*math.Cos(2*math.Pi*t) + 0.08*math.Cos(4*math.Pi*t)
+		taps[i] = sinc * window
+		sum += taps[i]
+	}
+	for i := range taps {
+		taps[i] /= sum
+	}
+	return taps
+}
+
+func decodeFloats(buffer []byte, size int) []float64 {
+	samples := make([]float64, len(buffer)/size)
+	for i := range samples {
+		if size == 8 {
+			samples[i] = math.Float64frombits(binary.LittleEndian.Uint64(buffer[i*8:]))
+		} else {
+			samples[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buffer[i*4:])))
+		}
+	}
+	return samples
+}
+
+func writeFloat(w io.Writer, value float64, size int) error {
+	var bytes [8]byte
+	if size == 8 {
+		binary.LittleEndian.PutUint64(bytes[:], math.Float64bits(value))
+	} else {
+		binary.LittleEndian.PutUint32(bytes[:], math.Float32bits(float32(value)))
+	}
+	_, err := w.Write(bytes[:size])
+	return err
+}
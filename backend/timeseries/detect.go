@@ -0,0 +1,103 @@
+package timeseries
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// Bytes inspected from the start of a file when guessing its encoding
+const detectSampleBytes = 1 << 20
+
+// Magnitudes outside this range are treated as implausible for measured data.
+// Misreading one float width as the other mostly produces values far outside it.
+const (
+	plausibleMax = 1e12
+	plausibleMin = 1e-30
+)
+
+// DetectDataType guesses whether a raw binary file holds float32 or float64
+// samples. Each encoding must divide the file size evenly; the remaining
+// candidates are scored on how many decoded samples are finite and of a
+// plausible magnitude, with neighbouring-sample correlation breaking ties
+// since misdecoded data looks like noise. Ambiguous files report "float32",
+// the encoding the plot view assumes.
+func DetectDataType(path string) (string, error) {
+	file, size, err := OpenData(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if size == 0 {
+		return "", fmt.Errorf("file is empty")
+	}
+	if size%4 != 0 {
+		return "", fmt.Errorf("file size %d is not a multiple of 4 bytes", size)
+	}
+	if size%8 != 0 {
+		return "float32", nil
+	}
+
+	n := size
+	if n > detectSampleBytes {
+		n = detectSampleBytes
+	}
+	buffer := make([]byte, n)
+	if _, err := io.ReadFull(file, buffer); err != nil {
+		return "", err
+	}
+
+	plausible32, smooth32 := decodeScore(decodeFloats(buffer, 4))
+	plausible64, smooth64 := decodeScore(decodeFloats(buffer, 8))
+
+	// A clear difference in plausibility decides on its own
+	const margin = 0.05
+	switch {
+	case plausible64 > plausible32+margin:
+		return "float64", nil
+	case plausible32 > plausible64+margin:
+		return "float32", nil
+	case smooth64 > smooth32:
+		return "float64", nil
+	default:
+		return "float32", nil
+	}
+}
+
+// decodeScore returns the fraction of samples that are finite and of plausible
+// magnitude, and the lag-one correlation of those samples
+func decodeScore(samples []float64) (float64, float64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	valid := make([]float64, 0, len(samples))
+	for _, v := range samples {
+		abs := math.Abs(v)
+		if math.IsNaN(v) || abs > plausibleMax || (abs != 0 && abs < plausibleMin) {
+			continue
+		}
+		valid = append(valid, v)
+	}
+	plausible := float64(len(valid)) / float64(len(samples))
+	if len(valid) < 2 {
+		return plausible, 0
+	}
+
+	mean := 0.0
+	for _, v := range valid {
+		mean += v
+	}
+	mean /= float64(len(valid))
+	var variance, lagged float64
+	for i, v := range valid {
+		variance += (v - mean) * (v - mean)
+		if i > 0 {
+			lagged += (v - mean) * (valid[i-1] - mean)
+		}
+	}
+	if variance == 0 {
+		return plausible, 0
+	}
+	return plausible, lagged / variance
+}
@@ -0,0 +1,84 @@
+package timeseries
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+)
+
+// SignalConfig describes a synthetic test signal
+type SignalConfig struct {
+	Waveform     string  `json:"waveform"`     // "sine", "square", "chirp" or "noise"
+	Amplitude    float64 `json:"amplitude"`    // Peak amplitude, or standard deviation for noise
+	Frequency    float64 `json:"frequency"`    // Hz, start frequency for chirps
+	EndFrequency float64 `json:"endFrequency"` // Hz, chirp end frequency
+	SampleRate   float64 `json:"sampleRate"`
+	Duration     float64 `json:"duration"` // Seconds
+	SNR          float64 `json:"snr"`      // dB of added white noise, 0 for a clean signal
+	Seed         int64   `json:"seed"`     // Noise seed, for reproducible output
+}
+
+// GenerateSignal builds the samples described by config
+func GenerateSignal(config SignalConfig) ([]float64, error) {
+	if config.SampleRate <= 0 {
+		return nil, fmt.Errorf("sample rate must be positive")
+	}
+	if config.Duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive")
+	}
+	if config.Waveform != "noise" && (config.Frequency <= 0 || config.Frequency >= config.SampleRate/2) {
+		return nil, fmt.Errorf("frequency must be between 0 and Nyquist (%v Hz)", config.SampleRate/2)
+	}
+	if config.Waveform == "chirp" && (config.EndFrequency <= 0 || config.EndFrequency >= config.SampleRate/2) {
+		return nil, fmt.Errorf("chirp end frequency must be between 0 and Nyquist (%v Hz)", config.SampleRate/2)
+	}
+
+	n := int(config.Duration * config.SampleRate)
+	rng := rand.New(rand.NewSource(config.Seed))
+	data := make([]float64, n)
+
+	for i := range data {
+		t := float64(i) / config.SampleRate
+		switch config.Waveform {
+		case "sine":
+			data[i] = config.Amplitude * math.Sin(2*math.Pi*config.Frequency*t)
+		case "square":
+			data[i] = config.Amplitude * math.Copysign(1, math.Sin(2*math.Pi*config.Frequency*t))
+		case "chirp":
+			// Linear sweep from Frequency to EndFrequency over the duration
+			rate := (config.EndFrequency - config.Frequency) / config.Duration
+			data[i] = config.Amplitude * math.Sin(2*math.Pi*(config.Frequency*t+rate*t*t/2))
+		case "noise":
+			data[i] = config.Amplitude * rng.NormFloat64()
+		default:
+			return nil, fmt.Errorf("unknown waveform: %s", config.Waveform)
+		}
+	}
+
+	if config.SNR != 0 && config.Waveform != "noise" {
+		power := 0.0
+		for _, v := range data {
+			power += v * v
+		}
+		power /= float64(n)
+
+		noiseStd := math.Sqrt(power / math.Pow(10, config.SNR/10))
+		for i := range data {
+			data[i] += noiseStd * rng.NormFloat64()
+		}
+	}
+
+	return data, nil
+}
+
+// WriteBinaryFile writes data as little-endian float32 samples, the format
+// read by the plot view
+func WriteBinaryFile(path string, data []float64) error {
+	buffer := make([]byte, len(data)*4)
+	for i, v := range data {
+		binary.LittleEndian.PutUint32(buffer[i*4:], math.Float32bits(float32(v)))
+	}
+	return os.WriteFile(path, buffer, 0644)
+}
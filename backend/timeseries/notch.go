@@ -0,0 +1,85 @@
+package timeseries
+
+import (
+	"fmt"
+	"math"
+	"novacal/logging"
+)
+
+// NotchOptions describes a chain of notch filters at a fundamental
+// frequency and its harmonics, typically 50 or 60 Hz mains hum
+type NotchOptions struct {
+	Frequency float64 `json:"frequency"` // Fundamental in Hz
+	Q         float64 `json:"q"`         // Quality factor, higher is narrower
+	Harmonics int     `json:"harmonics"` // Harmonics notched in addition to the fundamental
+}
+
+// Validate reports options that are invalid at any sample rate
+func (o NotchOptions) Validate() error {
+	if o.Harmonics < 0 {
+		return fmt.Errorf("notch harmonics must not be negative, got %d", o.Harmonics)
+	}
+	return nil
+}
+
+// checkNotch reports why a notch at freq cannot be applied stably
+func checkNotch(sampleRate, freq, q float64) error {
+	if sampleRate <= 0 {
+		return fmt.Errorf("sample rate must be positive, got %v", sampleRate)
+	}
+	if freq <= 0 || freq >= sampleRate/2 {
+		return fmt.Errorf("notch frequency %v Hz must be between 0 and the Nyquist frequency %v Hz", freq, sampleRate/2)
+	}
+	if q <= 0 || math.IsInf(q, 0) || math.IsNaN(q) {
+		return fmt.Errorf("notch Q must be positive and finite, got %v", q)
+	}
+	return nil
+}
+
+// NotchFilter removes freq from data with a biquad notch of quality factor q.
+// The poles lie inside the unit circle for any valid frequency and Q; for
+// invalid parameters a warning is logged and data is returned unchanged.
+func NotchFilter(data []float64, sampleRate, freq, q float64) []float64 {
+	if err := checkNotch(sampleRate, freq, q); err != nil {
+		logging.Warnf("Skipping notch filter: %v", err)
+		return data
+	}
+
+	w0 := 2 * math.Pi * freq / sampleRate
+	alpha := math.Sin(w0) / (2 * q)
+	a0 := 1 + alpha
+	b0, b1, b2 := 1/a0, -2*math.Cos(w0)/a0, 1/a0
+	a1, a2 := -2*math.Cos(w0)/a0, (1-alpha)/a0
+
+	// Direct form II transposed
+	filtered := make([]float64, len(data))
+	z1, z2 := 0.0, 0.0
+	for i, x := range data {
+		y := b0*x + z1
+		z1 = b1*x - a1*y + z2
+		z2 = b2*x - a2*y
+		filtered[i] = y
+	}
+	return filtered
+}
+
+// ApplyNotchFilters chains notches at the fundamental and its harmonics,
+// returning the filtered data and a warning for every notch that was skipped
+// because it would be unstable. Harmonics from the first one at or above the
+// Nyquist frequency are skipped with a single warning.
+func ApplyNotchFilters(data []float64, sampleRate float64, opts NotchOptions) ([]float64, []string) {
+	var warnings []string
+	for h := 1; h <= opts.Harmonics+1; h++ {
+		freq := opts.Frequency * float64(h)
+		if sampleRate > 0 && freq >= sampleRate/2 {
+			warnings = append(warnings, fmt.Sprintf("skipped notches from %v Hz up: at or above the Nyquist frequency %v Hz", freq, sampleRate/2))
+			break
+		}
+		if err := checkNotch(sampleRate, freq, opts.Q); err != nil {
+			warnings = append(warnings, fmt.Sprintf("skipped notch at %v Hz: %v", freq, err))
+			continue
+		}
+		data = NotchFilter(data, sampleRate, freq, opts.Q)
+	}
+	return data, warnings
+}
@@ -0,0 +1,246 @@
+package timeseries
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// overviewFactors are the decimation factors of the overview levels, finest
+// first. Offsets within a block are stored as uint16, so factors stay <= 65536.
+var overviewFactors = []int{64, 512, 4096, 32768}
+
+// maxOverviews bounds the number of file overviews kept in memory
+const maxOverviews = 32
+
+// overviewLevel holds the minimum and maximum of each block of factor samples,
+// with their offsets inside the block so points keep their exact times
+type overviewLevel struct {
+	factor     int
+	mins, maxs []float32
+	minOffsets []uint16
+	maxOffsets []uint16
+}
+
+type overview struct {
+	modTime     time.Time
+	size        int64
+	headerBytes int64
+	levels      []*overviewLevel
+	used        time.Time
+}
+
+var (
+	overviewsMu sync.Mutex
+	overviews   = make(map[string]*overview)
+)
+
+// readOverview serves a zoomed-out read from the coarsest overview level whose
+// factor does not exceed binSize, returning two points per block for the
+// extrema method and one for peakhold. It reports false when the request is
+// too fine for any level, the file is interleaved, filtering, smoothing or a
+// transform needs the raw samples or the method cannot be served from min/max data.
+// Callers rescale the returned values.
+func readOverview(filePath string, startIndex, endIndex, binSize int, opts DownsampleOptions) ([]float64, []float64, int, bool, error) {
+	if opts.Method != "" && opts.Method != "extrema" && opts.Method != "peakhold" {
+		return nil, nil, 0, false, nil
+	}
+	if binSize < overviewFactors[0] || opts.NumChannels > 1 || opts.SmoothWindow > 1 ||
+		(opts.Transform != "" && opts.Transform != "none") || opts.Notch != nil {
+		return nil, nil, 0, false, nil
+	}
+	// Peak hold compares magnitudes, which an offset reorders
+	if opts.Method == "peakhold" && opts.Offset != 0 {
+		return nil, nil, 0, false, nil
+	}
+	// Compressed files are decoded in full, so there is no overview to build
+	if IsCompressed(filePath) {
+		return nil, nil, 0, false, nil
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, nil, 0, false, err
+	}
+	if opts.HeaderBytes < 0 || opts.HeaderBytes > info.Size() {
+		return nil, nil, 0, false, fmt.Errorf("header size %d is outside the %d-byte file", opts.HeaderBytes, info.Size())
+	}
+	startIndex, endIndex, err = clampRange(startIndex, endIndex, int((info.Size()-opts.HeaderBytes)/4), opts.Strict)
+	if err != nil {
+		return nil, nil, 0, false, err
+	}
+
+	ov, err := loadOverview(filePath, info, opts.HeaderBytes)
+	if err != nil {
+		return nil, nil, 0, false, err
+	}
+
+	var level *overviewLevel
+	for _, l := range ov.levels {
+		if l.factor <= binSize {
+			level = l
+		}
+	}
+	if level == nil {
+		return nil, nil, 0, false, nil
+	}
+
+	first := startIndex / level.factor
+	last := (endIndex + level.factor - 1) / level.factor
+	if last > len(level.mins) {
+		last = len(level.mins)
+	}
+
+	times := make([]float64, 0, 2*(last-first))
+	values := make([]float64, 0, 2*(last-first))
+	appendPoint := func(index int, value float32) {
+		// Edge blocks may hold extrema just outside the requested range
+		if index >= startIndex && index < endIndex {
+			times = append(times, float64(index))
+			values = append(values, float64(value))
+		}
+	}
+	for b := first; b < last; b++ {
+		base := b * level.factor
+		minIdx := base + int(level.minOffsets[b])
+		maxIdx := base + int(level.maxOffsets[b])
+		switch {
+		case opts.Method == "peakhold":
+			if math.Abs(float64(level.maxs[b])) >= math.Abs(float64(level.mins[b])) {
+				appendPoint(maxIdx, level.maxs[b])
+			} else {
+				appendPoint(minIdx, level.mins[b])
+			}
+		case minIdx == maxIdx:
+			appendPoint(minIdx, level.mins[b])
+		case minIdx < maxIdx:
+			appendPoint(minIdx, level.mins[b])
+			appendPoint(maxIdx, level.maxs[b])
+		default:
+			appendPoint(maxIdx, level.maxs[b])
+			appendPoint(minIdx, level.mins[b])
+		}
+	}
+
+	return times, values, level.factor, true, nil
+}
+
+// loadOverview returns the overview of the file described by info, building
+// it on first access or when the file or header length has changed
+func loadOverview(filePath string, info os.FileInfo, headerBytes int64) (*overview, error) {
+	overviewsMu.Lock()
+	ov, ok := overviews[filePath]
+	if ok && ov.modTime.Equal(info.ModTime()) && ov.size == info.Size() && ov.headerBytes == headerBytes {
+		ov.used = time.Now()
+		overviewsMu.Unlock()
+		return ov, nil
+	}
+	overviewsMu.Unlock()
+
+	ov, err := buildOverview(filePath, info, headerBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	overviewsMu.Lock()
+	defer overviewsMu.Unlock()
+	if len(overviews) >= maxOverviews {
+		// Drop the least recently used overview
+		var oldest string
+		for path, candidate := range overviews {
+			if oldest == "" || candidate.used.Before(overviews[oldest].used) {
+				oldest = path
+			}
+		}
+		delete(overviews, oldest)
+	}
+	overviews[filePath] = ov
+	return ov, nil
+}
+
+// buildOverview streams the float32 file once to compute the finest level,
+// then derives each coarser level from the one below it
+func buildOverview(filePath string, info os.FileInfo, headerBytes int64) (*overview, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(headerBytes, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	totalPoints := int((info.Size() - headerBytes) / 4)
+	finest := newOverviewLevel(overviewFactors[0], totalPoints)
+
+	// Read whole blocks of the finest level at a time
+	blocksPerChunk := 4096
+	buf := make([]byte, blocksPerChunk*finest.factor*4)
+	for block := 0; block < len(finest.mins); block += blocksPerChunk {
+		n, err := io.ReadFull(file, buf)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, err
+		}
+		samples := n / 4
+		for i := 0; i < samples; i++ {
+			b := block + i/finest.factor
+			if b >= len(finest.mins) {
+				break
+			}
+			value := math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+			offset := uint16(i % finest.factor)
+			if offset == 0 || value < finest.mins[b] {
+				finest.mins[b], finest.minOffsets[b] = value, offset
+			}
+			if offset == 0 || value > finest.maxs[b] {
+				finest.maxs[b], finest.maxOffsets[b] = value, offset
+			}
+		}
+	}
+
+	levels := []*overviewLevel{finest}
+	for _, factor := range overviewFactors[1:] {
+		prev := levels[len(levels)-1]
+		ratio := factor / prev.factor
+		level := newOverviewLevel(factor, totalPoints)
+		for b := range level.mins {
+			for j := 0; j < ratio; j++ {
+				child := b*ratio + j
+				if child >= len(prev.mins) {
+					break
+				}
+				offset := uint16(j * prev.factor)
+				if j == 0 || prev.mins[child] < level.mins[b] {
+					level.mins[b], level.minOffsets[b] = prev.mins[child], offset+prev.minOffsets[child]
+				}
+				if j == 0 || prev.maxs[child] > level.maxs[b] {
+					level.maxs[b], level.maxOffsets[b] = prev.maxs[child], offset+prev.maxOffsets[child]
+				}
+			}
+		}
+		levels = append(levels, level)
+	}
+
+	return &overview{
+		modTime:     info.ModTime(),
+		size:        info.Size(),
+		headerBytes: headerBytes,
+		levels:      levels,
+		used:        time.Now(),
+	}, nil
+}
+
+func newOverviewLevel(factor, totalPoints int) *overviewLevel {
+	blocks := (totalPoints + factor - 1) / factor
+	return &overviewLevel{
+		factor:     factor,
+		mins:       make([]float32, blocks),
+		maxs:       make([]float32, blocks),
+		minOffsets: make([]uint16, blocks),
+		maxOffsets: make([]uint16, blocks),
+	}
+}
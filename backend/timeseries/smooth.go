@@ -0,0 +1,77 @@
+package timeseries
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MovingAverage returns data smoothed with a centred window of the given
+// size. Near the ends the window shrinks to the available samples instead
+// of padding with zeros. A window of 1 or less returns data unchanged.
+func MovingAverage(data []float64, window int) []float64 {
+	if window <= 1 || len(data) == 0 {
+		return data
+	}
+
+	// Prefix sums give each window mean in constant time
+	prefix := make([]float64, len(data)+1)
+	for i, v := range data {
+		prefix[i+1] = prefix[i] + v
+	}
+
+	smoothed := make([]float64, len(data))
+	for i := range data {
+		lo, hi := windowBounds(i, len(data), window)
+		smoothed[i] = (prefix[hi] - prefix[lo]) / float64(hi-lo)
+	}
+	return smoothed
+}
+
+// MovingMedian is the median counterpart of MovingAverage, which rejects
+// isolated spikes instead of spreading them
+func MovingMedian(data []float64, window int) []float64 {
+	if window <= 1 || len(data) == 0 {
+		return data
+	}
+
+	smoothed := make([]float64, len(data))
+	scratch := make([]float64, 0, window)
+	for i := range data {
+		lo, hi := windowBounds(i, len(data), window)
+		scratch = append(scratch[:0], data[lo:hi]...)
+		sort.Float64s(scratch)
+		mid := len(scratch) / 2
+		if len(scratch)%2 == 0 {
+			smoothed[i] = (scratch[mid-1] + scratch[mid]) / 2
+		} else {
+			smoothed[i] = scratch[mid]
+		}
+	}
+	return smoothed
+}
+
+// Smooth applies the named smoothing method, "mean" (default) or "median"
+func Smooth(data []float64, window int, method string) ([]float64, error) {
+	switch method {
+	case "", "mean":
+		return MovingAverage(data, window), nil
+	case "median":
+		return MovingMedian(data, window), nil
+	default:
+		return nil, fmt.Errorf("unknown smoothing method: %s", method)
+	}
+}
+
+// windowBounds returns the [lo, hi) range of a window centred on i, clipped
+// to n samples
+func windowBounds(i, n, window int) (int, int) {
+	lo := i - window/2
+	hi := lo + window
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > n {
+		hi = n
+	}
+	return lo, hi
+}
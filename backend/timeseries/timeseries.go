@@ -1,7 +1,9 @@
 package timeseries
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -9,21 +11,112 @@ import (
 	"sort"
 )
 
-func GetTotalFileLength(filePaths []string) (int64, error) {
+// GetTotalFileLength returns the number of float32 samples in the files,
+// excluding a headerBytes header at the start of each
+func GetTotalFileLength(filePaths []string, headerBytes int64) (int64, error) {
 	var totalLength int64
 
 	for _, filePath := range filePaths {
 		fileInfo, err := os.Stat(filePath)
 		if err != nil {
-			return 0, fmt.Errorf("error getting file info: %v", err)
+			return 0, fmt.Errorf("error getting file info: %w", err)
 		}
-		totalLength += fileInfo.Size() / 4 // Assuming 4 bytes per float32
+		if IsCompressed(filePath) {
+			samples, err := decompressedSamples(filePath, fileInfo, headerBytes)
+			if err != nil {
+				return 0, err
+			}
+			totalLength += int64(len(samples))
+			continue
+		}
+		if headerBytes < 0 || headerBytes > fileInfo.Size() {
+			return 0, fmt.Errorf("header size %d is outside the %d-byte file %s", headerBytes, fileInfo.Size(), filePath)
+		}
+		totalLength += (fileInfo.Size() - headerBytes) / 4 // Assuming 4 bytes per float32
 	}
 
 	return totalLength, nil
 }
 
-func ReadAndDownsample(filePaths []string, startIndex, endIndex, decimationFactor int) ([]FileData, error) {
+// DownsampleOptions holds optional settings for ReadAndDownsample
+type DownsampleOptions struct {
+	MaxPoints int // Cap on the points returned per file, 0 for no cap
+	// Cap on the raw samples read per file, 0 for no cap. Larger ranges are
+	// read with samples skipped and a warning on the file.
+	MaxSamples int
+	Method     string // "extrema" (default), "peakhold", "stride" or "average"
+	Strict     bool   // Error on out-of-range indices instead of clamping them
+
+	// Ranges of at most RawThreshold samples are returned sample for sample,
+	// bypassing downsampling and MaxPoints. 0 selects the 2000-point screen
+	// resolution, or MaxPoints when smaller, and a negative value always
+	// downsamples.
+	RawThreshold int
+
+	// Interleaved files (sample0_ch0, sample0_ch1, ...) hold NumChannels
+	// channels; indices then count samples of the selected Channel
+	NumChannels int
+	Channel     int
+
+	HeaderBytes int64 // Bytes skipped at the start of each file before the first sample
+
+	SmoothWindow int    // Samples in the smoothing window applied before downsampling, 0 for none
+	SmoothMethod string // "mean" (default) or "median"
+
+	// Transform applied before smoothing and downsampling: "none" (default),
+	// "derivative" or "integral". SampleRate scales it to seconds when set and
+	// the integral starts from IntegralInitial at startIndex.
+	Transform       string
+	SampleRate      float64
+	IntegralInitial float64
+
+	// Notch filters applied first, at SampleRate, when set
+	Notch *NotchOptions
+
+	// Raw values are converted to physical units as value*Scale + Offset
+	// before any other processing. A Scale of 0 selects 1.
+	Scale  float64
+	Offset float64
+
+	// Progress, when set, is called with the percentage of files done, at
+	// the half-way mark of each file once its samples are read
+	Progress func(int)
+}
+
+// SuggestDecimation returns the smallest decimation factor that brings
+// totalLength samples to at most targetPoints points, and the resulting
+// number of points
+func SuggestDecimation(totalLength int64, targetPoints int) (int, int64, error) {
+	if totalLength <= 0 {
+		return 0, 0, fmt.Errorf("file length must be positive, got %d", totalLength)
+	}
+	if targetPoints <= 0 {
+		return 0, 0, fmt.Errorf("target point count must be positive, got %d", targetPoints)
+	}
+
+	factor := (totalLength + int64(targetPoints) - 1) / int64(targetPoints)
+	points := (totalLength + factor - 1) / factor
+	return int(factor), points, nil
+}
+
+func ReadAndDownsample(filePaths []string, startIndex, endIndex, decimationFactor int, opts DownsampleOptions) ([]FileData, error) {
+	return ReadAndDownsampleContext(context.Background(), filePaths, startIndex, endIndex, decimationFactor, opts)
+}
+
+// ReadAndDownsampleContext reads and downsamples like ReadAndDownsample,
+// giving up before the next file once ctx is done
+func ReadAndDownsampleContext(ctx context.Context, filePaths []string, startIndex, endIndex, decimationFactor int, opts DownsampleOptions) ([]FileData, error) {
+	downsample, err := downsampler(opts.Method)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := Smooth(nil, opts.SmoothWindow, opts.SmoothMethod); err != nil {
+		return nil, err
+	}
+	if _, err := Transform(nil, opts.Transform, opts.SampleRate, opts.IntegralInitial); err != nil {
+		return nil, err
+	}
+
 	result := make([]FileData, len(filePaths))
 
 	// Calculate points in view
@@ -34,83 +127,248 @@ func ReadAndDownsample(filePaths []string, startIndex, endIndex, decimationFacto
 
 	// Calculate optimal bin size
 	binSize := int(math.Ceil(float64(pointsInView) / float64(targetResolution)))
+	if decimationFactor > binSize {
+		binSize = decimationFactor
+	}
 	if binSize < 1 {
 		binSize = 1
 	}
 
+	// Small ranges skip every downsampling step so the trace is exact at
+	// maximum zoom; an endIndex of 0 reads to the end and never counts
+	rawThreshold := opts.RawThreshold
+	if rawThreshold == 0 {
+		rawThreshold = targetResolution
+		if opts.MaxPoints > 0 {
+			rawThreshold = min(rawThreshold, opts.MaxPoints)
+		}
+	}
+	raw := pointsInView > 0 && pointsInView <= rawThreshold
+	if raw {
+		binSize = 1
+	}
+
+	progress := func(halves int) {
+		if opts.Progress != nil {
+			opts.Progress(halves * 50 / len(filePaths))
+		}
+	}
+
 	for i, filePath := range filePaths {
-		times, values, err := readBinaryFile(filePath, startIndex, endIndex)
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("stopped after %d of %d files: %v", i, len(filePaths), err)
+		}
+
+		// Zoomed-out views come from the precomputed overview levels
+		var warnings []string
+		if IsCompressed(filePath) {
+			warnings = append(warnings, compressedNote)
+		}
+		times, values, factor, ok, err := readOverview(filePath, startIndex, endIndex, binSize, opts)
 		if err != nil {
 			return nil, err
 		}
+		if ok {
+			progress(2*i + 1)
 
-		// Apply dynamic extrema-preserving downsampling
-		if binSize > 1 {
-			times, values = dynamicDownsample(times, values, binSize)
+			// Rescaling is linear, so it commutes with the overview extrema
+			values = Rescale(values, opts.Scale, opts.Offset)
+
+			// Each overview block holds two points, so scale the remaining bins
+			if remaining := 2 * binSize / factor; remaining > 2 {
+				times, values = downsample(times, values, remaining)
+			}
+		} else {
+			var step int
+			times, values, step, err = readBinaryFile(filePath, startIndex, endIndex, opts.Strict,
+				opts.NumChannels, opts.Channel, opts.HeaderBytes, opts.MaxSamples, 0)
+			if err != nil {
+				return nil, err
+			}
+			progress(2*i + 1)
+			values = Rescale(values, opts.Scale, opts.Offset)
+
+			// Samples skipped by the read cap lower the rate seen by the
+			// filters and count towards the bin size
+			sampleRate, smoothWindow, bins := opts.SampleRate, opts.SmoothWindow, binSize
+			if step > 1 {
+				warnings = append(warnings, fmt.Sprintf(
+					"range exceeds the %d-sample read limit, read one sample in every %d", opts.MaxSamples, step))
+				if sampleRate <= 0 {
+					sampleRate = 1 // Keep transforms in units of original samples
+				}
+				sampleRate /= float64(step)
+				if smoothWindow > 0 {
+					smoothWindow = max(1, smoothWindow/step)
+				}
+				bins = (binSize + step - 1) / step
+			}
+
+			if opts.Notch != nil {
+				var notchWarnings []string
+				values, notchWarnings = ApplyNotchFilters(values, sampleRate, *opts.Notch)
+				warnings = append(warnings, notchWarnings...)
+			}
+			values, _ = Transform(values, opts.Transform, sampleRate, opts.IntegralInitial)
+			values, _ = Smooth(values, smoothWindow, opts.SmoothMethod)
+
+			// Apply the selected downsampling method
+			if bins > 1 {
+				times, values = downsample(times, values, bins)
+			}
+		}
+
+		// Enforce the points cap on the response
+		if !raw {
+			times, values = LimitPoints(times, values, opts.MaxPoints)
 		}
 
 		result[i] = FileData{
-			Times:  times,
-			Values: values,
+			Times:    times,
+			Values:   values,
+			Warnings: warnings,
 		}
+		progress(2*i + 2)
 	}
 
 	return result, nil
 }
 
+// ReadRange reads samples [startIndex, endIndex) of a float32 file. An
+// endIndex of 0 reads to the end of the file.
+func ReadRange(filePath string, startIndex, endIndex int) ([]float64, error) {
+	return ReadChannelRange(filePath, startIndex, endIndex, 1, 0, 0)
+}
+
+// ReadChannelRange reads samples [startIndex, endIndex) of one channel of an
+// interleaved float32 file with numChannels channels, skipping headerBytes
+func ReadChannelRange(filePath string, startIndex, endIndex, numChannels, channel int, headerBytes int64) ([]float64, error) {
+	return ReadChannelRangeLimit(filePath, startIndex, endIndex, numChannels, channel, headerBytes, 0)
+}
+
+// ErrRangeTooLong is returned, wrapped, by reads of more samples than their limit
+var ErrRangeTooLong = errors.New("range exceeds the sample limit")
+
+// ReadChannelRangeLimit reads like ReadChannelRange but fails with
+// ErrRangeTooLong, before reading anything, when the range once clamped to
+// the file holds more than limit samples. A limit of 0 reads any range.
+func ReadChannelRangeLimit(filePath string, startIndex, endIndex, numChannels, channel int, headerBytes int64, limit int) ([]float64, error) {
+	_, values, _, err := readBinaryFile(filePath, startIndex, endIndex, false, numChannels, channel, headerBytes, 0, limit)
+	return values, err
+}
+
 type FileData struct {
-	Times  []float64 `json:"times"`
-	Values []float64 `json:"values"`
+	Times    []float64 `json:"times"`
+	Values   []float64 `json:"values"`
+	Warnings []string  `json:"warnings,omitempty"`
 }
 
-func readBinaryFile(filePath string, startIndex, endIndex int) ([]float64, []float64, error) {
+// Frames read per disk access when a capped read skips samples
+const strideChunkFrames = 65536
+
+// readBinaryFile reads samples [startIndex, endIndex) of a float32 file. In
+// strict mode out-of-range indices are an error, otherwise they are clamped
+// to the file and an endIndex of 0 or less reads to the end. Files with
+// numChannels > 1 are interleaved and indices count samples of channel. The
+// first headerBytes bytes of the file are skipped. When maxSamples > 0 and the
+// range holds more samples, only every step-th sample is kept so at most
+// maxSamples are returned; the step used is returned alongside the samples.
+// When limit > 0, ranges of more than limit samples fail with ErrRangeTooLong.
+func readBinaryFile(filePath string, startIndex, endIndex int, strict bool, numChannels, channel int, headerBytes int64, maxSamples, limit int) ([]float64, []float64, int, error) {
+	stride, err := channelStride(numChannels, channel)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
 	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, err
 	}
 	defer file.Close()
 
 	fileInfo, err := file.Stat()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, err
+	}
+
+	if IsCompressed(filePath) {
+		samples, err := decompressedSamples(filePath, fileInfo, headerBytes)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if len(samples)%stride != 0 {
+			return nil, nil, 0, fmt.Errorf("decompressed size %d is not a multiple of %d channels of float32 samples",
+				len(samples)*4, stride)
+		}
+		startIndex, endIndex, err = clampRange(startIndex, endIndex, len(samples)/stride, strict)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if err := checkLimit(startIndex, endIndex, limit); err != nil {
+			return nil, nil, 0, err
+		}
+		step := readStep(startIndex, endIndex, maxSamples)
+		times, values := pickSamples(samples, startIndex, endIndex, step, stride, channel)
+		return times, values, step, nil
 	}
 
-	totalPoints := int(fileInfo.Size()) / 4 // Assuming 4 bytes per float32
+	if headerBytes < 0 || headerBytes > fileInfo.Size() {
+		return nil, nil, 0, fmt.Errorf("header size %d is outside the %d-byte file", headerBytes, fileInfo.Size())
+	}
+	dataBytes := fileInfo.Size() - headerBytes
+	if stride > 1 && dataBytes%int64(stride*4) != 0 {
+		return nil, nil, 0, fmt.Errorf("file size %d is not a multiple of %d channels of float32 samples",
+			dataBytes, stride)
+	}
+	totalPoints := int(dataBytes) / 4 / stride // Assuming 4 bytes per float32
 
 	// Validate indices
-	if startIndex < 0 {
-		startIndex = 0
+	startIndex, endIndex, err = clampRange(startIndex, endIndex, totalPoints, strict)
+	if err != nil {
+		return nil, nil, 0, err
 	}
-	if endIndex <= 0 || endIndex > totalPoints {
-		endIndex = totalPoints
+	if err := checkLimit(startIndex, endIndex, limit); err != nil {
+		return nil, nil, 0, err
 	}
-	if startIndex >= endIndex {
-		return nil, nil, fmt.Errorf("invalid index range: start=%d, end=%d", startIndex, endIndex)
+
+	// Serve repeated windowed reads from decoded samples kept in memory
+	step := readStep(startIndex, endIndex, maxSamples)
+	samples, err := cachedSamples(filePath, file, fileInfo, headerBytes)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if samples != nil {
+		times, values := pickSamples(samples, startIndex, endIndex, step, stride, channel)
+		return times, values, step, nil
 	}
 
-	pointsToRead := endIndex - startIndex
+	pointsToRead := (endIndex - startIndex + step - 1) / step
 	times := make([]float64, pointsToRead)
 	values := make([]float64, pointsToRead)
 
+	if step > 1 {
+		return readStrided(file, headerBytes, startIndex, endIndex, step, stride, channel, times, values)
+	}
+
 	// Ensure we don't seek beyond file boundaries
-	seekPos := int64(startIndex * 4)
+	seekPos := headerBytes + int64(startIndex*stride*4)
 	if seekPos >= fileInfo.Size() {
-		return nil, nil, fmt.Errorf("seek position beyond file size")
+		return nil, nil, 0, fmt.Errorf("seek position beyond file size")
 	}
 
 	_, err = file.Seek(seekPos, 0)
 	if err != nil {
-		return nil, nil, fmt.Errorf("seek error: %v", err)
+		return nil, nil, 0, fmt.Errorf("seek error: %v", err)
 	}
 
-	data := make([]byte, pointsToRead*4)
+	data := make([]byte, pointsToRead*stride*4)
 	n, err := file.Read(data)
 	if err != nil && err != io.EOF {
-		return nil, nil, err
+		return nil, nil, 0, err
 	}
 
 	// Adjust pointsToRead if we read less than expected
-	actualPoints := n / 4
+	actualPoints := n / 4 / stride
 	if actualPoints < pointsToRead {
 		pointsToRead = actualPoints
 		times = times[:actualPoints]
@@ -118,12 +376,112 @@ func readBinaryFile(filePath string, startIndex, endIndex int) ([]float64, []flo
 	}
 
 	for i := 0; i < pointsToRead; i++ {
-		value := math.Float32frombits(binary.LittleEndian.Uint32(data[i*4 : (i+1)*4]))
+		offset := (i*stride + channel) * 4
+		value := math.Float32frombits(binary.LittleEndian.Uint32(data[offset : offset+4]))
 		times[i] = float64(startIndex + i)
 		values[i] = float64(value)
 	}
 
-	return times, values, nil
+	return times, values, 1, nil
+}
+
+// readStep returns the sample step keeping a read of [startIndex, endIndex)
+// within maxSamples, skipping samples rather than allocating for an
+// arbitrarily large range
+func readStep(startIndex, endIndex, maxSamples int) int {
+	if maxSamples > 0 && endIndex-startIndex > maxSamples {
+		return (endIndex - startIndex + maxSamples - 1) / maxSamples
+	}
+	return 1
+}
+
+// pickSamples returns every step-th sample of channel in [startIndex,
+// endIndex) from decoded interleaved samples
+func pickSamples(samples []float32, startIndex, endIndex, step, stride, channel int) ([]float64, []float64) {
+	points := (endIndex - startIndex + step - 1) / step
+	times := make([]float64, points)
+	values := make([]float64, points)
+	for i := range values {
+		index := startIndex + i*step
+		times[i] = float64(index)
+		values[i] = float64(samples[index*stride+channel])
+	}
+	return times, values
+}
+
+// readStrided fills times and values with every step-th sample of
+// [startIndex, endIndex), reading the file in bounded chunks
+func readStrided(file *os.File, headerBytes int64, startIndex, endIndex, step, stride, channel int, times, values []float64) ([]float64, []float64, int, error) {
+	// Whole steps per chunk, so each chunk starts on a kept sample
+	chunkFrames := step * max(1, strideChunkFrames/step)
+	if chunkFrames > endIndex-startIndex {
+		chunkFrames = endIndex - startIndex
+	}
+	buffer := make([]byte, chunkFrames*stride*4)
+
+	i := 0
+	for frame := startIndex; frame < endIndex && i < len(values); frame += chunkFrames {
+		frames := min(chunkFrames, endIndex-frame)
+		chunk := buffer[:frames*stride*4]
+		n, err := file.ReadAt(chunk, headerBytes+int64(frame)*int64(stride*4))
+		if err != nil && err != io.EOF {
+			return nil, nil, 0, err
+		}
+		for offset := 0; offset < n/4/stride && i < len(values); offset += step {
+			at := (offset*stride + channel) * 4
+			times[i] = float64(frame + offset)
+			values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(chunk[at : at+4])))
+			i++
+		}
+		if n < len(chunk) {
+			break
+		}
+	}
+	return times[:i], values[:i], step, nil
+}
+
+// channelStride validates a channel selection and returns the number of
+// interleaved samples per frame
+func channelStride(numChannels, channel int) (int, error) {
+	if numChannels <= 1 {
+		if channel != 0 {
+			return 0, fmt.Errorf("channel %d out of range for a single-channel file", channel)
+		}
+		return 1, nil
+	}
+	if channel < 0 || channel >= numChannels {
+		return 0, fmt.Errorf("channel %d out of range for %d channels", channel, numChannels)
+	}
+	return numChannels, nil
+}
+
+// clampRange validates [startIndex, endIndex) against a file of totalPoints
+// samples. In strict mode out-of-range indices are an error, otherwise they
+// are clamped and an endIndex of 0 or less selects the end of the file.
+func clampRange(startIndex, endIndex, totalPoints int, strict bool) (int, int, error) {
+	if strict && (startIndex < 0 || endIndex <= 0 || endIndex > totalPoints) {
+		return 0, 0, fmt.Errorf("index range out of bounds: start=%d, end=%d, file has %d samples",
+			startIndex, endIndex, totalPoints)
+	}
+	if startIndex < 0 {
+		startIndex = 0
+	}
+	if endIndex <= 0 || endIndex > totalPoints {
+		endIndex = totalPoints
+	}
+	if startIndex >= endIndex {
+		return 0, 0, fmt.Errorf("invalid index range: start=%d, end=%d", startIndex, endIndex)
+	}
+	return startIndex, endIndex, nil
+}
+
+// checkLimit rejects ranges of more than limit samples when limit > 0
+func checkLimit(startIndex, endIndex, limit int) error {
+	if limit > 0 && endIndex-startIndex > limit {
+		return fmt.Errorf("%w: %d samples requested, at most %d allowed",
+			ErrRangeTooLong, endIndex-startIndex, limit)
+	}
+	return nil
 }
 
 // Helper function to get next power of 2
@@ -221,26 +579,121 @@ func dynamicDownsample(times, values []float64, binSize int) ([]float64, []float
 	return downsampledTimes, downsampledValues
 }
 
-// ReadBinaryFile reads a binary file and returns its contents as float64 slice
-func ReadBinaryFile(path string) ([]float64, error) {
-	file, err := os.OpenFile(path, os.O_RDONLY, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("error opening file: %v", err)
+// downsampler returns the downsampling function for the given method name.
+// An empty method selects the default extrema-preserving downsampling.
+func downsampler(method string) (func(times, values []float64, binSize int) ([]float64, []float64), error) {
+	switch method {
+	case "", "extrema":
+		return dynamicDownsample, nil
+	case "peakhold":
+		return peakHoldDownsample, nil
+	case "stride":
+		return strideDownsample, nil
+	case "average":
+		return averageDownsample, nil
+	default:
+		return nil, fmt.Errorf("unknown downsample method: %s", method)
 	}
-	defer file.Close()
+}
 
-	// Get file size
-	info, err := file.Stat()
-	if err != nil {
-		return nil, fmt.Errorf("error getting file info: %v", err)
+// peakHoldDownsample keeps the sample with the largest absolute value in each
+// bin, preserving its sign, which gives a conservative envelope of spiky signals
+func peakHoldDownsample(times, values []float64, binSize int) ([]float64, []float64) {
+	length := len(times)
+	if length <= 2 || binSize <= 1 {
+		return times, values
 	}
 
-	// Read file contents
-	data := make([]float64, info.Size()/8) // 8 bytes per float64
-	err = binary.Read(file, binary.LittleEndian, &data)
-	if err != nil {
-		return nil, fmt.Errorf("error reading file: %v", err)
+	numBins := (length + binSize - 1) / binSize
+	downsampledTimes := make([]float64, 0, numBins)
+	downsampledValues := make([]float64, 0, numBins)
+
+	for start := 0; start < length; start += binSize {
+		end := start + binSize
+		if end > length {
+			end = length
+		}
+
+		peakIdx := start
+		for j := start + 1; j < end; j++ {
+			if math.Abs(values[j]) > math.Abs(values[peakIdx]) {
+				peakIdx = j
+			}
+		}
+
+		downsampledTimes = append(downsampledTimes, times[peakIdx])
+		downsampledValues = append(downsampledValues, values[peakIdx])
+	}
+
+	return downsampledTimes, downsampledValues
+}
+
+// strideDownsample keeps the first sample of each bin, so every point is an
+// instantaneous value of the signal
+func strideDownsample(times, values []float64, binSize int) ([]float64, []float64) {
+	if len(times) <= 2 || binSize <= 1 {
+		return times, values
+	}
+
+	numBins := (len(times) + binSize - 1) / binSize
+	downsampledTimes := make([]float64, 0, numBins)
+	downsampledValues := make([]float64, 0, numBins)
+	for start := 0; start < len(times); start += binSize {
+		downsampledTimes = append(downsampledTimes, times[start])
+		downsampledValues = append(downsampledValues, values[start])
+	}
+	return downsampledTimes, downsampledValues
+}
+
+// averageDownsample replaces each bin by its mean at the bin's centre time,
+// which lowers noise at the cost of flattening peaks
+func averageDownsample(times, values []float64, binSize int) ([]float64, []float64) {
+	length := len(times)
+	if length <= 2 || binSize <= 1 {
+		return times, values
+	}
+
+	numBins := (length + binSize - 1) / binSize
+	downsampledTimes := make([]float64, 0, numBins)
+	downsampledValues := make([]float64, 0, numBins)
+	for start := 0; start < length; start += binSize {
+		end := min(start+binSize, length)
+		sum := 0.0
+		for _, v := range values[start:end] {
+			sum += v
+		}
+		downsampledTimes = append(downsampledTimes, (times[start]+times[end-1])/2)
+		downsampledValues = append(downsampledValues, sum/float64(end-start))
 	}
+	return downsampledTimes, downsampledValues
+}
 
-	return data, nil
+// LimitPoints reduces times and values to at most maxPoints points, first with
+// extrema-preserving downsampling and then by striding if that isn't enough.
+// A maxPoints of 0 or less disables the limit.
+func LimitPoints(times, values []float64, maxPoints int) ([]float64, []float64) {
+	if maxPoints <= 0 || len(values) <= maxPoints {
+		return times, values
+	}
+
+	// dynamicDownsample emits up to 4 points per bin
+	binSize := int(math.Ceil(4 * float64(len(values)) / float64(maxPoints)))
+	times, values = dynamicDownsample(times, values, binSize)
+	if len(values) <= maxPoints {
+		return times, values
+	}
+
+	stride := int(math.Ceil(float64(len(values)) / float64(maxPoints)))
+	limitedTimes := make([]float64, 0, maxPoints)
+	limitedValues := make([]float64, 0, maxPoints)
+	for i := 0; i < len(values); i += stride {
+		limitedTimes = append(limitedTimes, times[i])
+		limitedValues = append(limitedValues, values[i])
+	}
+	return limitedTimes, limitedValues
+}
+
+// ReadBinaryFile reads every float32 sample of a binary file
+func ReadBinaryFile(path string) ([]float64, error) {
+	return ReadRange(path, 0, 0)
 }
@@ -0,0 +1,491 @@
+package timeseries
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestFile writes data as a float32 file in a temporary directory
+func writeTestFile(t *testing.T, data []float64) string {
+	t.Helper()
+	samples := make([]float32, len(data))
+	for i, v := range data {
+		samples[i] = float32(v)
+	}
+	path := filepath.Join(t.TempDir(), "data.bin")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := binary.Write(file, binary.LittleEndian, samples); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPeakHoldKeepsSpike(t *testing.T) {
+	times := make([]float64, 1000)
+	values := make([]float64, 1000)
+	for i := range values {
+		times[i] = float64(i)
+		values[i] = 0.1 * math.Sin(float64(i))
+	}
+	values[437] = -50
+
+	gotTimes, gotValues := peakHoldDownsample(times, values, 100)
+	if len(gotValues) != 10 {
+		t.Fatalf("got %d bins, want 10", len(gotValues))
+	}
+	if gotTimes[4] != 437 || gotValues[4] != -50 {
+		t.Errorf("bin 4 holds %v at %v, want the spike -50 at 437", gotValues[4], gotTimes[4])
+	}
+}
+
+func TestPeakHoldPlotKeepsSpike(t *testing.T) {
+	data := make([]float64, 100000)
+	for i := range data {
+		data[i] = 0.1 * math.Sin(float64(i))
+	}
+	data[43210] = -50
+	path := writeTestFile(t, data)
+
+	files, err := ReadAndDownsample([]string{path}, 0, len(data), 100, DownsampleOptions{Method: "peakhold"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range files[0].Values {
+		if v == -50 {
+			if files[0].Times[i] != 43210 {
+				t.Errorf("spike plotted at %v, want 43210", files[0].Times[i])
+			}
+			return
+		}
+	}
+	t.Errorf("spike missing from %d peak-hold points", len(files[0].Values))
+}
+
+func TestStrictIndicesRejectOutOfRangeEnd(t *testing.T) {
+	data := make([]float64, 1000)
+	for i := range data {
+		data[i] = float64(i)
+	}
+	path := writeTestFile(t, data)
+
+	if _, err := ReadAndDownsample([]string{path}, 0, 1001, 1, DownsampleOptions{Strict: true}); err == nil {
+		t.Error("strict mode accepted endIndex 1001 of a 1000-sample file")
+	}
+
+	files, err := ReadAndDownsample([]string{path}, 0, 1001, 1, DownsampleOptions{})
+	if err != nil {
+		t.Fatalf("lenient mode: %v", err)
+	}
+	if values := files[0].Values; len(values) != 1000 || values[999] != 999 {
+		t.Errorf("lenient mode returned %d samples, want the clamped 1000", len(values))
+	}
+
+	if _, err := ReadAndDownsample([]string{path}, 0, 1000, 1, DownsampleOptions{Strict: true}); err != nil {
+		t.Errorf("strict mode rejected the full range: %v", err)
+	}
+}
+
+func TestSuggestDecimationMeetsTarget(t *testing.T) {
+	for _, tt := range []struct {
+		length int64
+		target int
+	}{
+		{1000, 2000}, {2000, 2000}, {2001, 2000}, {1000000, 2000}, {999999, 1000}, {12345678, 1920}, {7, 3},
+	} {
+		factor, points, err := SuggestDecimation(tt.length, tt.target)
+		if err != nil {
+			t.Fatalf("%d samples to %d points: %v", tt.length, tt.target, err)
+		}
+		if want := (tt.length + int64(factor) - 1) / int64(factor); points != want {
+			t.Errorf("%d samples at factor %d: reported %d points, want %d", tt.length, factor, points, want)
+		}
+		if points > int64(tt.target) {
+			t.Errorf("%d samples to %d points: factor %d gives %d points", tt.length, tt.target, factor, points)
+		}
+		// A smaller factor would overshoot the target
+		if factor > 1 {
+			if finer := (tt.length + int64(factor) - 2) / int64(factor-1); finer <= int64(tt.target) {
+				t.Errorf("%d samples to %d points: factor %d also fits with %d points", tt.length, tt.target, factor-1, finer)
+			}
+		}
+	}
+
+	if _, _, err := SuggestDecimation(1000, 0); err == nil {
+		t.Error("a target of 0 points was accepted")
+	}
+}
+
+func TestDecimateRefusesToOverwriteItsInput(t *testing.T) {
+	path := writeTestFile(t, make([]float64, 100))
+
+	if _, err := DecimateFile(path, path, 2, DecimateOptions{}); err == nil {
+		t.Error("decimating a file onto itself was accepted")
+	}
+	if data, err := ReadRange(path, 0, 0); err != nil || len(data) != 100 {
+		t.Errorf("input now reads %d samples (%v), want 100", len(data), err)
+	}
+}
+
+func TestReadLimitRejectsLongRanges(t *testing.T) {
+	path := writeTestFile(t, make([]float64, 1000))
+
+	if _, err := ReadChannelRangeLimit(path, 0, 0, 1, 0, 0, 999); !errors.Is(err, ErrRangeTooLong) {
+		t.Errorf("reading 1000 samples with a limit of 999 gave %v, want ErrRangeTooLong", err)
+	}
+	data, err := ReadChannelRangeLimit(path, 100, 0, 1, 0, 0, 900)
+	if err != nil || len(data) != 900 {
+		t.Errorf("reading 900 samples with a limit of 900 gave %d samples, %v", len(data), err)
+	}
+}
+
+func TestDefaultRawThresholdHonoursMaxPoints(t *testing.T) {
+	data := make([]float64, 1500)
+	for i := range data {
+		data[i] = math.Sin(float64(i))
+	}
+	path := writeTestFile(t, data)
+
+	files, err := ReadAndDownsample([]string{path}, 0, len(data), 1, DownsampleOptions{MaxPoints: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(files[0].Values); n == 0 || n > 500 {
+		t.Errorf("1500 samples capped at 500 points returned %d points", n)
+	}
+}
+
+func TestMissingFileLengthIsNotExist(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.bin")
+
+	if _, err := GetTotalFileLength([]string{missing}, 0); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("length of a missing file gave %v, want fs.ErrNotExist", err)
+	}
+}
+
+// newTestCache returns an empty cache holding at most limit bytes of samples
+func newTestCache(limit int64) *fileCache {
+	return &fileCache{limit: limit, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func TestFileCacheHitsAndMisses(t *testing.T) {
+	cache := newTestCache(1 << 20)
+	path := writeTestFile(t, make([]float64, 10))
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := cache.get(path, info, 0); got != nil {
+		t.Fatalf("empty cache returned %d samples", len(got))
+	}
+	cache.put(path, info, 0, make([]float32, 10))
+	if got := cache.get(path, info, 0); len(got) != 10 {
+		t.Errorf("cached file returned %d samples, want 10", len(got))
+	}
+	if got := cache.get(path, info, 8); got != nil {
+		t.Errorf("a different header length hit the cache")
+	}
+}
+
+func TestFileCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	// Room for two 10-sample files
+	cache := newTestCache(80)
+	paths := make([]string, 3)
+	infos := make([]os.FileInfo, 3)
+	for i := range paths {
+		paths[i] = writeTestFile(t, make([]float64, 10))
+		info, err := os.Stat(paths[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		infos[i] = info
+	}
+
+	cache.put(paths[0], infos[0], 0, make([]float32, 10))
+	cache.put(paths[1], infos[1], 0, make([]float32, 10))
+	cache.get(paths[0], infos[0], 0) // Leaves paths[1] least recently used
+	cache.put(paths[2], infos[2], 0, make([]float32, 10))
+
+	if cache.get(paths[1], infos[1], 0) != nil {
+		t.Error("least recently used file was kept")
+	}
+	for _, i := range []int{0, 2} {
+		if cache.get(paths[i], infos[i], 0) == nil {
+			t.Errorf("file %d was evicted", i)
+		}
+	}
+	if cache.used > cache.limit {
+		t.Errorf("cache holds %d bytes, limit %d", cache.used, cache.limit)
+	}
+}
+
+func TestFileCacheDropsChangedFiles(t *testing.T) {
+	for _, change := range []string{"mtime", "size"} {
+		t.Run(change, func(t *testing.T) {
+			cache := newTestCache(1 << 20)
+			path := writeTestFile(t, make([]float64, 10))
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cache.put(path, info, 0, make([]float32, 10))
+
+			switch change {
+			case "mtime":
+				later := info.ModTime().Add(time.Second)
+				if err := os.Chtimes(path, later, later); err != nil {
+					t.Fatal(err)
+				}
+			case "size":
+				if err := os.WriteFile(path, make([]byte, 44), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			changed, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cache.get(path, changed, 0) != nil {
+				t.Errorf("file with a new %s hit the cache", change)
+			}
+			if _, ok := cache.entries[path]; ok || cache.used != 0 {
+				t.Errorf("stale entry kept, %d bytes in use", cache.used)
+			}
+		})
+	}
+}
+
+// writeSampleFile writes header followed by data as float32 samples, gzipped
+// when compress is set
+func writeSampleFile(t *testing.T, header []byte, data []float64, compress bool) string {
+	t.Helper()
+	raw := append([]byte(nil), header...)
+	for _, v := range data {
+		raw = binary.LittleEndian.AppendUint32(raw, math.Float32bits(float32(v)))
+	}
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if compress {
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(raw); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		path, raw = path+".gz", buf.Bytes()
+	}
+	if err := os.WriteFile(path, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// noise returns n reproducible samples in [-1, 1)
+func noise(n int) []float64 {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]float64, n)
+	for i := range data {
+		data[i] = 2*rng.Float64() - 1
+	}
+	return data
+}
+
+func TestOverviewEnvelopeMatchesSamples(t *testing.T) {
+	const factor = 512
+	data := noise(64 * factor)
+	// A header of huge values shows up in the envelope unless it is skipped
+	header := binary.LittleEndian.AppendUint32(nil, math.Float32bits(1e9))
+	header = append(header, header...)
+
+	for _, headerBytes := range []int64{0, int64(len(header))} {
+		path := writeSampleFile(t, header[:headerBytes], data, false)
+		times, values, got, ok, err := readOverview(path, 0, len(data), factor, DownsampleOptions{HeaderBytes: headerBytes})
+		if err != nil || !ok || got != factor {
+			t.Fatalf("header %d: overview read gave factor %d, ok %v, %v", headerBytes, got, ok, err)
+		}
+
+		// Each block contributes its minimum and maximum in time order
+		var wantTimes, wantValues []float64
+		for start := 0; start < len(data); start += factor {
+			minIdx, maxIdx := start, start
+			for i := start; i < start+factor; i++ {
+				if float32(data[i]) < float32(data[minIdx]) {
+					minIdx = i
+				}
+				if float32(data[i]) > float32(data[maxIdx]) {
+					maxIdx = i
+				}
+			}
+			for _, i := range []int{min(minIdx, maxIdx), max(minIdx, maxIdx)} {
+				wantTimes = append(wantTimes, float64(i))
+				wantValues = append(wantValues, float64(float32(data[i])))
+			}
+		}
+		if len(times) != len(wantTimes) {
+			t.Fatalf("header %d: %d points, want %d", headerBytes, len(times), len(wantTimes))
+		}
+		for i := range times {
+			if times[i] != wantTimes[i] || values[i] != wantValues[i] {
+				t.Fatalf("header %d: point %d is (%v, %v), want (%v, %v)",
+					headerBytes, i, times[i], values[i], wantTimes[i], wantValues[i])
+			}
+		}
+	}
+}
+
+func TestCompressedEnvelopeKeepsExtrema(t *testing.T) {
+	data := noise(1 << 16)
+	minIdx, maxIdx := 0, 0
+	for i, v := range data {
+		if v < data[minIdx] {
+			minIdx = i
+		}
+		if v > data[maxIdx] {
+			maxIdx = i
+		}
+	}
+
+	header := make([]byte, 8)
+	path := writeSampleFile(t, header, data, true)
+	opts := DownsampleOptions{MaxPoints: 256, HeaderBytes: int64(len(header))}
+	if _, _, _, ok, err := readOverview(path, 0, len(data), 1024, opts); ok || err != nil {
+		t.Errorf("compressed file served from an overview (%v)", err)
+	}
+
+	files, err := ReadAndDownsample([]string{path}, 0, len(data), 1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	times, values := files[0].Times, files[0].Values
+	if len(values) == 0 || len(values) > 256 {
+		t.Fatalf("got %d points, want 1 to 256", len(values))
+	}
+	low, high := float64(float32(data[minIdx])), float64(float32(data[maxIdx]))
+	kept := make(map[float64]float64)
+	for i := range times {
+		if values[i] < low || values[i] > high {
+			t.Fatalf("point %d at %v is %v, outside the data range [%v, %v]", i, times[i], values[i], low, high)
+		}
+		kept[times[i]] = values[i]
+	}
+	if kept[float64(minIdx)] != low || kept[float64(maxIdx)] != high {
+		t.Errorf("envelope dropped the minimum at %d or the maximum at %d", minIdx, maxIdx)
+	}
+}
+
+func TestCompressedFilesReadLikePlainFiles(t *testing.T) {
+	data := noise(5000)
+	header := make([]byte, 12)
+	plain := writeSampleFile(t, header, data, false)
+	compressed := writeSampleFile(t, header, data, true)
+
+	size, err := DataSize(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(len(header) + 4*len(data)); size != want {
+		t.Errorf("decompressed size %d, want %d", size, want)
+	}
+	length, err := GetTotalFileLength([]string{compressed}, int64(len(header)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if length != int64(len(data)) {
+		t.Errorf("compressed length %d, want %d", length, len(data))
+	}
+
+	want, err := ReadChannelRange(plain, 100, 4100, 1, 0, int64(len(header)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadChannelRange(compressed, 100, 4100, 1, 0, int64(len(header)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("read %d compressed samples, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("compressed sample %d is %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDecompressLimitRejectsLargeFiles(t *testing.T) {
+	SetDecompressLimit(400)
+	defer SetDecompressLimit(0)
+
+	fits := writeSampleFile(t, nil, noise(100), true)
+	if _, err := ReadDecompressed(fits); err != nil {
+		t.Errorf("file at the limit: %v", err)
+	}
+	if size, err := DataSize(fits); err != nil || size != 400 {
+		t.Errorf("file at the limit has size %d (%v), want 400", size, err)
+	}
+
+	tooLarge := writeSampleFile(t, nil, noise(101), true)
+	if _, err := ReadDecompressed(tooLarge); !errors.Is(err, ErrRangeTooLong) {
+		t.Errorf("decompressing past the limit gave %v, want ErrRangeTooLong", err)
+	}
+	if _, err := DataSize(tooLarge); !errors.Is(err, ErrRangeTooLong) {
+		t.Errorf("sizing past the limit gave %v, want ErrRangeTooLong", err)
+	}
+}
+
+func TestHeaderIsSkippedBeforeTheFirstSample(t *testing.T) {
+	data := []float64{0.25, -0.5, 0.75, -1}
+	header := binary.LittleEndian.AppendUint32(nil, math.Float32bits(1e9))
+	header = append(header, 0, 0, 0, 0)
+	path := writeSampleFile(t, header, data, false)
+
+	length, err := GetTotalFileLength([]string{path}, int64(len(header)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if length != int64(len(data)) {
+		t.Errorf("length %d, want %d samples after the header", length, len(data))
+	}
+	samples, err := ReadChannelRange(path, 0, 0, 1, 0, int64(len(header)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != len(data) || samples[0] != data[0] {
+		t.Errorf("read %v, want %v starting at the first post-header sample", samples, data)
+	}
+}
+
+func TestReadBinaryFileDecodesFloat32Samples(t *testing.T) {
+	data := []float64{0.5, -1.25, 3, 1e-3}
+	path := writeTestFile(t, data)
+
+	samples, err := ReadBinaryFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Decoded as float64, the 16 bytes would give 2 nonsense samples
+	if len(samples) != len(data) {
+		t.Fatalf("read %d samples, want %d", len(samples), len(data))
+	}
+	for i, v := range data {
+		if samples[i] != float64(float32(v)) {
+			t.Errorf("sample %d is %v, want %v", i, samples[i], float32(v))
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package timeseries
+
+import "fmt"
+
+// Derivative returns the numerical derivative of data using central
+// differences, with one-sided differences at the ends. A sampleRate of 0 or
+// less gives the derivative per sample.
+func Derivative(data []float64, sampleRate float64) []float64 {
+	n := len(data)
+	if n < 2 {
+		return make([]float64, n)
+	}
+	dt := sampleInterval(sampleRate)
+
+	derivative := make([]float64, n)
+	derivative[0] = (data[1] - data[0]) / dt
+	for i := 1; i < n-1; i++ {
+		derivative[i] = (data[i+1] - data[i-1]) / (2 * dt)
+	}
+	derivative[n-1] = (data[n-1] - data[n-2]) / dt
+	return derivative
+}
+
+// CumulativeIntegral returns the running trapezoidal integral of data,
+// starting from initial at the first sample. A sampleRate of 0 or less
+// integrates per sample.
+func CumulativeIntegral(data []float64, sampleRate, initial float64) []float64 {
+	if len(data) == 0 {
+		return data
+	}
+	dt := sampleInterval(sampleRate)
+
+	integral := make([]float64, len(data))
+	integral[0] = initial
+	for i := 1; i < len(data); i++ {
+		integral[i] = integral[i-1] + (data[i]+data[i-1])*dt/2
+	}
+	return integral
+}
+
+// Rescale converts raw samples such as ADC counts to physical units in place
+// as value*scale + offset. A scale of 0 selects 1.
+func Rescale(data []float64, scale, offset float64) []float64 {
+	if scale == 0 {
+		scale = 1
+	}
+	if scale == 1 && offset == 0 {
+		return data
+	}
+	for i, v := range data {
+		data[i] = v*scale + offset
+	}
+	return data
+}
+
+// Transform applies the named transform, "none" (default), "derivative" or
+// "integral", to data
+func Transform(data []float64, transform string, sampleRate, initial float64) ([]float64, error) {
+	switch transform {
+	case "", "none":
+		return data, nil
+	case "derivative":
+		return Derivative(data, sampleRate), nil
+	case "integral":
+		return CumulativeIntegral(data, sampleRate, initial), nil
+	default:
+		return nil, fmt.Errorf("unknown transform: %s", transform)
+	}
+}
+
+func sampleInterval(sampleRate float64) float64 {
+	if sampleRate <= 0 {
+		return 1
+	}
+	return 1 / sampleRate
+}
@@ -0,0 +1,56 @@
+package timeseries
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+)
+
+const wavFormatIEEEFloat = 3
+
+// WriteWAVFile writes data as a mono 32-bit IEEE float WAV file
+func WriteWAVFile(path string, data []float64, sampleRate int) error {
+	if sampleRate <= 0 {
+		return fmt.Errorf("sample rate must be positive, got %d", sampleRate)
+	}
+	const (
+		channels      = 1
+		bytesPerValue = 4
+		headerSize    = 58 // RIFF, 18-byte fmt, fact and data chunk headers
+	)
+	dataSize := len(data) * bytesPerValue
+	if uint64(dataSize)+headerSize-8 > math.MaxUint32 {
+		return fmt.Errorf("%d samples exceed the WAV size limit", len(data))
+	}
+
+	buf := make([]byte, headerSize+dataSize)
+	le := binary.LittleEndian
+
+	copy(buf[0:], "RIFF")
+	le.PutUint32(buf[4:], uint32(headerSize-8+dataSize))
+	copy(buf[8:], "WAVE")
+
+	// Non-PCM formats carry an 18-byte fmt chunk and a fact chunk
+	copy(buf[12:], "fmt ")
+	le.PutUint32(buf[16:], 18)
+	le.PutUint16(buf[20:], wavFormatIEEEFloat)
+	le.PutUint16(buf[22:], channels)
+	le.PutUint32(buf[24:], uint32(sampleRate))
+	le.PutUint32(buf[28:], uint32(sampleRate*channels*bytesPerValue))
+	le.PutUint16(buf[32:], channels*bytesPerValue)
+	le.PutUint16(buf[34:], bytesPerValue*8)
+	le.PutUint16(buf[36:], 0)
+
+	copy(buf[38:], "fact")
+	le.PutUint32(buf[42:], 4)
+	le.PutUint32(buf[46:], uint32(len(data)))
+
+	copy(buf[50:], "data")
+	le.PutUint32(buf[54:], uint32(dataSize))
+	for i, v := range data {
+		le.PutUint32(buf[headerSize+i*bytesPerValue:], math.Float32bits(float32(v)))
+	}
+
+	return os.WriteFile(path, buf, 0644)
+}
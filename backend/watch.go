@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"novacal/logging"
+)
+
+// Polling interval of a file watch when the client gives none, and the
+// shortest one accepted
+const (
+	defaultWatchInterval = 500 * time.Millisecond
+	minWatchInterval     = 50 * time.Millisecond
+)
+
+// Number of files one connection may watch at once
+const maxWatchesPerConn = 16
+
+// fileWatch polls one file for growth on behalf of a connection
+type fileWatch struct {
+	path        string
+	headerBytes int64
+	interval    time.Duration
+	conn        jsonWriter
+	stop        chan struct{}
+}
+
+// watchRegistry tracks the active file watches of every connection so they
+// can be stopped by request or when the connection closes
+type watchRegistry struct {
+	mu      sync.Mutex
+	watches map[*websocket.Conn]map[string]*fileWatch
+}
+
+var watchers = &watchRegistry{watches: make(map[*websocket.Conn]map[string]*fileWatch)}
+
+// start begins watching w.path for owner, replacing an existing watch of the
+// same file
+func (r *watchRegistry) start(owner *websocket.Conn, w *fileWatch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	watches := r.watches[owner]
+	if watches == nil {
+		watches = make(map[string]*fileWatch)
+		r.watches[owner] = watches
+	}
+	if old, ok := watches[w.path]; ok {
+		close(old.stop)
+	} else if len(watches) >= maxWatchesPerConn {
+		return fmt.Errorf("at most %d files can be watched per connection", maxWatchesPerConn)
+	}
+	watches[w.path] = w
+	go w.run(func() { r.remove(owner, w) })
+	return nil
+}
+
+// stop ends the watch of path for owner, or every watch of owner when path
+// is empty, and returns the number of watches stopped
+func (r *watchRegistry) stop(owner *websocket.Conn, path string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stopped := 0
+	for watched, w := range r.watches[owner] {
+		if path == "" || watched == path {
+			close(w.stop)
+			delete(r.watches[owner], watched)
+			stopped++
+		}
+	}
+	if len(r.watches[owner]) == 0 {
+		delete(r.watches, owner)
+	}
+	return stopped
+}
+
+// remove forgets w once it has stopped by itself, unless it was replaced
+func (r *watchRegistry) remove(owner *websocket.Conn, w *fileWatch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.watches[owner][w.path] == w {
+		delete(r.watches[owner], w.path)
+		if len(r.watches[owner]) == 0 {
+			delete(r.watches, owner)
+		}
+	}
+}
+
+// run polls the file until stopped, sending fileAppended when it grows and
+// fileTruncated when it shrinks. A file that can no longer be read ends the
+// watch with an error.
+func (w *fileWatch) run(done func()) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	info, err := os.Stat(w.path)
+	if err != nil {
+		done()
+		sendError(w.conn, fileErrorCode(err), fmt.Sprintf("Error watching %s: %v", filepath.Base(w.path), err))
+		return
+	}
+	size := info.Size()
+	safeWriteJSON(w.conn, map[string]interface{}{
+		"type":   "watchingFile",
+		"path":   w.path,
+		"size":   size,
+		"length": w.samples(size),
+	})
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(w.path)
+		if err != nil {
+			logging.Warnf("Stopped watching %s: %v", w.path, err)
+			done()
+			sendError(w.conn, fileErrorCode(err), fmt.Sprintf("Error watching %s: %v", filepath.Base(w.path), err))
+			return
+		}
+		if info.Size() == size {
+			continue
+		}
+
+		// A shrinking file was restarted, so the client should reload it
+		messageType := "fileAppended"
+		if info.Size() < size {
+			messageType = "fileTruncated"
+		}
+		safeWriteJSON(w.conn, map[string]interface{}{
+			"type":           messageType,
+			"path":           w.path,
+			"size":           info.Size(),
+			"length":         w.samples(info.Size()),
+			"previousLength": w.samples(size),
+		})
+		size = info.Size()
+	}
+}
+
+// samples returns the number of whole float32 samples in a file of size
+// bytes after the header
+func (w *fileWatch) samples(size int64) int64 {
+	if size <= w.headerBytes {
+		return 0
+	}
+	return (size - w.headerBytes) / 4
+}
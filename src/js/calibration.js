@@ -155,6 +155,7 @@ function startCalibration(dialog, calibrationData) {
     // Send calibration request to backend
     ws.send(JSON.stringify({
         type: 'calibrate',
+        phaseUnit: 'deg', // The phase axes below are labelled in degrees
         data: calibrationData
     }));
 
@@ -577,7 +578,8 @@ export async function exportCalibrationResults() {
             data: {
                 results: results,
                 csvData: csvData,
-                exportPath: exportDir
+                exportPath: exportDir,
+                phaseUnit: 'deg' // Results were requested in degrees
             }
         }));
 
@@ -56,6 +56,7 @@ class DialogManager {
             const calibrationData = this.collectCalibrationData();
             this.ws.send({
                 type: 'calibrate',
+                phaseUnit: 'deg',
                 data: calibrationData
             });
         };